@@ -0,0 +1,94 @@
+// Command migrate-notes brings Notes written by earlier versions of the writer up to date.
+//
+// It rewrites timestamps recorded in epoch seconds to epoch millis, then adds Notes that are missing from the recent notes
+// index to it.  Until the index is backfilled GET /notes would miss the Notes it lacks, so the reader scans the table
+// instead until it is deployed with RECENT_NOTES_INDEX_READY=true after this has run.  Every migration is safe to run
+// more than once, and naming migrations after the flags only runs those.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/bootstrap"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"log"
+	"os"
+)
+
+var (
+	dynamoDBEndpoint = flag.String("dynamodb", "", "the URL of the DynamoDB API, empty to use AWS")
+	tableName        = flag.String("table", "", "the DynamoDB table storing Notes")
+)
+
+// migration is a single named migration, run in the order of migrations
+type migration struct {
+	name    string
+	migrate func(ctx context.Context, api ddb.DynamoMigrateAPI, tableName string) (int, error)
+}
+
+var migrations = []migration{
+	{name: "timestamps", migrate: ddb.MigrateTimestamps},
+	{name: "recent-notes-index", migrate: ddb.BackfillRecentNotesIndex},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *tableName == "" {
+		log.Fatal("-table is required")
+	}
+
+	if *dynamoDBEndpoint != "" {
+		os.Setenv(bootstrap.DynamoDBEndpointEnv, *dynamoDBEndpoint)
+	}
+	if _, ok := os.LookupEnv(bootstrap.XRayDisabledEnv); !ok {
+		os.Setenv(bootstrap.XRayDisabledEnv, "true")
+	}
+	selected, err := selectMigrations(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	api := bootstrap.MustDynamoDBClient()
+
+	ctx := context.Background()
+	for _, m := range selected {
+		migrated, err := m.migrate(ctx, api, *tableName)
+		if err != nil {
+			log.Fatalf("%s: migrated %d notes before failing: %s", m.name, migrated, err)
+		}
+		log.Printf("%s: migrated %d notes", m.name, migrated)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: migrate-notes -table name [migration ...]\n\nflags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nmigrations, all of them by default:\n")
+	for _, m := range migrations {
+		fmt.Fprintf(out, "  %s\n", m.name)
+	}
+}
+
+// selectMigrations returns the named migrations in the order they must run, or every migration when none is named
+func selectMigrations(names []string) ([]migration, error) {
+	if len(names) == 0 {
+		return migrations, nil
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []migration
+	for _, m := range migrations {
+		if wanted[m.name] {
+			selected = append(selected, m)
+			delete(wanted, m.name)
+		}
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("unknown migration %q, run migrate-notes -h for the list of migrations", name)
+	}
+	return selected, nil
+}
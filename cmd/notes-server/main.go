@@ -0,0 +1,90 @@
+// Command notes-server runs the Notes API as a plain HTTP server for local development.
+//
+// Requests are routed with the resources in the OpenAPI document and handed to the same handlers the Lambda functions
+// use, translated in to API Gateway proxy events.
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/akijowski/tweek-2021-sam/internal/admin"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/bootstrap"
+	"github.com/akijowski/tweek-2021-sam/internal/reader"
+	"github.com/akijowski/tweek-2021-sam/internal/writer"
+	"log"
+	"net/http"
+	"os"
+)
+
+// authDisabledEnv, when "true", serves requests without authenticating them.  Only the local server honours it, the
+// Lambda functions refuse to start without authentication.
+const authDisabledEnv = "AUTH_DISABLED"
+
+var (
+	addr             = flag.String("addr", "localhost:3000", "the address to listen on")
+	specPath         = flag.String("spec", "reference/openapi.yml", "the OpenAPI document describing the routes")
+	dynamoDBEndpoint = flag.String("dynamodb", "http://localhost:8000", "the URL of the DynamoDB API, empty to use AWS")
+	tableName        = flag.String("table", "notes", "the DynamoDB table storing Notes")
+	signingKey       = flag.String("cursor-signing-key", "local-cursor-signing-key", "the key used to sign pagination cursors")
+	stage            = flag.String("stage", "local", "the API Gateway stage reported to the handlers")
+	jwksLocation     = flag.String("jwks", "", "the file or URL of the JWKS that signs bearer tokens, required unless "+authDisabledEnv+"=true")
+	jwtIssuer        = flag.String("jwt-issuer", "", "the iss claim bearer tokens must carry, empty to accept any issuer")
+	jwtAudience      = flag.String("jwt-audience", "", "the aud claim bearer tokens must carry, empty to accept any audience")
+)
+
+func main() {
+	flag.Parse()
+	if *signingKey == "" {
+		log.Fatal("-cursor-signing-key must not be empty")
+	}
+
+	routes, err := loadRoutes(*specPath)
+	if err != nil {
+		log.Fatalf("unable to load routes: %s", err)
+	}
+
+	if *dynamoDBEndpoint != "" {
+		os.Setenv(bootstrap.DynamoDBEndpointEnv, *dynamoDBEndpoint)
+	}
+	// there is no X-Ray daemon to send segments to
+	if _, ok := os.LookupEnv(bootstrap.XRayDisabledEnv); !ok {
+		os.Setenv(bootstrap.XRayDisabledEnv, "true")
+	}
+	api := bootstrap.MustDynamoDBClient()
+	var authenticator auth.Authenticator
+	switch {
+	case *jwksLocation != "":
+		keys, err := auth.LoadKeySet(context.Background(), *jwksLocation)
+		if err != nil {
+			log.Fatalf("unable to load the JWKS: %s", err)
+		}
+		authenticator = &auth.Verifier{Keys: keys, Issuer: *jwtIssuer, Audience: *jwtAudience}
+	case os.Getenv(authDisabledEnv) == "true":
+		log.Printf("%s is true, requests will not be authenticated", authDisabledEnv)
+	default:
+		log.Fatalf("-jwks must be set, or %s=true to serve requests without authentication", authDisabledEnv)
+	}
+
+	writerHandler := &writer.Handler{API: api, TableName: *tableName, Authenticator: authenticator}
+	readerHandler := &reader.Handler{API: api, TableName: *tableName, CursorSigningKey: []byte(*signingKey), Authenticator: authenticator}
+	adminHandler := &admin.Handler{API: api, TableName: *tableName, Authenticator: authenticator}
+	s := &server{
+		routes: routes,
+		functions: map[string]lambdaHandler{
+			"NotesWriterFunction": writerHandler.Handle,
+			"NotesReaderFunction": readerHandler.Handle,
+			"NotesAdminFunction":  adminHandler.Handle,
+		},
+		stage: *stage,
+	}
+	for _, rt := range routes {
+		if _, ok := s.functions[rt.Function]; !ok {
+			log.Fatalf("%s %s is integrated with unknown function %q", rt.Method, rt.Resource, rt.Function)
+		}
+		log.Printf("mounted %s %s -> %s", rt.Method, rt.Resource, rt.Function)
+	}
+
+	log.Printf("listening on http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
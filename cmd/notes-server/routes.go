@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// integrationFunction extracts the SAM logical ID of the Lambda function from an x-amazon-apigateway-integration uri
+var integrationFunction = regexp.MustCompile(`\$\{(\w+)\.Arn\}`)
+
+var httpMethods = map[string]string{
+	"get":     http.MethodGet,
+	"put":     http.MethodPut,
+	"post":    http.MethodPost,
+	"delete":  http.MethodDelete,
+	"options": http.MethodOptions,
+	"head":    http.MethodHead,
+	"patch":   http.MethodPatch,
+}
+
+type openAPIDocument struct {
+	Paths map[string]map[string]yaml.Node `yaml:"paths"`
+}
+
+type openAPIOperation struct {
+	OperationID string `yaml:"operationId"`
+	Integration struct {
+		URI struct {
+			Sub string `yaml:"Fn::Sub"`
+		} `yaml:"uri"`
+	} `yaml:"x-amazon-apigateway-integration"`
+}
+
+// route is a single API Gateway resource and method, e.g. GET /notes/{owner}
+type route struct {
+	Method   string
+	Resource string
+	Function string
+	segments []string
+}
+
+// loadRoutes reads the OpenAPI document at path and returns a route for every operation integrated with a Lambda function.
+func loadRoutes(path string) ([]*route, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseRoutes(b)
+}
+
+func parseRoutes(spec []byte) ([]*route, error) {
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse OpenAPI document: %w", err)
+	}
+	var routes []*route
+	for resource, item := range doc.Paths {
+		for key, node := range item {
+			method, ok := httpMethods[key]
+			if !ok {
+				continue
+			}
+			var op openAPIOperation
+			if err := node.Decode(&op); err != nil {
+				return nil, fmt.Errorf("unable to parse %s %s: %w", method, resource, err)
+			}
+			match := integrationFunction.FindStringSubmatch(op.Integration.URI.Sub)
+			if match == nil {
+				return nil, fmt.Errorf("%s %s is not integrated with a Lambda function", method, resource)
+			}
+			routes = append(routes, newRoute(method, resource, match[1]))
+		}
+	}
+	sortRoutes(routes)
+	return routes, nil
+}
+
+func newRoute(method, resource, function string) *route {
+	return &route{
+		Method:   method,
+		Resource: resource,
+		Function: function,
+		segments: strings.Split(strings.Trim(resource, "/"), "/"),
+	}
+}
+
+// sortRoutes orders routes so the most specific resource is matched first, e.g. /notes/{owner}/{title}:rename is tried
+// before /notes/{owner}/{title}.
+func sortRoutes(routes []*route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		si, sj := routes[i].specificity(), routes[j].specificity()
+		if si != sj {
+			return si > sj
+		}
+		if routes[i].Resource != routes[j].Resource {
+			return routes[i].Resource < routes[j].Resource
+		}
+		return routes[i].Method < routes[j].Method
+	})
+}
+
+// specificity is the number of literal characters in the resource template
+func (r *route) specificity() int {
+	n := 0
+	for _, segment := range r.segments {
+		if name, _, ok := parseParameter(segment); ok {
+			n += len(segment) - len(name) - 2
+		} else {
+			n += len(segment)
+		}
+	}
+	return n
+}
+
+// match returns the decoded path parameters when the escaped request path matches the resource template.
+func (r *route) match(escapedPath string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(escapedPath, "/"), "/")
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		part, err := url.PathUnescape(parts[i])
+		if err != nil {
+			return nil, false
+		}
+		name, suffix, ok := parseParameter(segment)
+		if !ok {
+			if part != segment {
+				return nil, false
+			}
+			continue
+		}
+		if len(part) <= len(suffix) || !strings.HasSuffix(part, suffix) {
+			return nil, false
+		}
+		params[name] = part[:len(part)-len(suffix)]
+	}
+	return params, true
+}
+
+// parseParameter splits a template segment such as {title}:rename into the parameter name and the literal suffix.
+func parseParameter(segment string) (name, suffix string, ok bool) {
+	if !strings.HasPrefix(segment, "{") {
+		return "", "", false
+	}
+	end := strings.Index(segment, "}")
+	if end < 0 {
+		return "", "", false
+	}
+	return segment[1:end], segment[end+1:], true
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestLoadRoutes(t *testing.T) {
+	routes, err := loadRoutes("../../reference/openapi.yml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := make(map[string]string)
+	for _, rt := range routes {
+		got[rt.Method+" "+rt.Resource] = rt.Function
+	}
+	expected := map[string]string{
+		"GET /notes":                         "NotesReaderFunction",
+		"POST /notes":                        "NotesWriterFunction",
+		"POST /notes:batch":                  "NotesWriterFunction",
+		"GET /notes/{owner}":                 "NotesReaderFunction",
+		"GET /notes/{owner}/{title}":         "NotesReaderFunction",
+		"PUT /notes/{owner}/{title}":         "NotesWriterFunction",
+		"PATCH /notes/{owner}/{title}":       "NotesWriterFunction",
+		"DELETE /notes/{owner}/{title}":      "NotesWriterFunction",
+		"POST /notes/{owner}/{title}:move":   "NotesWriterFunction",
+		"POST /notes/{owner}/{title}:rename": "NotesWriterFunction",
+		"GET /admin/notes:export":            "NotesAdminFunction",
+		"POST /admin/notes:import":           "NotesAdminFunction",
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected routes %v but got %v", expected, got)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	cases := map[string]struct {
+		spec      string
+		expectErr bool
+	}{
+		"path parameters are skipped": {
+			spec: `
+paths:
+  /notes/{owner}:
+    parameters:
+      - name: owner
+        in: path
+    get:
+      x-amazon-apigateway-integration:
+        uri:
+          Fn::Sub: arn:aws:apigateway:${AWS::Region}:lambda:path/2015-03-31/functions/${NotesReaderFunction.Arn}/invocations
+`,
+		},
+		"operation without lambda integration": {
+			spec: `
+paths:
+  /notes:
+    get:
+      x-amazon-apigateway-integration:
+        type: mock
+`,
+			expectErr: true,
+		},
+		"invalid document": {
+			spec:      "paths: [",
+			expectErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			routes, err := parseRoutes([]byte(tt.spec))
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected an error but got routes %v", routes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(routes) != 1 || routes[0].Method != http.MethodGet || routes[0].Function != "NotesReaderFunction" {
+				t.Errorf("unexpected routes: %v", routes)
+			}
+		})
+	}
+}
+
+func TestRoute_Match(t *testing.T) {
+	cases := map[string]struct {
+		resource       string
+		path           string
+		expectedParams map[string]string
+		expectMatch    bool
+	}{
+		"literal resource": {
+			resource:       "/notes",
+			path:           "/notes",
+			expectedParams: map[string]string{},
+			expectMatch:    true,
+		},
+		"path parameters are unescaped": {
+			resource:       "/notes/{owner}/{title}",
+			path:           "/notes/test-owner/a%2Fb%20c",
+			expectedParams: map[string]string{"owner": "test-owner", "title": "a/b c"},
+			expectMatch:    true,
+		},
+		"parameter with literal suffix": {
+			resource:       "/notes/{owner}/{title}:rename",
+			path:           "/notes/test-owner/test-title:rename",
+			expectedParams: map[string]string{"owner": "test-owner", "title": "test-title"},
+			expectMatch:    true,
+		},
+		"missing suffix does not match": {
+			resource: "/notes/{owner}/{title}:rename",
+			path:     "/notes/test-owner/test-title",
+		},
+		"empty parameter does not match": {
+			resource: "/notes/{owner}/{title}:rename",
+			path:     "/notes/test-owner/:rename",
+		},
+		"different length does not match": {
+			resource: "/notes/{owner}",
+			path:     "/notes/test-owner/test-title",
+		},
+		"different literal does not match": {
+			resource: "/notes",
+			path:     "/users",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			params, ok := newRoute(http.MethodGet, tt.resource, "NotesReaderFunction").match(tt.path)
+			if ok != tt.expectMatch {
+				t.Fatalf("expected match %t but got %t", tt.expectMatch, ok)
+			}
+			if ok && !reflect.DeepEqual(tt.expectedParams, params) {
+				t.Errorf("expected params %v but got %v", tt.expectedParams, params)
+			}
+		})
+	}
+}
+
+func TestSortRoutes(t *testing.T) {
+	routes := []*route{
+		newRoute(http.MethodPost, "/notes/{owner}/{title}", "NotesWriterFunction"),
+		newRoute(http.MethodPost, "/notes/{owner}/{title}:rename", "NotesWriterFunction"),
+		newRoute(http.MethodGet, "/notes", "NotesReaderFunction"),
+	}
+	sortRoutes(routes)
+	if routes[0].Resource != "/notes/{owner}/{title}:rename" {
+		t.Errorf("expected the most specific route first but got %q", routes[0].Resource)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+)
+
+// lambdaHandler is the signature shared by the API Gateway proxy handlers
+type lambdaHandler func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// server translates HTTP requests into API Gateway proxy events for the Lambda function behind the matching route.
+type server struct {
+	routes    []*route
+	functions map[string]lambdaHandler
+	stage     string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := newRequestID()
+	rt, params, err := s.findRoute(r)
+	if err != nil {
+		writeResponse(w, apigw.ErrorResponse(err, requestID, r.URL.Path))
+		return
+	}
+	request, err := newProxyRequest(r, rt, params, requestID, s.stage)
+	if err != nil {
+		writeResponse(w, apigw.ErrorResponse(err, requestID, r.URL.Path))
+		return
+	}
+
+	ctx := lambdacontext.NewContext(r.Context(), &lambdacontext.LambdaContext{AwsRequestID: requestID})
+	response, err := s.functions[rt.Function](ctx, request)
+	if err != nil {
+		// API Gateway hides the error of a failed invocation behind a generic 502
+		log.Printf("%s %s: %s returned an error: %s", r.Method, r.URL.Path, rt.Function, err)
+		writeResponse(w, events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadGateway,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       `{"message": "Internal server error"}`,
+		})
+		return
+	}
+	log.Printf("%s %s -> %s %d", r.Method, r.URL.Path, rt.Function, response.StatusCode)
+	writeResponse(w, response)
+}
+
+// findRoute returns the first route matching the request path and method
+func (s *server) findRoute(r *http.Request) (*route, map[string]string, error) {
+	pathMatched := false
+	for _, rt := range s.routes {
+		params, ok := rt.match(r.URL.EscapedPath())
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if rt.Method == r.Method {
+			return rt, params, nil
+		}
+	}
+	if pathMatched {
+		return nil, nil, &apigw.RequestError{StatusCode: http.StatusMethodNotAllowed, Detail: fmt.Sprintf("method %q is not supported", r.Method)}
+	}
+	return nil, nil, &apigw.RequestError{StatusCode: http.StatusNotFound, Detail: fmt.Sprintf("no resource matches %q", r.URL.Path)}
+}
+
+// newProxyRequest builds the event API Gateway would send to the Lambda function for r
+func newProxyRequest(r *http.Request, rt *route, params map[string]string, requestID, stage string) (events.APIGatewayProxyRequest, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "unable to read request body"}
+	}
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		headers[name] = values[len(values)-1]
+	}
+	query := r.URL.Query()
+	queryParameters := make(map[string]string, len(query))
+	for name, values := range query {
+		queryParameters[name] = values[len(values)-1]
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+	sourceIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return events.APIGatewayProxyRequest{
+		Resource:                        rt.Resource,
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               r.Header,
+		QueryStringParameters:           queryParameters,
+		MultiValueQueryStringParameters: query,
+		PathParameters:                  params,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:    requestID,
+			Stage:        stage,
+			ResourcePath: rt.Resource,
+			HTTPMethod:   r.Method,
+			Path:         r.URL.Path,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  sourceIP,
+				UserAgent: r.UserAgent(),
+			},
+		},
+		Body: string(body),
+	}, nil
+}
+
+func writeResponse(w http.ResponseWriter, response events.APIGatewayProxyResponse) {
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			log.Printf("unable to decode base64 response body: %s", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body = decoded
+	}
+	w.WriteHeader(response.StatusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("unable to write response: %s", err)
+	}
+}
+
+// newRequestID returns a random identifier in the same UUID format as an AWS request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Panicf("unable to generate request ID: %s", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
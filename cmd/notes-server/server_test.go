@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestServer_ServeHTTP(t *testing.T) {
+	cases := map[string]struct {
+		method             string
+		target             string
+		body               string
+		function           lambdaHandler
+		expectedStatusCode int
+		expectedHeaders    map[string]string
+		expectedBody       string
+	}{
+		"request is translated to a proxy event": {
+			method: http.MethodPut,
+			target: "/notes/test-owner/test%20title?limit=5",
+			body:   `{"message": "test-message"}`,
+			function: func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				lc, ok := lambdacontext.FromContext(ctx)
+				if !ok || lc.AwsRequestID != request.RequestContext.RequestID {
+					t.Errorf("expected the lambda context to carry the request ID")
+				}
+				expectedParams := map[string]string{"owner": "test-owner", "title": "test title"}
+				if !reflect.DeepEqual(expectedParams, request.PathParameters) {
+					t.Errorf("expected path parameters %v but got %v", expectedParams, request.PathParameters)
+				}
+				if request.Resource != "/notes/{owner}/{title}" || request.HTTPMethod != http.MethodPut {
+					t.Errorf("unexpected resource %s %s", request.HTTPMethod, request.Resource)
+				}
+				if request.QueryStringParameters["limit"] != "5" || request.Headers["If-Match"] != `"1"` {
+					t.Errorf("unexpected query %v or headers %v", request.QueryStringParameters, request.Headers)
+				}
+				return events.APIGatewayProxyResponse{
+					StatusCode: http.StatusOK,
+					Headers:    map[string]string{"ETag": `"2"`},
+					Body:       request.Body,
+				}, nil
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"ETag": `"2"`},
+			expectedBody:       `{"message": "test-message"}`,
+		},
+		"base64 response is decoded": {
+			method: http.MethodPut,
+			target: "/notes/test-owner/test-title",
+			function: func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: "aGVsbG8=", IsBase64Encoded: true}, nil
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "hello",
+		},
+		"function error returns bad gateway": {
+			method: http.MethodPut,
+			target: "/notes/test-owner/test-title",
+			function: func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{}, errors.New("boom")
+			},
+			expectedStatusCode: http.StatusBadGateway,
+		},
+		"unknown path returns not found": {
+			method:             http.MethodGet,
+			target:             "/users",
+			expectedStatusCode: http.StatusNotFound,
+			expectedHeaders:    map[string]string{"Content-Type": schema.ProblemContentType},
+		},
+		"unsupported method on resource": {
+			method:             http.MethodPost,
+			target:             "/notes/test-owner/test-title",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+			expectedHeaders:    map[string]string{"Content-Type": schema.ProblemContentType},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := &server{
+				routes:    []*route{newRoute(http.MethodPut, "/notes/{owner}/{title}", "NotesWriterFunction")},
+				functions: map[string]lambdaHandler{"NotesWriterFunction": tt.function},
+				stage:     "test",
+			}
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			r.Header.Set("If-Match", `"1"`)
+			w := httptest.NewRecorder()
+
+			s.ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatusCode {
+				t.Errorf("expected status %d but got %d", tt.expectedStatusCode, w.Code)
+			}
+			for name, value := range tt.expectedHeaders {
+				if got := w.Header().Get(name); got != value {
+					t.Errorf("expected header %s to be %q but got %q", name, value, got)
+				}
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q but got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
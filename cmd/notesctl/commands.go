@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/archive"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultWait is how long the table commands wait for the table to change state
+const defaultWait = 3 * time.Minute
+
+// fixtures are the Notes written by seed when no file is given, in the format of a BatchNoteRequest
+//
+//go:embed fixtures.json
+var fixtures []byte
+
+// listSigningKey signs the cursors used by list, which never leave the process
+var listSigningKey = []byte("notesctl")
+
+// API is the set of DynamoDB Client functions needed by the commands
+type API interface {
+	ddb.DynamoTableAPI
+	ddb.DynamoUpdateItemAPI
+	ddb.DynamoGetItemAPI
+	ddb.DynamoDeleteItemAPI
+	ddb.DynamoScanAPI
+	ddb.DynamoQueryAPI
+	ddb.DynamoBatchAPI
+	ddb.DynamoPutItemAPI
+}
+
+// env is what every command runs against
+type env struct {
+	api       API
+	tableName string
+	// apiKeysTableName is the table of the API key commands
+	apiKeysTableName string
+	stdin            io.Reader
+	stdout           io.Writer
+	stderr           io.Writer
+}
+
+// command is a single notesctl subcommand
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+// usageError is returned when a command is given the wrong arguments
+type usageError struct {
+	command *command
+	message string
+}
+
+func (e *usageError) Error() string {
+	return fmt.Sprintf("%s: %s\nusage: notesctl %s %s", e.command.name, e.message, e.command.name, e.command.args)
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "create-table", args: "[-wait] [-timeout duration]", summary: "create the Notes table", run: createTable},
+		{name: "describe-table", args: "", summary: "print the description of the Notes table as JSON", run: describeTable},
+		{name: "wait-table", args: "[-deleted] [-timeout duration]", summary: "wait for the Notes table to be ACTIVE, or deleted", run: waitTable},
+		{name: "delete-table", args: "[-wait] [-timeout duration]", summary: "delete the Notes table and every Note in it", run: deleteTable},
+		{name: "seed", args: "[-file path]", summary: "write the fixture Notes, or the Notes of a batch request file", run: seed},
+		{name: "list", args: "[-owner owner] [-limit n]", summary: "print every Note, or the Notes of an owner, as JSON Lines", run: listNotes},
+		{name: "get", args: "<owner> <title>", summary: "print a single Note as JSON", run: getNote},
+		{name: "put", args: "<owner> <title> <message|->", summary: "write a Note, replacing any Note with the same owner and title", run: putNote},
+		{name: "delete", args: "<owner> <title>", summary: "delete a single Note", run: deleteNote},
+		{name: "export", args: "[-format format] [-file path]", summary: "write every Note to a JSON Lines, CSV or Markdown archive", run: exportNotes},
+		{name: "import", args: "[-format format] [-conflict policy] [-file path]", summary: "write the Notes of an archive written by export", run: importNotes},
+		{name: "create-keys-table", args: "[-wait] [-timeout duration]", summary: "create the API keys table read by the authorizer", run: createAPIKeysTable},
+		{name: "create-key", args: "[-scopes scopes] [-expires duration] <owner>", summary: "create an API key for an owner and print it", run: createAPIKey},
+		{name: "delete-key", args: "<key>", summary: "delete an API key", run: deleteAPIKey},
+	}
+}
+
+// run runs the command named by the first argument with the remaining arguments
+func run(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errors.New("a command is required")
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(ctx, e, args[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %q, run notesctl -h for the list of commands", args[0])
+}
+
+// commandByName returns the command with the given name, which must exist
+func commandByName(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	panic("unknown command " + name)
+}
+
+// parseArgs parses the flags of the named command, returning a usageError unless exactly n arguments follow them
+func parseArgs(e *env, fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	c := commandByName(fs.Name())
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: notesctl %s %s\n\n%s\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != n {
+		return nil, &usageError{command: c, message: fmt.Sprintf("expected %d arguments but got %d", n, fs.NArg())}
+	}
+	return fs.Args(), nil
+}
+
+func createTable(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("create-table", flag.ContinueOnError)
+	wait := fs.Bool("wait", false, "wait for the table to be ACTIVE")
+	timeout := fs.Duration("timeout", defaultWait, "the longest time to wait")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	description, err := ddb.CreateNotesTable(ctx, e.api, e.tableName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "table %s is %s\n", e.tableName, description.TableStatus)
+	if !*wait {
+		return nil
+	}
+	if err = ddb.WaitForTable(ctx, e.api, e.tableName, *timeout); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "table %s is ACTIVE\n", e.tableName)
+	return nil
+}
+
+func describeTable(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("describe-table", flag.ContinueOnError)
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	description, err := ddb.DescribeTable(ctx, e.api, e.tableName)
+	if err != nil {
+		return err
+	}
+	return printJSON(e.stdout, description)
+}
+
+func waitTable(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("wait-table", flag.ContinueOnError)
+	deleted := fs.Bool("deleted", false, "wait for the table to be deleted instead")
+	timeout := fs.Duration("timeout", defaultWait, "the longest time to wait")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	if *deleted {
+		if err := ddb.WaitForTableDeleted(ctx, e.api, e.tableName, *timeout); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "table %s is deleted\n", e.tableName)
+		return nil
+	}
+	if err := ddb.WaitForTable(ctx, e.api, e.tableName, *timeout); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "table %s is ACTIVE\n", e.tableName)
+	return nil
+}
+
+func deleteTable(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("delete-table", flag.ContinueOnError)
+	wait := fs.Bool("wait", false, "wait for the table to be deleted")
+	timeout := fs.Duration("timeout", defaultWait, "the longest time to wait")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	description, err := ddb.DeleteTable(ctx, e.api, e.tableName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "table %s is %s\n", e.tableName, description.TableStatus)
+	if !*wait {
+		return nil
+	}
+	if err = ddb.WaitForTableDeleted(ctx, e.api, e.tableName, *timeout); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "table %s is deleted\n", e.tableName)
+	return nil
+}
+
+// seed creates the Notes of a batch request with ddb.BatchAddNotes, leaving existing Notes as they are.  Unlike
+// POST /notes:batch every Note must be valid, so a typo in a fixture file does not go unnoticed.
+func seed(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("file", "", "a JSON file in the format of a POST /notes:batch request, empty for the built-in fixtures")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	b := fixtures
+	if *file != "" {
+		var err error
+		if b, err = ioutil.ReadFile(*file); err != nil {
+			return err
+		}
+	}
+	var request schema.BatchNoteRequest
+	if err := json.Unmarshal(b, &request); err != nil {
+		return fmt.Errorf("unable to parse the notes: %w", err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	notes := make([]schema.Note, 0, len(request.Notes))
+	seen := make(map[[2]string]int)
+	for i, n := range request.Notes {
+		if err := n.Validate(); err != nil {
+			return fmt.Errorf("note %d: %w", i, err)
+		}
+		key := [2]string{n.Owner, n.Title}
+		if first, ok := seen[key]; ok {
+			return fmt.Errorf("note %d duplicates the note at index %d", i, first)
+		}
+		seen[key] = i
+		notes = append(notes, schema.Note{Owner: n.Owner, Title: n.Title, Message: n.Message})
+	}
+	results, err := ddb.BatchAddNotes(ctx, e.api, e.tableName, notes)
+	if results == nil {
+		return err
+	}
+	failed, existing := 0, 0
+	for i, werr := range results {
+		var eerr *ddb.NoteExistsError
+		if errors.As(werr, &eerr) {
+			existing++
+		} else if werr != nil {
+			failed++
+			fmt.Fprintf(e.stderr, "note %d (%s/%s): %s\n", i, notes[i].Owner, notes[i].Title, errorMessage(werr))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notes were not written", failed, len(notes))
+	}
+	fmt.Fprintf(e.stdout, "wrote %d notes to %s, %d already existed\n", len(notes)-existing, e.tableName, existing)
+	return nil
+}
+
+// listNotes prints a NoteResponse per line, reading the table one page at a time
+func listNotes(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	owner := fs.String("owner", "", "only list the Notes of this owner")
+	limit := fs.Int("limit", 0, "the most Notes to print, 0 for all of them")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	if *limit < 0 {
+		return &usageError{command: commandByName("list"), message: "-limit must not be negative"}
+	}
+	encoder := json.NewEncoder(e.stdout)
+	printed := 0
+	page := ddb.PageRequest{Limit: ddb.MaxPageLimit, SigningKey: listSigningKey}
+	for {
+		var notes *ddb.NotesPage
+		var err error
+		if *owner != "" {
+			notes, err = ddb.FindNotesByOwnerPage(ctx, e.api, e.tableName, *owner, page)
+		} else {
+			notes, err = ddb.ScanPage(ctx, e.api, e.tableName, page)
+		}
+		if err != nil {
+			return err
+		}
+		for i := range notes.Notes {
+			if *limit > 0 && printed == *limit {
+				return nil
+			}
+			if err = encoder.Encode(schema.NewNoteResponse(&notes.Notes[i])); err != nil {
+				return err
+			}
+			printed++
+		}
+		if notes.NextCursor == "" {
+			return nil
+		}
+		page.Cursor = notes.NextCursor
+	}
+}
+
+func getNote(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	key, err := parseArgs(e, fs, args, 2)
+	if err != nil {
+		return err
+	}
+	note, err := ddb.GetNote(ctx, e.api, e.tableName, key[0], key[1])
+	if err != nil {
+		return err
+	}
+	return printJSON(e.stdout, schema.NewNoteResponse(note))
+}
+
+// putNote writes a Note with ddb.AddNote and prints it as stored.  A message of - is read from stdin.
+func putNote(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	values, err := parseArgs(e, fs, args, 3)
+	if err != nil {
+		return err
+	}
+	request := schema.NoteRequest{Owner: values[0], Title: values[1], Message: values[2]}
+	if request.Message == "-" {
+		b, err := ioutil.ReadAll(e.stdin)
+		if err != nil {
+			return err
+		}
+		request.Message = strings.TrimSuffix(string(b), "\n")
+	}
+	if err = request.Validate(); err != nil {
+		return err
+	}
+	if _, err = ddb.AddNote(ctx, e.api, e.tableName, &schema.Note{Owner: request.Owner, Title: request.Title, Message: request.Message}); err != nil {
+		return err
+	}
+	note, err := ddb.GetNote(ctx, e.api, e.tableName, request.Owner, request.Title)
+	if err != nil {
+		return err
+	}
+	return printJSON(e.stdout, schema.NewNoteResponse(note))
+}
+
+func deleteNote(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	key, err := parseArgs(e, fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if err = ddb.DeleteNote(ctx, e.api, e.tableName, key[0], key[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "deleted note %q for owner %q\n", key[1], key[0])
+	return nil
+}
+
+// exportNotes writes an archive with archive.Export to the file, or to stdout when no file is given
+func exportNotes(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := fs.String("format", "", "jsonl, csv or markdown, by default the format of the file extension or jsonl")
+	file := fs.String("file", "", "the archive to write, empty for stdout")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	format, err := archiveFormat("export", *formatName, *file)
+	if err != nil {
+		return err
+	}
+	out, status := e.stdout, e.stdout
+	if *file == "" {
+		// the archive is on stdout, so the summary is not
+		status = e.stderr
+	} else {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	count, err := archive.Export(ctx, e.api, e.tableName, format, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "exported %d notes from %s\n", count, e.tableName)
+	return nil
+}
+
+// importNotes writes the Notes of an archive with archive.Import, printing every Note that was not created or unchanged.
+// Rejected and failed Notes make the command fail, once the rest of the archive is imported.
+func importNotes(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := fs.String("format", "", "jsonl, csv or markdown, by default the format of the file extension or jsonl")
+	conflict := fs.String("conflict", string(archive.ConflictSkip), "skip, overwrite or rename a Note whose owner and title exist with another message")
+	file := fs.String("file", "", "the archive to read, empty for stdin")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	format, err := archiveFormat("import", *formatName, *file)
+	if err != nil {
+		return err
+	}
+	policy, err := archive.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return &usageError{command: commandByName("import"), message: err.Error()}
+	}
+	in := e.stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	response, err := archive.Import(ctx, e.api, e.tableName, format, in, policy)
+	if response == nil {
+		return err
+	}
+	for _, result := range response.Results {
+		switch result.Status {
+		case schema.ImportRenamed:
+			fmt.Fprintf(e.stdout, "note %d (%s/%s): renamed to %q\n", result.Index, result.Owner, result.Title, result.NewTitle)
+		case schema.ImportSkipped, schema.ImportOverwritten:
+			fmt.Fprintf(e.stdout, "note %d (%s/%s): %s\n", result.Index, result.Owner, result.Title, result.Status)
+		case schema.ImportRejected:
+			fmt.Fprintf(e.stderr, "note %d (%s/%s): %s\n", result.Index, result.Owner, result.Title, &schema.ValidationError{Fields: result.Errors})
+		case schema.ImportFailed:
+			fmt.Fprintf(e.stderr, "note %d (%s/%s): %s\n", result.Index, result.Owner, result.Title, result.Detail)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("imported %d notes before the archive could not be read: %w", len(response.Results), err)
+	}
+	fmt.Fprintf(e.stdout, "imported %d notes to %s:", len(response.Results), e.tableName)
+	for _, status := range []schema.ImportStatus{schema.ImportCreated, schema.ImportUnchanged, schema.ImportSkipped,
+		schema.ImportOverwritten, schema.ImportRenamed, schema.ImportRejected, schema.ImportFailed} {
+		if n := response.Counts[status]; n > 0 {
+			fmt.Fprintf(e.stdout, " %d %s", n, status)
+		}
+	}
+	fmt.Fprintln(e.stdout)
+	if bad := response.Counts[schema.ImportRejected] + response.Counts[schema.ImportFailed]; bad > 0 {
+		return fmt.Errorf("%d of %d notes were not written", bad, len(response.Results))
+	}
+	return nil
+}
+
+func createAPIKeysTable(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("create-keys-table", flag.ContinueOnError)
+	wait := fs.Bool("wait", false, "wait for the table to be ACTIVE")
+	timeout := fs.Duration("timeout", defaultWait, "the longest time to wait")
+	if _, err := parseArgs(e, fs, args, 0); err != nil {
+		return err
+	}
+	description, err := ddb.CreateAPIKeysTable(ctx, e.api, e.apiKeysTableName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "table %s is %s\n", e.apiKeysTableName, description.TableStatus)
+	if !*wait {
+		return nil
+	}
+	if err = ddb.WaitForTable(ctx, e.api, e.apiKeysTableName, *timeout); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "table %s is ACTIVE\n", e.apiKeysTableName)
+	return nil
+}
+
+// createAPIKey stores a random API key for the owner and prints it.  Only its hash is stored, so the key cannot be
+// printed again.
+func createAPIKey(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("create-key", flag.ContinueOnError)
+	scopes := fs.String("scopes", "", "the space separated scopes of the key, like notes:admin")
+	expires := fs.Duration("expires", 0, "how long the key is valid, 0 for a key that does not expire")
+	values, err := parseArgs(e, fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *expires < 0 {
+		return &usageError{command: commandByName("create-key"), message: "-expires must not be negative"}
+	}
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	apiKey := &schema.APIKey{KeyHash: schema.HashAPIKey(key), Owner: values[0], Scopes: strings.Fields(*scopes), CreatedAt: now.UnixMilli()}
+	if *expires > 0 {
+		apiKey.ExpiresAt = now.Add(*expires).Unix()
+	}
+	if err = ddb.PutAPIKey(ctx, e.api, e.apiKeysTableName, apiKey); err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, key)
+	return nil
+}
+
+func deleteAPIKey(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("delete-key", flag.ContinueOnError)
+	values, err := parseArgs(e, fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err = ddb.DeleteAPIKey(ctx, e.api, e.apiKeysTableName, values[0]); err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, "deleted api key")
+	return nil
+}
+
+// archiveFormat returns the named archive.Format, falling back to the format with the extension of the file and then to
+// JSON Lines
+func archiveFormat(commandName, name, file string) (archive.Format, error) {
+	if name != "" {
+		format, err := archive.ParseFormat(name)
+		if err != nil {
+			return "", &usageError{command: commandByName(commandName), message: err.Error()}
+		}
+		return format, nil
+	}
+	for _, format := range archive.Formats {
+		if file != "" && filepath.Ext(file) == format.Extension() {
+			return format, nil
+		}
+	}
+	return archive.JSONLines, nil
+}
+
+// printJSON writes v to w as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
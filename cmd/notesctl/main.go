@@ -0,0 +1,78 @@
+// Command notesctl manages the Notes table and the Notes in it, against AWS or any DynamoDB endpoint.
+//
+// The table is created from the definitions in the schema package and Notes are read and written through the ddb
+// package, so notesctl behaves like the functions do.  Run notesctl -h for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/bootstrap"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"log"
+	"os"
+)
+
+var (
+	dynamoDBEndpoint = flag.String("dynamodb", "", "the URL of the DynamoDB API, empty to use AWS")
+	tableName        = flag.String("table", "notes", "the DynamoDB table storing Notes")
+	apiKeysTableName = flag.String("api-keys-table", "api_keys", "the DynamoDB table storing the API keys of the authorizer")
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *dynamoDBEndpoint != "" {
+		os.Setenv(bootstrap.DynamoDBEndpointEnv, *dynamoDBEndpoint)
+	}
+	if _, ok := os.LookupEnv(bootstrap.XRayDisabledEnv); !ok {
+		os.Setenv(bootstrap.XRayDisabledEnv, "true")
+	}
+	e := &env{
+		api:              bootstrap.MustDynamoDBClient(),
+		tableName:        *tableName,
+		apiKeysTableName: *apiKeysTableName,
+		stdin:            os.Stdin,
+		stdout:           os.Stdout,
+		stderr:           os.Stderr,
+	}
+	err := run(context.Background(), e, flag.Args())
+	var uerr *usageError
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	case errors.As(err, &uerr):
+		fmt.Fprintln(os.Stderr, uerr)
+		os.Exit(2)
+	case err != nil:
+		log.Fatalf("%s: %s", flag.Arg(0), errorMessage(err))
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: notesctl [flags] <command> [command flags] [arguments]\n\nflags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nRun notesctl <command> -h for the flags and arguments of a command.\n")
+}
+
+// errorMessage describes err for the command line, including the message of a DynamoDB error that the functions hide
+// from API clients
+func errorMessage(err error) string {
+	var derr *ddb.DynamoDBError
+	if errors.As(err, &derr) {
+		return derr.ClientMessage
+	}
+	return err.Error()
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTableName = "notes"
+
+func TestRun(t *testing.T) {
+	cases := map[string]struct {
+		args []string
+		// withTable creates the Notes table and seeds it with the fixtures before the command runs
+		withTable      bool
+		stdin          string
+		expectedOutput []string
+		expectedError  func(err error) bool
+	}{
+		"create the table": {
+			args:           []string{"create-table", "-wait"},
+			expectedOutput: []string{"table notes is ACTIVE"},
+		},
+		"create an existing table": {
+			args:          []string{"create-table"},
+			withTable:     true,
+			expectedError: func(err error) bool { return strings.Contains(errorMessage(err), "Table already exists") },
+		},
+		"describe the table": {
+			args:           []string{"describe-table"},
+			withTable:      true,
+			expectedOutput: []string{`"TableName": "notes"`, `"IndexName": "recent-notes"`},
+		},
+		"describe a missing table": {
+			args:          []string{"describe-table"},
+			expectedError: func(err error) bool { return strings.Contains(errorMessage(err), "Requested resource not found") },
+		},
+		"wait for the table": {
+			args:           []string{"wait-table"},
+			withTable:      true,
+			expectedOutput: []string{"table notes is ACTIVE"},
+		},
+		"delete the table": {
+			args:           []string{"delete-table", "-wait"},
+			withTable:      true,
+			expectedOutput: []string{"table notes is DELETING", "table notes is deleted"},
+		},
+		"list every note": {
+			args:           []string{"list"},
+			withTable:      true,
+			expectedOutput: []string{`"owner":"adam"`, `"owner":"sam"`},
+		},
+		"get a note": {
+			args:           []string{"get", "sam", "ideas"},
+			withTable:      true,
+			expectedOutput: []string{`"message": "export notes as markdown"`},
+		},
+		"get a missing note": {
+			args:          []string{"get", "sam", "missing"},
+			withTable:     true,
+			expectedError: func(err error) bool { var e *ddb.NoteNotFoundError; return errors.As(err, &e) },
+		},
+		"put a note from stdin": {
+			args:           []string{"put", "sam", "ideas", "-"},
+			withTable:      true,
+			stdin:          "import notes\n",
+			expectedOutput: []string{`"message": "import notes"`, `"version": 2`},
+		},
+		"put an invalid note": {
+			args:          []string{"put", "sam", "", "message"},
+			withTable:     true,
+			expectedError: func(err error) bool { var e *schema.ValidationError; return errors.As(err, &e) },
+		},
+		"delete a note": {
+			args:           []string{"delete", "sam", "ideas"},
+			withTable:      true,
+			expectedOutput: []string{`deleted note "ideas" for owner "sam"`},
+		},
+		"import from stdin with the rename policy": {
+			args:           []string{"import", "-conflict", "rename"},
+			withTable:      true,
+			stdin:          "{\"owner\":\"sam\",\"title\":\"ideas\",\"message\":\"other\"}\n",
+			expectedOutput: []string{`note 0 (sam/ideas): renamed to "ideas (2)"`, "imported 1 notes to notes: 1 renamed"},
+		},
+		"import a rejected note": {
+			args:          []string{"import", "-format", "csv"},
+			withTable:     true,
+			stdin:         "owner,title,message\nsam,,m\n",
+			expectedError: func(err error) bool { return err.Error() == "1 of 1 notes were not written" },
+		},
+		"import an unknown format": {
+			args:          []string{"import", "-format", "xml"},
+			expectedError: func(err error) bool { var e *usageError; return errors.As(err, &e) },
+		},
+		"missing arguments": {
+			args:          []string{"get", "sam"},
+			expectedError: func(err error) bool { var e *usageError; return errors.As(err, &e) },
+		},
+		"unknown command": {
+			args:          []string{"drop"},
+			expectedError: func(err error) bool { return strings.Contains(err.Error(), "unknown command") },
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			var stdout, stderr bytes.Buffer
+			e := &env{api: ddbfake.New(), tableName: testTableName, stdin: strings.NewReader(tt.stdin), stdout: &stdout, stderr: &stderr}
+			if tt.withTable {
+				if err := run(ctx, e, []string{"create-table"}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if err := run(ctx, e, []string{"seed"}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				stdout.Reset()
+			}
+
+			err := run(ctx, e, tt.args)
+
+			if tt.expectedError != nil {
+				if err == nil || !tt.expectedError(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, expected := range tt.expectedOutput {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("expected the output to contain %q but got %s", expected, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	var fixtureRequest schema.BatchNoteRequest
+	if err := json.Unmarshal(fixtures, &fixtureRequest); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cases := map[string]struct {
+		file          string
+		expectedCount int
+		expectErr     bool
+	}{
+		"fixtures": {
+			expectedCount: len(fixtureRequest.Notes),
+		},
+		"file": {
+			file:          `{"notes": [{"owner": "a", "title": "1", "message": "m"}, {"owner": "a", "title": "2", "message": "m"}]}`,
+			expectedCount: 2,
+		},
+		"invalid note": {
+			file:      `{"notes": [{"owner": "a", "title": "1", "message": "m"}, {"owner": "a", "message": "m"}]}`,
+			expectErr: true,
+		},
+		"duplicate notes": {
+			file:      `{"notes": [{"owner": "a", "title": "1", "message": "m"}, {"owner": "a", "title": "1", "message": "again"}]}`,
+			expectErr: true,
+		},
+		"empty file": {
+			file:      `{"notes": []}`,
+			expectErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable(testTableName)
+			var stdout, stderr bytes.Buffer
+			e := &env{api: api, tableName: testTableName, stdout: &stdout, stderr: &stderr}
+			args := []string{"seed"}
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "notes.json")
+				if err := ioutil.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				args = append(args, "-file", path)
+			}
+
+			err := run(ctx, e, args)
+
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if stored := len(api.Items(testTableName)); stored != 0 {
+					t.Errorf("expected nothing to be stored but got %d notes", stored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if stored := len(api.Items(testTableName)); stored != tt.expectedCount {
+				t.Errorf("expected %d notes to be stored but got %d", tt.expectedCount, stored)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := ddbfake.NewNotesTable(testTableName)
+	var stdout, stderr bytes.Buffer
+	e := &env{api: source, tableName: testTableName, stdout: &stdout, stderr: &stderr}
+	if err := run(ctx, e, []string{"seed"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	seeded := len(source.Items(testTableName))
+
+	for _, extension := range []string{".jsonl", ".csv", ".tar"} {
+		t.Run(extension, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "notes"+extension)
+			stdout.Reset()
+			if err := run(ctx, e, []string{"export", "-file", path}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !strings.Contains(stdout.String(), "exported 5 notes") {
+				t.Errorf("unexpected output %s", stdout.String())
+			}
+
+			target := ddbfake.NewNotesTable(testTableName)
+			te := &env{api: target, tableName: testTableName, stdout: &stdout, stderr: &stderr}
+			for _, expected := range []string{"5 created", "5 unchanged"} {
+				stdout.Reset()
+				if err := run(ctx, te, []string{"import", "-file", path}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("expected the output to contain %q but got %s", expected, stdout.String())
+				}
+			}
+			if stored := len(target.Items(testTableName)); stored != seeded {
+				t.Errorf("expected %d notes to be imported but got %d", seeded, stored)
+			}
+		})
+	}
+}
+
+func TestListNotes(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable(testTableName)
+	var notes []schema.Note
+	for i := 0; i < int(ddb.MaxPageLimit)+5; i++ {
+		notes = append(notes, schema.Note{Owner: []string{"a", "b"}[i%2], Title: strings.Repeat("t", i+1), Message: "m"})
+	}
+	if _, err := ddb.BatchAddNotes(ctx, api, testTableName, notes); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cases := map[string]struct {
+		args          []string
+		expectedCount int
+		expectedOwner string
+	}{
+		"every note across pages": {args: []string{"list"}, expectedCount: len(notes)},
+		"limited":                 {args: []string{"list", "-limit", "3"}, expectedCount: 3},
+		"for an owner":            {args: []string{"list", "-owner", "b"}, expectedCount: len(notes) / 2, expectedOwner: "b"},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			e := &env{api: api, tableName: testTableName, stdout: &stdout, stderr: &stderr}
+
+			if err := run(ctx, e, tt.args); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if len(lines) != tt.expectedCount {
+				t.Fatalf("expected %d notes but got %d", tt.expectedCount, len(lines))
+			}
+			owners := make(map[string]bool)
+			for _, line := range lines {
+				var note schema.NoteResponse
+				if err := json.Unmarshal([]byte(line), &note); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				owners[note.Owner] = true
+			}
+			if tt.expectedOwner != "" && !reflect.DeepEqual(owners, map[string]bool{tt.expectedOwner: true}) {
+				t.Errorf("expected only notes for %s but got %v", tt.expectedOwner, owners)
+			}
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	var stdout, stderr bytes.Buffer
+	e := &env{api: ddbfake.New(), apiKeysTableName: "api_keys", stdout: &stdout, stderr: &stderr}
+	if err := run(ctx, e, []string{"create-keys-table", "-wait"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	stdout.Reset()
+
+	if err := run(ctx, e, []string{"create-key", "-scopes", "notes:admin", "-expires", "1h", "sam"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	key := strings.TrimSpace(stdout.String())
+	apiKey, err := ddb.GetAPIKey(ctx, e.api, e.apiKeysTableName, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if apiKey.Owner != "sam" || !reflect.DeepEqual(apiKey.Scopes, []string{"notes:admin"}) || apiKey.ExpiresAt == 0 {
+		t.Errorf("unexpected api key %+v", apiKey)
+	}
+	if err = run(ctx, e, []string{"delete-key", key}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = run(ctx, e, []string{"delete-key", key}); !errors.Is(err, ddb.ErrAPIKeyNotFound) {
+		t.Errorf("expected %v but got %v", ddb.ErrAPIKeyNotFound, err)
+	}
+}
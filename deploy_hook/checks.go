@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/authorizer"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// LambdaInvokeAPI is a stand-in for the Invoke function that exists on the AWS Lambda Client
+type LambdaInvokeAPI interface {
+	Invoke(ctx context.Context, input *lambda.InvokeInput, optFns ...func(options *lambda.Options)) (*lambda.InvokeOutput, error)
+}
+
+// hookPrincipal is the caller of the synthetic requests.  They skip API Gateway and its authorizer, so the hook passes the
+// authorizer context itself as an admin owning the sentinel Notes.
+var hookPrincipal = &auth.Principal{Owner: sentinelOwner, Scopes: []string{auth.AdminScope}}
+
+// check is a single named step of a lifecycle hook suite
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// checkResult is the outcome of a single check
+type checkResult struct {
+	name string
+	err  error
+}
+
+// proxyCheck sends a synthetic API Gateway request to a function and verifies the response
+func proxyCheck(name string, api LambdaInvokeAPI, functionName string, request events.APIGatewayProxyRequest, verify func(response events.APIGatewayProxyResponse) error) check {
+	request.RequestContext.Authorizer = hookPrincipal.Context()
+	return check{
+		name: name,
+		run: func(ctx context.Context) error {
+			response, err := invokeProxy(ctx, api, functionName, request)
+			if err != nil {
+				return err
+			}
+			return verify(response)
+		},
+	}
+}
+
+// authorizerRefusalCheck sends a REQUEST authorizer event to a function and verifies that it is refused.  An authorizer
+// refuses a request by failing with authorizer.ErrUnauthorized, any other failure means it could not decide.
+func authorizerRefusalCheck(name string, api LambdaInvokeAPI, functionName string, request events.APIGatewayCustomAuthorizerRequestTypeRequest) check {
+	return check{
+		name: name,
+		run: func(ctx context.Context) error {
+			payload, err := json.Marshal(request)
+			if err != nil {
+				return err
+			}
+			output, err := api.Invoke(ctx, &lambda.InvokeInput{
+				FunctionName:   aws.String(functionName),
+				InvocationType: types.InvocationTypeRequestResponse,
+				Payload:        payload,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to invoke %s: %w", functionName, err)
+			}
+			if output.FunctionError == nil {
+				return errors.New("expected the request to be refused but it was authorized")
+			}
+			var failure struct {
+				ErrorMessage string `json:"errorMessage"`
+			}
+			if err = json.Unmarshal(output.Payload, &failure); err != nil || failure.ErrorMessage != authorizer.ErrUnauthorized.Error() {
+				return fmt.Errorf("expected the request to be refused but got function error %q: %s", *output.FunctionError, output.Payload)
+			}
+			return nil
+		},
+	}
+}
+
+// runChecks runs every check in order, returning one result per check.  A failed check does not stop the ones after it,
+// so clean up steps always run.
+func runChecks(ctx context.Context, checks []check) []checkResult {
+	results := make([]checkResult, 0, len(checks))
+	for _, c := range checks {
+		err := c.run(ctx)
+		if err != nil {
+			log.Printf("check %q failed: %s", c.name, err)
+		} else {
+			log.Printf("check %q passed", c.name)
+		}
+		results = append(results, checkResult{name: c.name, err: err})
+	}
+	return results
+}
+
+// summarize describes the results, returning false when any check failed
+func summarize(results []checkResult) (string, bool) {
+	var failures []string
+	for _, result := range results {
+		if result.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", result.name, result.err))
+		}
+	}
+	summary := fmt.Sprintf("%d/%d checks passed", len(results)-len(failures), len(results))
+	if len(failures) > 0 {
+		summary += "; failed " + strings.Join(failures, "; ")
+	}
+	return summary, len(failures) == 0
+}
+
+// invokeProxy synchronously invokes the function with an API Gateway proxy event and decodes the proxy response
+func invokeProxy(ctx context.Context, api LambdaInvokeAPI, functionName string, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var response events.APIGatewayProxyResponse
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	output, err := api.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName:   aws.String(functionName),
+		InvocationType: types.InvocationTypeRequestResponse,
+		Payload:        payload,
+	})
+	if err != nil {
+		return response, fmt.Errorf("unable to invoke %s: %w", functionName, err)
+	}
+	if output.FunctionError != nil {
+		return response, fmt.Errorf("function error %q: %s", *output.FunctionError, output.Payload)
+	}
+	if err = json.Unmarshal(output.Payload, &response); err != nil {
+		return response, fmt.Errorf("response is not an API Gateway proxy response: %w", err)
+	}
+	return response, nil
+}
+
+func expectNotesPage(response events.APIGatewayProxyResponse) error {
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status %d but got %d", http.StatusOK, response.StatusCode)
+	}
+	var page map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(response.Body), &page); err != nil {
+		return fmt.Errorf("body is not a JSON object: %w", err)
+	}
+	notes, ok := page["notes"]
+	if !ok {
+		return errors.New("body is missing the notes list")
+	}
+	var list []schema.NoteResponse
+	if err := json.Unmarshal(notes, &list); err != nil {
+		return fmt.Errorf("notes are not a list of Notes: %w", err)
+	}
+	return nil
+}
+
+func expectProblem(status int) func(response events.APIGatewayProxyResponse) error {
+	return func(response events.APIGatewayProxyResponse) error {
+		if response.StatusCode != status {
+			return fmt.Errorf("expected status %d but got %d", status, response.StatusCode)
+		}
+		if contentType := response.Headers["Content-Type"]; contentType != schema.ProblemContentType {
+			return fmt.Errorf("expected content type %q but got %q", schema.ProblemContentType, contentType)
+		}
+		var problem schema.Problem
+		if err := json.Unmarshal([]byte(response.Body), &problem); err != nil {
+			return fmt.Errorf("body is not a problem: %w", err)
+		}
+		if problem.Status != status {
+			return fmt.Errorf("expected problem status %d but got %d", status, problem.Status)
+		}
+		return nil
+	}
+}
+
+func expectStatus(status int) func(response events.APIGatewayProxyResponse) error {
+	return func(response events.APIGatewayProxyResponse) error {
+		if response.StatusCode != status {
+			return fmt.Errorf("expected status %d but got %d: %s", status, response.StatusCode, response.Body)
+		}
+		return nil
+	}
+}
@@ -2,15 +2,40 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/bootstrap"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/codedeploy"
 	"github.com/aws/aws-sdk-go-v2/service/codedeploy/types"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
 	"log"
+	"os"
 )
 
-var codeDeployClient *codedeploy.Client
+const (
+	// PreTraffic runs before traffic shifts and is the default mode
+	PreTraffic = "PreTraffic"
+	// PostTraffic runs once all traffic has shifted to the new version
+	PostTraffic = "PostTraffic"
+)
+
+// CodeDeployLifecycleAPI is a stand-in for the PutLifecycleEventHookExecutionStatus function that exists on the AWS
+// CodeDeploy Client
+type CodeDeployLifecycleAPI interface {
+	PutLifecycleEventHookExecutionStatus(ctx context.Context, input *codedeploy.PutLifecycleEventHookExecutionStatusInput, optFns ...func(options *codedeploy.Options)) (*codedeploy.PutLifecycleEventHookExecutionStatusOutput, error)
+}
+
+var (
+	codeDeployClient CodeDeployLifecycleAPI
+	lambdaClient     LambdaInvokeAPI
+)
+
+// suites are the checks run for each HOOK_MODE
+var suites = map[string]func(api LambdaInvokeAPI, env hookEnv) []check{
+	PreTraffic:  preTrafficChecks,
+	PostTraffic: postTrafficChecks,
+}
 
 // DeploymentHook encapsulates the payload that is sent by AWS CodeDeploy when running pre/post traffic hooks.
 //
@@ -20,30 +45,71 @@ type DeploymentHook struct {
 	LifecycleEventHookExecutionID string `json:"LifecycleEventHookExecutionId"`
 }
 
+// hookEnv is what a suite knows about the deployment it is checking
+type hookEnv struct {
+	deploymentID string
+	executionID  string
+	// currentVersion is the ARN of the function version being deployed
+	currentVersion string
+	// writerFunction, readerFunction and authorizerFunction are the names or ARNs of the aliases serving the API
+	writerFunction     string
+	readerFunction     string
+	authorizerFunction string
+}
+
 func handler(ctx context.Context, event DeploymentHook) error {
 	log.Printf("event: %+v", event)
 
 	deploymentID := event.DeploymentID
 	executionId := event.LifecycleEventHookExecutionID
 	log.Printf("found DeploymentId=%q and ExecutionId=%q", deploymentID, executionId)
-	log.Print("automatically succeeding")
 
+	env := hookEnv{
+		deploymentID:       deploymentID,
+		executionID:        executionId,
+		currentVersion:     os.Getenv("CurrentVersion"),
+		writerFunction:     os.Getenv("WRITER_FUNCTION"),
+		readerFunction:     os.Getenv("READER_FUNCTION"),
+		authorizerFunction: os.Getenv("AUTHORIZER_FUNCTION"),
+	}
+	summary, ok := runSuite(ctx, os.Getenv("HOOK_MODE"), env)
+	log.Print(summary)
+
+	status := types.LifecycleEventStatusSucceeded
+	if !ok {
+		status = types.LifecycleEventStatusFailed
+	}
 	_, err := codeDeployClient.PutLifecycleEventHookExecutionStatus(ctx, &codedeploy.PutLifecycleEventHookExecutionStatusInput{
 		DeploymentId:                  aws.String(deploymentID),
-		Status:                        types.LifecycleEventStatusSucceeded,
+		Status:                        status,
 		LifecycleEventHookExecutionId: aws.String(executionId),
 	})
 	return err
 }
 
+// runSuite runs the checks for the mode and summarizes the results.  An unknown mode fails the deployment rather than
+// letting it through unchecked.
+func runSuite(ctx context.Context, mode string, env hookEnv) (string, bool) {
+	if mode == "" {
+		mode = PreTraffic
+	}
+	suite, ok := suites[mode]
+	if !ok {
+		return fmt.Sprintf("unknown HOOK_MODE %q", mode), false
+	}
+	log.Printf("running %s checks", mode)
+	return summarize(runChecks(ctx, suite(lambdaClient, env)))
+}
+
 func main() {
 	lambda.Start(handler)
 }
 
 func init() {
-	cfg, err := config.LoadDefaultConfig(context.Background())
+	cfg, err := bootstrap.LoadConfigFromEnv(context.Background())
 	if err != nil {
 		panic(err)
 	}
 	codeDeployClient = codedeploy.NewFromConfig(cfg)
+	lambdaClient = awslambda.NewFromConfig(cfg)
 }
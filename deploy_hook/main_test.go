@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/authorizer"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/reader"
+	"github.com/akijowski/tweek-2021-sam/internal/writer"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codedeploy"
+	"github.com/aws/aws-sdk-go-v2/service/codedeploy/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"net/http"
+	"testing"
+)
+
+type mockCodeDeployLifecycleAPI func(ctx context.Context, input *codedeploy.PutLifecycleEventHookExecutionStatusInput, optFns ...func(options *codedeploy.Options)) (*codedeploy.PutLifecycleEventHookExecutionStatusOutput, error)
+
+func (m mockCodeDeployLifecycleAPI) PutLifecycleEventHookExecutionStatus(ctx context.Context, input *codedeploy.PutLifecycleEventHookExecutionStatusInput, optFns ...func(options *codedeploy.Options)) (*codedeploy.PutLifecycleEventHookExecutionStatusOutput, error) {
+	return m(ctx, input, optFns...)
+}
+
+type mockLambdaInvokeAPI func(ctx context.Context, input *lambda.InvokeInput, optFns ...func(options *lambda.Options)) (*lambda.InvokeOutput, error)
+
+func (m mockLambdaInvokeAPI) Invoke(ctx context.Context, input *lambda.InvokeInput, optFns ...func(options *lambda.Options)) (*lambda.InvokeOutput, error) {
+	return m(ctx, input, optFns...)
+}
+
+type proxyHandler func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// proxyInvoker answers Invoke calls with the API Gateway proxy handler registered for the function name, the way Lambda
+// would run the function
+func proxyInvoker(t *testing.T, functions map[string]proxyHandler) mockLambdaInvokeAPI {
+	return func(ctx context.Context, input *lambda.InvokeInput, optFns ...func(options *lambda.Options)) (*lambda.InvokeOutput, error) {
+		handle, ok := functions[aws.ToString(input.FunctionName)]
+		if !ok {
+			t.Fatalf("unexpected function %q was invoked", aws.ToString(input.FunctionName))
+		}
+		var request events.APIGatewayProxyRequest
+		if err := json.Unmarshal(input.Payload, &request); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		response, err := handle(ctx, request)
+		if err != nil {
+			return &lambda.InvokeOutput{StatusCode: 200, FunctionError: aws.String("Unhandled"), Payload: []byte(err.Error())}, nil
+		}
+		payload, _ := json.Marshal(response)
+		return &lambda.InvokeOutput{StatusCode: 200, Payload: payload}, nil
+	}
+}
+
+type authorizerHandler func(ctx context.Context, request events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error)
+
+// withAuthorizer answers Invoke calls for the authorizer function with the REQUEST authorizer handler, reporting its
+// errors the way Lambda would, and passes every other call on to next
+func withAuthorizer(t *testing.T, next mockLambdaInvokeAPI, functionName string, handle authorizerHandler) mockLambdaInvokeAPI {
+	return func(ctx context.Context, input *lambda.InvokeInput, optFns ...func(options *lambda.Options)) (*lambda.InvokeOutput, error) {
+		if aws.ToString(input.FunctionName) != functionName {
+			return next(ctx, input, optFns...)
+		}
+		var request events.APIGatewayCustomAuthorizerRequestTypeRequest
+		if err := json.Unmarshal(input.Payload, &request); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		response, err := handle(ctx, request)
+		if err != nil {
+			payload, _ := json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "errorString"})
+			return &lambda.InvokeOutput{StatusCode: 200, FunctionError: aws.String("Unhandled"), Payload: payload}, nil
+		}
+		payload, _ := json.Marshal(response)
+		return &lambda.InvokeOutput{StatusCode: 200, Payload: payload}, nil
+	}
+}
+
+func TestHandler(t *testing.T) {
+	api := ddbfake.NewNotesTable("notes")
+	healthyReader := &reader.Handler{API: api, TableName: "notes", Authenticator: auth.AuthorizerContext{}, CursorSigningKey: []byte("key")}
+	healthyWriter := &writer.Handler{API: api, TableName: "notes", Authenticator: auth.AuthorizerContext{}}
+	if _, err := ddb.CreateAPIKeysTable(context.Background(), api, "api-keys"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	healthyAuthorizer := &authorizer.Handler{API: api, APIKeysTableName: "api-keys"}
+	// the role of the function cannot read the table, which looks the same as the table missing
+	unreadableAuthorizer := &authorizer.Handler{API: api, APIKeysTableName: "missing-api-keys"}
+	failing := func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, nil
+	}
+	cases := map[string]struct {
+		mode           string
+		lambdaClient   LambdaInvokeAPI
+		expectedStatus types.LifecycleEventStatus
+	}{
+		"healthy reader succeeds": {
+			lambdaClient:   proxyInvoker(t, map[string]proxyHandler{"reader-version-arn": healthyReader.Handle}),
+			expectedStatus: types.LifecycleEventStatusSucceeded,
+		},
+		"reader returning errors fails": {
+			lambdaClient:   proxyInvoker(t, map[string]proxyHandler{"reader-version-arn": failing}),
+			expectedStatus: types.LifecycleEventStatusFailed,
+		},
+		"reader crashing fails": {
+			lambdaClient: proxyInvoker(t, map[string]proxyHandler{
+				"reader-version-arn": func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+					return events.APIGatewayProxyResponse{}, errors.New("panic")
+				},
+			}),
+			expectedStatus: types.LifecycleEventStatusFailed,
+		},
+		"invoke error fails": {
+			lambdaClient: mockLambdaInvokeAPI(func(ctx context.Context, input *lambda.InvokeInput, optFns ...func(options *lambda.Options)) (*lambda.InvokeOutput, error) {
+				return nil, errors.New("access denied")
+			}),
+			expectedStatus: types.LifecycleEventStatusFailed,
+		},
+		"post traffic round trip succeeds": {
+			mode: PostTraffic,
+			lambdaClient: withAuthorizer(t, proxyInvoker(t, map[string]proxyHandler{
+				"writer-alias": healthyWriter.Handle,
+				"reader-alias": healthyReader.Handle,
+			}), "authorizer-alias", healthyAuthorizer.Handle),
+			expectedStatus: types.LifecycleEventStatusSucceeded,
+		},
+		"post traffic with a broken writer fails": {
+			mode: PostTraffic,
+			lambdaClient: withAuthorizer(t, proxyInvoker(t, map[string]proxyHandler{
+				"writer-alias": failing,
+				"reader-alias": healthyReader.Handle,
+			}), "authorizer-alias", healthyAuthorizer.Handle),
+			expectedStatus: types.LifecycleEventStatusFailed,
+		},
+		"post traffic with an unreadable api keys table fails": {
+			mode: PostTraffic,
+			lambdaClient: withAuthorizer(t, proxyInvoker(t, map[string]proxyHandler{
+				"writer-alias": healthyWriter.Handle,
+				"reader-alias": healthyReader.Handle,
+			}), "authorizer-alias", unreadableAuthorizer.Handle),
+			expectedStatus: types.LifecycleEventStatusFailed,
+		},
+		"unknown mode fails": {
+			mode:           "BeforeInstall",
+			expectedStatus: types.LifecycleEventStatusFailed,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HOOK_MODE", tt.mode)
+			t.Setenv("CurrentVersion", "reader-version-arn")
+			t.Setenv("WRITER_FUNCTION", "writer-alias")
+			t.Setenv("READER_FUNCTION", "reader-alias")
+			t.Setenv("AUTHORIZER_FUNCTION", "authorizer-alias")
+			var reported types.LifecycleEventStatus
+			codeDeployClient = mockCodeDeployLifecycleAPI(func(ctx context.Context, input *codedeploy.PutLifecycleEventHookExecutionStatusInput, optFns ...func(options *codedeploy.Options)) (*codedeploy.PutLifecycleEventHookExecutionStatusOutput, error) {
+				if aws.ToString(input.DeploymentId) != "d-123" || aws.ToString(input.LifecycleEventHookExecutionId) != "e-456" {
+					t.Errorf("unexpected input: %+v", input)
+				}
+				reported = input.Status
+				return &codedeploy.PutLifecycleEventHookExecutionStatusOutput{}, nil
+			})
+			lambdaClient = tt.lambdaClient
+
+			err := handler(context.Background(), DeploymentHook{DeploymentID: "d-123", LifecycleEventHookExecutionID: "e-456"})
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if reported != tt.expectedStatus {
+				t.Errorf("expected status %q but got %q", tt.expectedStatus, reported)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary, ok := summarize([]checkResult{{name: "a"}, {name: "b", err: errors.New("expected status 200 but got 500")}})
+	if ok {
+		t.Error("expected a failed summary")
+	}
+	expected := "1/2 checks passed; failed b: expected status 200 but got 500"
+	if summary != expected {
+		t.Errorf("expected summary %q but got %q", expected, summary)
+	}
+}
+
+func TestPostTrafficChecks_CleanUp(t *testing.T) {
+	api := ddbfake.NewNotesTable("notes")
+	functions := map[string]proxyHandler{
+		"writer-alias": (&writer.Handler{API: api, TableName: "notes"}).Handle,
+		"reader-alias": (&reader.Handler{API: api, TableName: "notes"}).Handle,
+	}
+	if _, err := ddb.CreateAPIKeysTable(context.Background(), api, "api-keys"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	authorizerHandler := &authorizer.Handler{API: api, APIKeysTableName: "api-keys"}
+	env := hookEnv{deploymentID: "d-123", executionID: "e-456", writerFunction: "writer-alias", readerFunction: "reader-alias", authorizerFunction: "authorizer-alias"}
+
+	results := runChecks(context.Background(), postTrafficChecks(withAuthorizer(t, proxyInvoker(t, functions), "authorizer-alias", authorizerHandler.Handle), env))
+
+	if summary, ok := summarize(results); !ok {
+		t.Errorf("expected the round trip to pass: %s", summary)
+	}
+	if items := api.Items("notes"); len(items) != 0 {
+		t.Errorf("expected the sentinel note to be deleted but found %v", items)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"net/url"
+)
+
+// sentinelOwner owns the Notes written by the post traffic round trip, keeping them apart from real data
+const sentinelOwner = "deploy-hook-sentinel"
+
+// postTrafficChecks run once traffic has shifted.  They create a sentinel Note through the writer alias, read it back
+// through the reader alias and delete it again, so both functions are verified end to end against the real table.  The
+// authorizer alias is sent an API key that does not exist, which it can only refuse once it has read the API keys
+// table.
+func postTrafficChecks(api LambdaInvokeAPI, env hookEnv) []check {
+	note := schema.Note{
+		Owner:   sentinelOwner,
+		Title:   "sentinel-" + env.executionID,
+		Message: fmt.Sprintf("written by deployment %s", env.deploymentID),
+	}
+	body, _ := json.Marshal(schema.NoteRequest{Owner: note.Owner, Title: note.Title, Message: note.Message})
+	notePath := fmt.Sprintf("/notes/%s/%s", url.PathEscape(note.Owner), url.PathEscape(note.Title))
+	noteRequest := func(method string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			Resource:       "/notes/{owner}/{title}",
+			Path:           notePath,
+			HTTPMethod:     method,
+			PathParameters: map[string]string{"owner": note.Owner, "title": note.Title},
+		}
+	}
+
+	return []check{
+		proxyCheck("create sentinel note", api, env.writerFunction, events.APIGatewayProxyRequest{
+			Resource:   "/notes",
+			Path:       "/notes",
+			HTTPMethod: http.MethodPost,
+			Body:       string(body),
+		}, expectStatus(http.StatusCreated)),
+		proxyCheck("read sentinel note", api, env.readerFunction, noteRequest(http.MethodGet), expectNote(note)),
+		proxyCheck("delete sentinel note", api, env.writerFunction, noteRequest(http.MethodDelete), expectStatus(http.StatusNoContent)),
+		proxyCheck("sentinel note is gone", api, env.readerFunction, noteRequest(http.MethodGet), expectProblem(http.StatusNotFound)),
+		authorizerRefusalCheck("unknown api key is refused", api, env.authorizerFunction, events.APIGatewayCustomAuthorizerRequestTypeRequest{
+			Type:       "REQUEST",
+			Path:       "/notes",
+			HTTPMethod: http.MethodGet,
+			Headers:    map[string]string{"Authorization": "ApiKey " + sentinelOwner + "-" + env.executionID},
+		}),
+	}
+}
+
+// expectNote verifies that the response is the expected Note along with its entity tag
+func expectNote(expected schema.Note) func(response events.APIGatewayProxyResponse) error {
+	return func(response events.APIGatewayProxyResponse) error {
+		if err := expectStatus(http.StatusOK)(response); err != nil {
+			return err
+		}
+		var got schema.NoteResponse
+		if err := json.Unmarshal([]byte(response.Body), &got); err != nil {
+			return fmt.Errorf("body is not a Note: %w", err)
+		}
+		if got.Owner != expected.Owner || got.Title != expected.Title || got.Message != expected.Message {
+			return fmt.Errorf("expected note %+v but got %+v", expected, got)
+		}
+		if etag := schema.NoteFromResponse(&got).ETag(); response.Headers["ETag"] != etag {
+			return fmt.Errorf("expected ETag %s but got %q", etag, response.Headers["ETag"])
+		}
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+)
+
+// preTrafficChecks run against the new reader version before any traffic shifts to it.  They only read, and do not depend
+// on the Notes in the table.
+func preTrafficChecks(api LambdaInvokeAPI, env hookEnv) []check {
+	reader := env.currentVersion
+	return []check{
+		proxyCheck("list notes", api, reader, events.APIGatewayProxyRequest{
+			Resource:              "/notes",
+			Path:                  "/notes",
+			HTTPMethod:            http.MethodGet,
+			QueryStringParameters: map[string]string{"limit": "1"},
+		}, expectNotesPage),
+		proxyCheck("list notes for an unknown owner", api, reader, events.APIGatewayProxyRequest{
+			Resource:       "/notes/{owner}",
+			Path:           "/notes/deploy-hook-smoke-test",
+			HTTPMethod:     http.MethodGet,
+			PathParameters: map[string]string{"owner": "deploy-hook-smoke-test"},
+		}, expectNotesPage),
+		proxyCheck("get an unknown note", api, reader, events.APIGatewayProxyRequest{
+			Resource:       "/notes/{owner}/{title}",
+			Path:           "/notes/deploy-hook-smoke-test/missing",
+			HTTPMethod:     http.MethodGet,
+			PathParameters: map[string]string{"owner": "deploy-hook-smoke-test", "title": "missing"},
+		}, expectProblem(http.StatusNotFound)),
+		proxyCheck("reject an invalid limit", api, reader, events.APIGatewayProxyRequest{
+			Resource:              "/notes",
+			Path:                  "/notes",
+			HTTPMethod:            http.MethodGet,
+			QueryStringParameters: map[string]string{"limit": "0"},
+		}, expectProblem(http.StatusBadRequest)),
+		proxyCheck("reject a forged cursor", api, reader, events.APIGatewayProxyRequest{
+			Resource:              "/notes",
+			Path:                  "/notes",
+			HTTPMethod:            http.MethodGet,
+			QueryStringParameters: map[string]string{"cursor": "e30.Zm9yZ2Vk"},
+		}, expectProblem(http.StatusBadRequest)),
+	}
+}
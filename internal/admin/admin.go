@@ -0,0 +1,145 @@
+// Package admin handles the API Gateway requests that export and import every Note in the table at once.
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/akijowski/tweek-2021-sam/internal/archive"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	// exportResource is the API Gateway resource that downloads an archive of every Note
+	exportResource = "/admin/notes:export"
+	// importResource is the API Gateway resource that uploads an archive of Notes
+	importResource = "/admin/notes:import"
+)
+
+// API is the set of DynamoDB Client functions needed by the admin handler
+type API interface {
+	ddb.DynamoScanAPI
+	archive.DynamoImportAPI
+}
+
+// Handler exports and imports the Notes in a DynamoDB table.
+//
+// Archives are built and read in memory, so an export is limited by the 6MB Lambda response payload and larger tables
+// should be exported with notesctl instead.
+type Handler struct {
+	API       API
+	TableName string
+	// Authenticator identifies the caller, who must hold auth.AdminScope.  When nil every request is allowed.
+	Authenticator auth.Authenticator
+}
+
+// Handle is the API Gateway proxy handler for the admin function
+func (h *Handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	requestID := apigw.RequestID(ctx, request)
+	log.Printf("request %s: %s %s", requestID, request.HTTPMethod, request.Path)
+
+	principal, err := auth.Authenticate(ctx, h.Authenticator, request)
+	if err == nil {
+		err = principal.RequireAdmin()
+	}
+	if err != nil {
+		return apigw.ErrorResponse(err, requestID, request.Path), nil
+	}
+
+	var response events.APIGatewayProxyResponse
+	switch {
+	case request.HTTPMethod == http.MethodGet && request.Resource == exportResource:
+		response, err = h.handleExport(ctx, request)
+	case request.HTTPMethod == http.MethodPost && request.Resource == importResource:
+		response, err = h.handleImport(ctx, request)
+	default:
+		err = &apigw.RequestError{StatusCode: http.StatusMethodNotAllowed, Detail: fmt.Sprintf("method %q is not supported", request.HTTPMethod)}
+	}
+	if err != nil {
+		log.Printf("error handling request: %s", err)
+		return apigw.ErrorResponse(err, requestID, request.Path), nil
+	}
+	return response, nil
+}
+
+func (h *Handler) handleExport(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	format, err := parseFormat(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	var buf bytes.Buffer
+	if _, err = archive.Export(ctx, h.API, h.TableName, format, &buf); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	response := events.APIGatewayProxyResponse{
+		Headers: map[string]string{
+			"Content-Type":        format.ContentType(),
+			"Content-Disposition": fmt.Sprintf("attachment; filename=\"notes%s\"", format.Extension()),
+		},
+		StatusCode: http.StatusOK,
+		Body:       buf.String(),
+	}
+	if format.Binary() {
+		response.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+		response.IsBase64Encoded = true
+	}
+	return response, nil
+}
+
+func (h *Handler) handleImport(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	format, err := parseFormat(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	policy := archive.ConflictSkip
+	if conflict, ok := request.QueryStringParameters["conflict"]; ok {
+		if policy, err = archive.ParseConflictPolicy(conflict); err != nil {
+			return events.APIGatewayProxyResponse{}, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: err.Error()}
+		}
+	}
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		if body, err = base64.StdEncoding.DecodeString(request.Body); err != nil {
+			return events.APIGatewayProxyResponse{}, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "request body is not valid base64"}
+		}
+	}
+
+	result, err := archive.Import(ctx, h.API, h.TableName, format, bytes.NewReader(body), policy)
+	var derr *archive.DecodeError
+	if errors.As(err, &derr) {
+		detail := fmt.Sprintf("the archive cannot be read at %s, the %d notes before it were imported", derr.Error(), len(result.Results))
+		return events.APIGatewayProxyResponse{}, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: detail}
+	} else if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	responseBody, err := json.Marshal(result)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       string(responseBody),
+	}, nil
+}
+
+// parseFormat returns the archive.Format named by the format query parameter, JSON Lines when it is missing
+func parseFormat(request events.APIGatewayProxyRequest) (archive.Format, error) {
+	name, ok := request.QueryStringParameters["format"]
+	if !ok {
+		return archive.JSONLines, nil
+	}
+	format, err := archive.ParseFormat(strings.ToLower(name))
+	if err != nil {
+		return "", &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: err.Error()}
+	}
+	return format, nil
+}
@@ -0,0 +1,202 @@
+package admin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/akijowski/tweek-2021-sam/internal/archive"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testTableName = "notes"
+
+func TestHandler_Handle(t *testing.T) {
+	cases := map[string]struct {
+		request            events.APIGatewayProxyRequest
+		expectedStatusCode int
+		expectedHeaders    map[string]string
+		checkBody          func(t *testing.T, body string)
+	}{
+		"export defaults to json lines": {
+			request:            events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: exportResource},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"Content-Type": "application/x-ndjson", "Content-Disposition": `attachment; filename="notes.jsonl"`},
+			checkBody: func(t *testing.T, body string) {
+				if !strings.Contains(body, `"title":"existing"`) {
+					t.Errorf("expected the existing note in %q", body)
+				}
+			},
+		},
+		"export csv": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:            http.MethodGet,
+				Resource:              exportResource,
+				QueryStringParameters: map[string]string{"format": "csv"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"Content-Type": "text/csv"},
+			checkBody: func(t *testing.T, body string) {
+				if !strings.HasPrefix(body, "owner,title,message,version,created_at,updated_at\ntest-owner,existing,") {
+					t.Errorf("unexpected csv %q", body)
+				}
+			},
+		},
+		"export markdown is base64 encoded": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:            http.MethodGet,
+				Resource:              exportResource,
+				QueryStringParameters: map[string]string{"format": "markdown"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"Content-Type": "application/x-tar", "Content-Disposition": `attachment; filename="notes.tar"`},
+		},
+		"export unknown format": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:            http.MethodGet,
+				Resource:              exportResource,
+				QueryStringParameters: map[string]string{"format": "xml"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"import with the rename policy": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:            http.MethodPost,
+				Resource:              importResource,
+				QueryStringParameters: map[string]string{"conflict": "rename"},
+				Body:                  "{\"owner\":\"test-owner\",\"title\":\"existing\",\"message\":\"other\"}\n",
+			},
+			expectedStatusCode: http.StatusOK,
+			checkBody: func(t *testing.T, body string) {
+				var response schema.ImportResponse
+				if err := json.Unmarshal([]byte(body), &response); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if len(response.Results) != 1 || response.Results[0].Status != schema.ImportRenamed || response.Results[0].NewTitle != "existing (2)" {
+					t.Errorf("unexpected import response %+v", response)
+				}
+			},
+		},
+		"import base64 encoded csv": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:            http.MethodPost,
+				Resource:              importResource,
+				QueryStringParameters: map[string]string{"format": "csv"},
+				Body:                  base64.StdEncoding.EncodeToString([]byte("owner,title,message\ntest-owner,new,m\n")),
+				IsBase64Encoded:       true,
+			},
+			expectedStatusCode: http.StatusOK,
+			checkBody: func(t *testing.T, body string) {
+				if !strings.Contains(body, `"counts":{"created":1}`) {
+					t.Errorf("expected a created note in %q", body)
+				}
+			},
+		},
+		"import unknown conflict policy": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:            http.MethodPost,
+				Resource:              importResource,
+				QueryStringParameters: map[string]string{"conflict": "merge"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"import unreadable archive": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Resource:   importResource,
+				Body:       "not json\n",
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			checkBody: func(t *testing.T, body string) {
+				if !strings.Contains(body, "cannot be read at line 1") {
+					t.Errorf("expected the unreadable line in %q", body)
+				}
+			},
+		},
+		"unsupported method": {
+			request:            events.APIGatewayProxyRequest{HTTPMethod: http.MethodDelete, Resource: exportResource},
+			expectedStatusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			api := ddbfake.NewNotesTable(testTableName)
+			existing := &schema.Note{Owner: "test-owner", Title: "existing", Message: "test-message"}
+			if _, err := ddb.CreateNote(context.Background(), api, testTableName, existing); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			h := &Handler{API: api, TableName: testTableName}
+
+			response, err := h.Handle(context.Background(), tt.request)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Errorf("expected status code %d but got %d: %s", tt.expectedStatusCode, response.StatusCode, response.Body)
+			}
+			for k, v := range tt.expectedHeaders {
+				if response.Headers[k] != v {
+					t.Errorf("expected header %s %q but got %q", k, v, response.Headers[k])
+				}
+			}
+			if tt.checkBody != nil {
+				tt.checkBody(t, response.Body)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleRequiresAdmin(t *testing.T) {
+	authenticator := auth.AuthenticatorFunc(func(context.Context, events.APIGatewayProxyRequest) (*auth.Principal, error) {
+		return &auth.Principal{Owner: "test-owner", Scopes: []string{"notes:read"}}, nil
+	})
+	h := &Handler{API: ddbfake.NewNotesTable(testTableName), TableName: testTableName, Authenticator: authenticator}
+
+	response, err := h.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Resource: exportResource})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status code %d but got %d: %s", http.StatusForbidden, response.StatusCode, response.Body)
+	}
+}
+
+func TestHandler_ExportMarkdown(t *testing.T) {
+	api := ddbfake.NewNotesTable(testTableName)
+	note := &schema.Note{Owner: "test-owner", Title: "existing", Message: "test-message"}
+	if _, err := ddb.CreateNote(context.Background(), api, testTableName, note); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	h := &Handler{API: api, TableName: testTableName}
+
+	response, _ := h.Handle(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:            http.MethodGet,
+		Resource:              exportResource,
+		QueryStringParameters: map[string]string{"format": "markdown"},
+	})
+
+	if !response.IsBase64Encoded {
+		t.Fatal("expected a base64 encoded body")
+	}
+	tarball, err := base64.StdEncoding.DecodeString(response.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	decoder, _ := archive.NewDecoder(archive.Markdown, strings.NewReader(string(tarball)))
+	decoded, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decoded.Owner != note.Owner || decoded.Title != note.Title || decoded.Message != note.Message {
+		t.Errorf("expected %+v but got %+v", note, decoded)
+	}
+}
@@ -0,0 +1,115 @@
+// Package apigw contains helpers shared by the functions that sit behind the API Gateway proxy integration.
+package apigw
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"strconv"
+	"strings"
+)
+
+// Header returns the first value of the named request header.
+//
+// API Gateway passes headers through with the casing used by the client, so the name is matched case-insensitively.
+func Header(request events.APIGatewayProxyRequest, name string) string {
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	for k, v := range request.MultiValueHeaders {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// RequestID returns the AWS request ID of the invocation, falling back to the API Gateway request ID when the handler is
+// not running inside AWS Lambda.
+func RequestID(ctx context.Context, request events.APIGatewayProxyRequest) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return request.RequestContext.RequestID
+}
+
+// Negotiate returns the offered media type the Accept header of the request prefers, and false when it accepts none of
+// them.
+//
+// Each offer takes the quality of the most specific media range that matches it, so "text/*;q=0.5, text/csv" prefers
+// text/csv over text/markdown.  Offers of equal quality are chosen in the order given, and a request without an Accept
+// header gets the first offer.
+func Negotiate(request events.APIGatewayProxyRequest, offers ...string) (string, bool) {
+	accept := Header(request, "Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+	ranges := parseAccept(accept)
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, specificity := 0.0, -1
+		for _, r := range ranges {
+			if s := r.matches(offer); s > specificity {
+				quality, specificity = r.quality, s
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// mediaRange is a single entry of an Accept header
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// matches returns how specifically the range matches the media type: 2 for the same type, 1 for type/*, 0 for */* and
+// -1 when it does not match
+func (r mediaRange) matches(mediaType string) int {
+	switch {
+	case r.mediaType == mediaType:
+		return 2
+	case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*")):
+		return 1
+	case r.mediaType == "*/*":
+		return 0
+	default:
+		return -1
+	}
+}
+
+// parseAccept splits an Accept header in to its media ranges, ignoring any parameters other than the quality
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := mediaRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), quality: 1}
+		if r.mediaType == "" {
+			continue
+		}
+		for _, param := range params[1:] {
+			name, value, ok := cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(name, "q") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(value, 64); err == nil && q >= 0 && q <= 1 {
+				r.quality = q
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// cut is strings.Cut, which is not available in Go 1.17
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
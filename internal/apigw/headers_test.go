@@ -0,0 +1,45 @@
+package apigw
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "text/csv", "text/markdown"}
+	cases := map[string]struct {
+		accept        string
+		expectedType  string
+		notAcceptable bool
+	}{
+		"no accept header":             {expectedType: "application/json"},
+		"exact type":                   {accept: "text/csv", expectedType: "text/csv"},
+		"case and whitespace":          {accept: " Text/Markdown ; charset=utf-8", expectedType: "text/markdown"},
+		"wildcard":                     {accept: "*/*", expectedType: "application/json"},
+		"type wildcard":                {accept: "text/*", expectedType: "text/csv"},
+		"quality":                      {accept: "text/csv;q=0.5, text/markdown", expectedType: "text/markdown"},
+		"more specific range wins":     {accept: "text/*;q=0.5, text/markdown;q=0.1", expectedType: "text/csv"},
+		"browser accept header":        {accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expectedType: "application/json"},
+		"unsupported type":             {accept: "application/xml", notAcceptable: true},
+		"zero quality":                 {accept: "text/csv;q=0", notAcceptable: true},
+		"wildcard excluding the offer": {accept: "*/*, application/json;q=0", expectedType: "text/csv"},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{Headers: map[string]string{}}
+			if tt.accept != "" {
+				request.Headers["accept"] = tt.accept
+			}
+
+			mediaType, ok := Negotiate(request, offers...)
+
+			if ok == tt.notAcceptable {
+				t.Fatalf("expected acceptable %t but got %t with %q", !tt.notAcceptable, ok, mediaType)
+			}
+			if mediaType != tt.expectedType {
+				t.Errorf("expected %q but got %q", tt.expectedType, mediaType)
+			}
+		})
+	}
+}
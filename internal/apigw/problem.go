@@ -0,0 +1,167 @@
+package apigw
+
+import (
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+	"net/http"
+)
+
+// problemTypeBase is where each problem type is documented
+const problemTypeBase = "https://github.com/akijowski/tweek-2021-sam/blob/main/docs/problems.md#"
+
+// RequestError is returned by a handler when the request cannot be processed as sent.  The Detail is returned to the caller.
+type RequestError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *RequestError) Error() string { return e.Detail }
+
+// problemMapping describes the problem returned for every error that matches
+type problemMapping struct {
+	matches func(err error) bool
+	status  int
+	// slug is appended to problemTypeBase, an empty slug uses about:blank
+	slug  string
+	title string
+	// detail returns the detail safe to show to the caller, when nil the error message is not returned
+	detail func(err error) string
+}
+
+// problemMappings is checked in order, the first match wins.  Errors that do not match any entry are returned as a 500
+// without exposing the error message.
+var problemMappings = []problemMapping{
+	{
+		matches: func(err error) bool { var e *RequestError; return errors.As(err, &e) },
+		detail:  errorMessage,
+	},
+	{
+		matches: func(err error) bool { var e *schema.ValidationError; return errors.As(err, &e) },
+		status:  http.StatusBadRequest,
+		slug:    "validation-error",
+		title:   "Invalid Request",
+		detail:  func(error) string { return "one or more fields are not valid" },
+	},
+	{
+		matches: func(err error) bool { return errors.Is(err, ddb.ErrInvalidCursor) },
+		status:  http.StatusBadRequest,
+		slug:    "invalid-cursor",
+		title:   "Invalid Cursor",
+		detail:  func(error) string { return "the cursor was not issued by this API" },
+	},
+	{
+		matches: func(err error) bool { var e *ddb.NoteNotFoundError; return errors.As(err, &e) },
+		status:  http.StatusNotFound,
+		slug:    "note-not-found",
+		title:   "Note Not Found",
+		detail:  errorMessage,
+	},
+	{
+		matches: func(err error) bool { var e *ddb.NoteExistsError; return errors.As(err, &e) },
+		status:  http.StatusConflict,
+		slug:    "note-exists",
+		title:   "Note Already Exists",
+		detail:  errorMessage,
+	},
+	{
+		matches: func(err error) bool { var e *ddb.PreconditionFailedError; return errors.As(err, &e) },
+		status:  http.StatusPreconditionFailed,
+		slug:    "version-mismatch",
+		title:   "Version Mismatch",
+		detail:  errorMessage,
+	},
+	{
+		matches: func(err error) bool { var e *ddb.TransactionCanceledError; return errors.As(err, &e) },
+		status:  http.StatusConflict,
+		slug:    "transaction-canceled",
+		title:   "Transaction Canceled",
+		detail:  func(error) string { return "the request conflicted with another write, it can be sent again" },
+	},
+	{
+		matches: func(err error) bool { var e *ddb.DynamoDBError; return errors.As(err, &e) },
+		status:  http.StatusBadGateway,
+		slug:    "dynamodb-error",
+		title:   "Database Error",
+		detail:  errorMessage,
+	},
+}
+
+// NewProblem builds the schema.Problem for err using the problemMappings table.
+//
+// The instance is the path of the request that failed.
+func NewProblem(err error, requestID, instance string) *schema.Problem {
+	problem := &schema.Problem{
+		Type:         "about:blank",
+		Title:        http.StatusText(http.StatusInternalServerError),
+		Status:       http.StatusInternalServerError,
+		Detail:       "an unexpected error occurred",
+		Instance:     instance,
+		AwsRequestID: requestID,
+	}
+	for _, m := range problemMappings {
+		if !m.matches(err) {
+			continue
+		}
+		problem.Status = m.status
+		var rerr *RequestError
+		if errors.As(err, &rerr) {
+			problem.Status = rerr.StatusCode
+		}
+		problem.Title = m.title
+		if m.title == "" {
+			problem.Title = http.StatusText(problem.Status)
+		}
+		if m.slug != "" {
+			problem.Type = problemTypeBase + m.slug
+		}
+		problem.Detail = ""
+		if m.detail != nil {
+			problem.Detail = m.detail(err)
+		}
+		break
+	}
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		problem.Errors = verr.Fields
+	}
+	var tce *ddb.TransactionCanceledError
+	if errors.As(err, &tce) {
+		for _, r := range tce.Reasons {
+			problem.CancellationReasons = append(problem.CancellationReasons, schema.CancellationReason{Action: r.Action, Code: r.Code, Message: r.Message})
+		}
+	}
+	var derr *ddb.DynamoDBError
+	if errors.As(err, &derr) {
+		log.Printf("client error: %s", derr.ClientMessage)
+	}
+	if problem.Status >= http.StatusInternalServerError {
+		log.Printf("error handling request %s: %s", requestID, err)
+	}
+	return problem
+}
+
+// ErrorResponse returns the application/problem+json response for err
+func ErrorResponse(err error, requestID, instance string) events.APIGatewayProxyResponse {
+	return ProblemResponse(NewProblem(err, requestID, instance))
+}
+
+// ProblemResponse returns the application/problem+json response for the problem.  A 401 response asks for a bearer
+// token with the WWW-Authenticate header.
+func ProblemResponse(problem *schema.Problem) events.APIGatewayProxyResponse {
+	headers := map[string]string{
+		"Content-Type": schema.ProblemContentType,
+	}
+	if problem.Status == http.StatusUnauthorized {
+		headers["WWW-Authenticate"] = "Bearer"
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: problem.Status,
+		Headers:    headers,
+		Body:       problem.String(),
+	}
+}
+
+func errorMessage(err error) string { return err.Error() }
@@ -0,0 +1,130 @@
+package apigw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	cases := map[string]struct {
+		err             error
+		expectedProblem schema.Problem
+	}{
+		"request error uses its status": {
+			err: &RequestError{StatusCode: http.StatusPreconditionRequired, Detail: "the If-Match header is required"},
+			expectedProblem: schema.Problem{
+				Type:   "about:blank",
+				Title:  "Precondition Required",
+				Status: http.StatusPreconditionRequired,
+				Detail: "the If-Match header is required",
+			},
+		},
+		"validation error lists fields": {
+			err: &schema.ValidationError{Fields: []schema.FieldError{{Field: "owner", Message: "is required"}}},
+			expectedProblem: schema.Problem{
+				Type:   problemTypeBase + "validation-error",
+				Title:  "Invalid Request",
+				Status: http.StatusBadRequest,
+				Detail: "one or more fields are not valid",
+				Errors: []schema.FieldError{{Field: "owner", Message: "is required"}},
+			},
+		},
+		"invalid cursor returns bad request": {
+			err: fmt.Errorf("%w: bad key", ddb.ErrInvalidCursor),
+			expectedProblem: schema.Problem{
+				Type:   problemTypeBase + "invalid-cursor",
+				Title:  "Invalid Cursor",
+				Status: http.StatusBadRequest,
+				Detail: "the cursor was not issued by this API",
+			},
+		},
+		"missing note returns not found": {
+			err: &ddb.NoteNotFoundError{Owner: "owner", Title: "title"},
+			expectedProblem: schema.Problem{
+				Type:   problemTypeBase + "note-not-found",
+				Title:  "Note Not Found",
+				Status: http.StatusNotFound,
+				Detail: `note "title" not found for owner "owner"`,
+			},
+		},
+		"existing note returns conflict": {
+			err: &ddb.NoteExistsError{Owner: "owner", Title: "title"},
+			expectedProblem: schema.Problem{
+				Type:   problemTypeBase + "note-exists",
+				Title:  "Note Already Exists",
+				Status: http.StatusConflict,
+				Detail: `note "title" already exists for owner "owner"`,
+			},
+		},
+		"version mismatch returns precondition failed": {
+			err: &ddb.PreconditionFailedError{Owner: "owner", Title: "title"},
+			expectedProblem: schema.Problem{
+				Type:   problemTypeBase + "version-mismatch",
+				Title:  "Version Mismatch",
+				Status: http.StatusPreconditionFailed,
+				Detail: `note "title" for owner "owner" does not match the expected version`,
+			},
+		},
+		"canceled transaction lists reasons": {
+			err: &ddb.TransactionCanceledError{Reasons: []ddb.CancellationReason{
+				{Action: ddb.SourceAction, Code: "None"},
+				{Action: ddb.TargetAction, Code: "TransactionConflict", Message: "Transaction is ongoing for the item"},
+			}},
+			expectedProblem: schema.Problem{
+				Type:   problemTypeBase + "transaction-canceled",
+				Title:  "Transaction Canceled",
+				Status: http.StatusConflict,
+				Detail: "the request conflicted with another write, it can be sent again",
+				CancellationReasons: []schema.CancellationReason{
+					{Action: "source", Code: "None"},
+					{Action: "target", Code: "TransactionConflict", Message: "Transaction is ongoing for the item"},
+				},
+			},
+		},
+		"dynamo error hides client message": {
+			err: &ddb.DynamoDBError{ClientMessage: "secret table details"},
+			expectedProblem: schema.Problem{
+				Type:   problemTypeBase + "dynamodb-error",
+				Title:  "Database Error",
+				Status: http.StatusBadGateway,
+				Detail: "a DynamoDB error occurred",
+			},
+		},
+		"unknown error hides message": {
+			err: errors.New("json: cannot unmarshal number into Go value"),
+			expectedProblem: schema.Problem{
+				Type:   "about:blank",
+				Title:  "Internal Server Error",
+				Status: http.StatusInternalServerError,
+				Detail: "an unexpected error occurred",
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			response := ErrorResponse(tt.err, "request-id", "/notes/owner")
+			if response.StatusCode != tt.expectedProblem.Status {
+				t.Fatalf("unexpected status: wanted %d got %d", tt.expectedProblem.Status, response.StatusCode)
+			}
+			if response.Headers["Content-Type"] != schema.ProblemContentType {
+				t.Fatalf("unexpected content type: %q", response.Headers["Content-Type"])
+			}
+			var actual schema.Problem
+			if err := json.Unmarshal([]byte(response.Body), &actual); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			tt.expectedProblem.Instance = "/notes/owner"
+			tt.expectedProblem.AwsRequestID = "request-id"
+			if !reflect.DeepEqual(actual, tt.expectedProblem) {
+				t.Fatalf("unexpected problem: wanted %+v got %+v", tt.expectedProblem, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package archive exports every Note in a table to a file and imports Notes from one, for offline backups and
+// migrations between tables.
+//
+// Three formats are supported: JSON Lines of the NoteResponse wire model, CSV, and a tar of Markdown files with YAML
+// front matter, one per Note.  Every format keeps the owner, title, message, created_at and updated_at of a Note, so an
+// exported table can be imported again without losing anything the API returns apart from the version.
+package archive
+
+import (
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io"
+	"strings"
+)
+
+// Format is the file format of an archive
+type Format string
+
+const (
+	// JSONLines is a NoteResponse per line
+	JSONLines Format = "jsonl"
+	// CSV is a header row followed by a row per Note
+	CSV Format = "csv"
+	// Markdown is a tar of a Markdown file per Note, with the other fields in YAML front matter
+	Markdown Format = "markdown"
+)
+
+// Formats lists every supported Format
+var Formats = []Format{JSONLines, CSV, Markdown}
+
+// ParseFormat returns the Format with the given name
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, must be one of %s", name, formatNames())
+}
+
+// ContentType is the media type of an archive in the Format
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv"
+	case Markdown:
+		return "application/x-tar"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// Extension is the file name extension of an archive in the Format
+func (f Format) Extension() string {
+	switch f {
+	case CSV:
+		return ".csv"
+	case Markdown:
+		return ".tar"
+	default:
+		return ".jsonl"
+	}
+}
+
+// Binary reports whether an archive in the Format is not text
+func (f Format) Binary() bool {
+	return f == Markdown
+}
+
+// Encoder writes Notes to an archive.  Close must be called once every Note is written to complete the archive, it does
+// not close the underlying io.Writer.
+type Encoder interface {
+	Encode(note *schema.Note) error
+	Close() error
+}
+
+// Decoder reads Notes from an archive, returning io.EOF after the last one
+type Decoder interface {
+	Decode() (*schema.Note, error)
+}
+
+// NewEncoder returns an Encoder writing an archive in the Format to w
+func NewEncoder(f Format, w io.Writer) (Encoder, error) {
+	switch f {
+	case JSONLines:
+		return newJSONLinesEncoder(w), nil
+	case CSV:
+		return newCSVEncoder(w), nil
+	case Markdown:
+		return newMarkdownEncoder(w), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", f)
+	}
+}
+
+// NewDecoder returns a Decoder reading an archive in the Format from r
+func NewDecoder(f Format, r io.Reader) (Decoder, error) {
+	switch f {
+	case JSONLines:
+		return newJSONLinesDecoder(r), nil
+	case CSV:
+		return newCSVDecoder(r), nil
+	case Markdown:
+		return newMarkdownDecoder(r), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", f)
+	}
+}
+
+// DecodeError is returned by a Decoder when an entry of the archive cannot be read, e.g. a line that is not valid JSON
+type DecodeError struct {
+	// Entry is the line, row or file name of the entry
+	Entry string
+	err   error
+}
+
+func (e *DecodeError) Error() string { return fmt.Sprintf("%s: %s", e.Entry, e.err) }
+
+func (e *DecodeError) Unwrap() error { return e.err }
+
+func formatNames() string {
+	names := make([]string, 0, len(Formats))
+	for _, f := range Formats {
+		names = append(names, string(f))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,187 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var archivedNotes = []schema.Note{
+	{Owner: "adam", Title: "groceries", Message: "eggs, milk\n\"bread\"", Version: 3, Timestamp: 1639999997123, CreatedAt: 1638999997000, UpdatedAt: 1639999997123},
+	{Owner: "adam", Title: "a/b c?", Message: "---\nnot front matter\n", Version: 1, Timestamp: 1639999998000, UpdatedAt: 1639999998000},
+	{Owner: "sam/ops", Title: "todo", Message: "- [ ] ship it", Version: 2, Timestamp: 1639999999000, CreatedAt: 1639999990000, UpdatedAt: 1639999999000},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, err := NewEncoder(format, &buf)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for i := range archivedNotes {
+				if err = encoder.Encode(&archivedNotes[i]); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			if err = encoder.Close(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			decoded := decodeAll(t, format, &buf)
+			if !reflect.DeepEqual(decoded, archivedNotes) {
+				t.Errorf("expected %+v but got %+v", archivedNotes, decoded)
+			}
+		})
+	}
+}
+
+func TestRoundTrip_Empty(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, _ := NewEncoder(format, &buf)
+			if err := encoder.Close(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if decoded := decodeAll(t, format, &buf); len(decoded) != 0 {
+				t.Errorf("expected no notes but got %+v", decoded)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	cases := map[string]struct {
+		format        Format
+		archive       []byte
+		expectedNotes []schema.Note
+		expectedError string
+	}{
+		"jsonl skips blank lines": {
+			format:        JSONLines,
+			archive:       []byte("{\"owner\":\"a\",\"title\":\"1\",\"message\":\"m\"}\n\n"),
+			expectedNotes: []schema.Note{{Owner: "a", Title: "1", Message: "m"}},
+		},
+		"jsonl invalid line": {
+			format:        JSONLines,
+			archive:       []byte("\n{\"owner\":"),
+			expectedError: "line 2: unexpected end of JSON input",
+		},
+		"csv reordered columns": {
+			format:        CSV,
+			archive:       []byte("title,owner,message\n1,a,m\n"),
+			expectedNotes: []schema.Note{{Owner: "a", Title: "1", Message: "m"}},
+		},
+		"csv missing column": {
+			format:        CSV,
+			archive:       []byte("owner,title\na,1\n"),
+			expectedError: "header: missing the message column",
+		},
+		"csv invalid time": {
+			format:        CSV,
+			archive:       []byte("owner,title,message,updated_at\na,1,m,yesterday\n"),
+			expectedError: `row 1: updated_at "yesterday" is not an RFC 3339 time`,
+		},
+		"markdown skips other files": {
+			format: Markdown,
+			archive: tarOf(t, map[string]string{
+				"README.txt": "ignored",
+				"a/1.md":     "---\nowner: a\ntitle: \"1\"\n---\nm\n",
+			}),
+			expectedNotes: []schema.Note{{Owner: "a", Title: "1", Message: "m"}},
+		},
+		"markdown missing front matter": {
+			format:        Markdown,
+			archive:       tarOf(t, map[string]string{"a/1.md": "m\n"}),
+			expectedError: "a/1.md: missing front matter",
+		},
+		"markdown unclosed front matter": {
+			format:        Markdown,
+			archive:       tarOf(t, map[string]string{"a/1.md": "---\nowner: a\n"}),
+			expectedError: "a/1.md: front matter is not closed",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			decoder, _ := NewDecoder(tt.format, bytes.NewReader(tt.archive))
+			var notes []schema.Note
+			var err error
+			for {
+				var note *schema.Note
+				if note, err = decoder.Decode(); err != nil {
+					break
+				}
+				notes = append(notes, *note)
+			}
+
+			if tt.expectedError != "" {
+				var de *DecodeError
+				if !errors.As(err, &de) || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q but got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != io.EOF {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(notes, tt.expectedNotes) {
+				t.Errorf("expected %+v but got %+v", tt.expectedNotes, notes)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range Formats {
+		if f, err := ParseFormat(string(format)); err != nil || f != format {
+			t.Errorf("expected %q but got %q, %v", format, f, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil || !strings.Contains(err.Error(), "jsonl, csv, markdown") {
+		t.Errorf("expected an unknown format error but got %v", err)
+	}
+}
+
+func decodeAll(t *testing.T, format Format, r io.Reader) []schema.Note {
+	t.Helper()
+	decoder, err := NewDecoder(format, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var notes []schema.Note
+	for {
+		note, err := decoder.Decode()
+		if err == io.EOF {
+			return notes
+		} else if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		notes = append(notes, *note)
+	}
+}
+
+func tarOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := w.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader is the first row of a CSV archive.  The decoder matches columns by name, so the columns of an edited file
+// can be reordered, and only owner, title and message are required.
+var csvHeader = []string{"owner", "title", "message", "version", "created_at", "updated_at"}
+
+type csvEncoder struct {
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{writer: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Encode(note *schema.Note) error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	response := schema.NewNoteResponse(note)
+	var createdAt string
+	if response.CreatedAt != nil {
+		createdAt = response.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return e.writer.Write([]string{
+		response.Owner,
+		response.Title,
+		response.Message,
+		strconv.FormatInt(response.Version, 10),
+		createdAt,
+		response.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+// Close writes the header of an empty archive and flushes the buffered rows
+func (e *csvEncoder) Close() error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type csvDecoder struct {
+	reader  *csv.Reader
+	columns map[string]int
+	row     int
+}
+
+func newCSVDecoder(r io.Reader) *csvDecoder {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	return &csvDecoder{reader: reader}
+}
+
+func (d *csvDecoder) Decode() (*schema.Note, error) {
+	if d.columns == nil {
+		if err := d.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+	record, err := d.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	d.row++
+	entry := fmt.Sprintf("row %d", d.row)
+	if err != nil {
+		return nil, &DecodeError{Entry: entry, err: err}
+	}
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	note := &schema.Note{Owner: field("owner"), Title: field("title"), Message: field("message")}
+	if version := field("version"); version != "" {
+		if note.Version, err = strconv.ParseInt(version, 10, 64); err != nil {
+			return nil, &DecodeError{Entry: entry, err: fmt.Errorf("version %q is not a number", version)}
+		}
+	}
+	if note.CreatedAt, err = parseTime(field("created_at")); err != nil {
+		return nil, &DecodeError{Entry: entry, err: fmt.Errorf("created_at %w", err)}
+	}
+	if note.UpdatedAt, err = parseTime(field("updated_at")); err != nil {
+		return nil, &DecodeError{Entry: entry, err: fmt.Errorf("updated_at %w", err)}
+	}
+	note.Timestamp = note.UpdatedAt
+	return note, nil
+}
+
+func (d *csvDecoder) readHeader() error {
+	header, err := d.reader.Read()
+	if err == io.EOF {
+		return io.EOF
+	} else if err != nil {
+		return &DecodeError{Entry: "header", err: err}
+	}
+	d.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		d.columns[name] = i
+	}
+	for _, required := range csvHeader[:3] {
+		if _, ok := d.columns[required]; !ok {
+			return &DecodeError{Entry: "header", err: fmt.Errorf("missing the %s column", required)}
+		}
+	}
+	return nil
+}
+
+// parseTime returns an RFC 3339 time in epoch millis, or zero for an empty value
+func parseTime(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an RFC 3339 time", value)
+	}
+	return t.UnixMilli(), nil
+}
@@ -0,0 +1,50 @@
+package archive
+
+import (
+	"context"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io"
+	"log"
+)
+
+// Export writes every Note in the table to w as an archive in the Format, returning the number of Notes written.
+//
+// The table is read with a parallel ddb.ScanAll and each Note is encoded as it arrives, so the table is never held in
+// memory and the order of the Notes in the archive is not defined.  The scan is stopped when w fails.
+func Export(ctx context.Context, api ddb.DynamoScanAPI, tableName string, format Format, w io.Writer) (int, error) {
+	encoder, err := NewEncoder(format, w)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	notes := make(chan schema.Note)
+	scanErr := make(chan error, 1)
+	go func() {
+		_, err := ddb.ScanAll(ctx, api, tableName, ddb.ScanAllRequest{}, notes)
+		scanErr <- err
+	}()
+
+	count := 0
+	var encodeErr error
+	for note := range notes {
+		if encodeErr != nil {
+			continue
+		}
+		note := note
+		if encodeErr = encoder.Encode(&note); encodeErr != nil {
+			cancel()
+		} else {
+			count++
+		}
+	}
+	if encodeErr != nil {
+		return count, encodeErr
+	}
+	if err = <-scanErr; err != nil {
+		return count, err
+	}
+	log.Printf("exported %d notes from %s as %s\n", count, tableName, format)
+	return count, encoder.Close()
+}
@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io"
+	"log"
+)
+
+// maxRenameAttempts is the highest suffix tried for the new title of a renamed Note, "title (2)" to "title (100)"
+const maxRenameAttempts = 100
+
+// ConflictPolicy decides what happens to an imported Note when a Note with a different message already has its owner
+// and title.  A Note with the same message is always left unchanged, so importing an archive twice writes nothing the
+// second time.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the existing Note
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the message of the existing Note
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename writes the imported Note under the first free title of "title (2)", "title (3)" and so on
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ConflictPolicies lists every supported ConflictPolicy
+var ConflictPolicies = []ConflictPolicy{ConflictSkip, ConflictOverwrite, ConflictRename}
+
+// ParseConflictPolicy returns the ConflictPolicy with the given name
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	for _, p := range ConflictPolicies {
+		if string(p) == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, must be one of skip, overwrite, rename", name)
+}
+
+// DynamoImportAPI is the subset of the AWS DynamoDB Client used by Import
+type DynamoImportAPI interface {
+	ddb.DynamoGetItemAPI
+	ddb.DynamoPutItemAPI
+	ddb.DynamoUpdateItemAPI
+}
+
+// Import writes every Note of an archive in the Format read from r to the table, resolving conflicts with the
+// ConflictPolicy.  New Notes keep the created_at and updated_at recorded in the archive, see ddb.RestoreNote.
+//
+// Each Note is validated and written on its own, so an invalid Note or a failed write is reported in its
+// schema.ImportResult rather than stopping the import.  An archive that cannot be read stops the import, returning the
+// results so far with the error.
+func Import(ctx context.Context, api DynamoImportAPI, tableName string, format Format, r io.Reader, policy ConflictPolicy) (*schema.ImportResponse, error) {
+	decoder, err := NewDecoder(format, r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = ParseConflictPolicy(string(policy)); err != nil {
+		return nil, err
+	}
+	response := &schema.ImportResponse{Counts: make(map[schema.ImportStatus]int), Results: []schema.ImportResult{}}
+	for i := 0; ; i++ {
+		note, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return response, err
+		}
+		result := schema.ImportResult{Index: i, Owner: note.Owner, Title: note.Title}
+		request := schema.NoteRequest{Owner: note.Owner, Title: note.Title, Message: note.Message}
+		var verr *schema.ValidationError
+		if err = request.Validate(); errors.As(err, &verr) {
+			result.Status, result.Errors = schema.ImportRejected, verr.Fields
+		} else if result.Status, result.NewTitle, err = importNote(ctx, api, tableName, note, policy); err != nil {
+			result.Status, result.Detail = schema.ImportFailed, err.Error()
+		}
+		response.Counts[result.Status]++
+		response.Results = append(response.Results, result)
+	}
+	log.Printf("imported %d notes to %s: %v\n", len(response.Results), tableName, response.Counts)
+	return response, nil
+}
+
+// importNote writes a single valid Note, returning its ImportStatus and, for a renamed Note, its new title
+func importNote(ctx context.Context, api DynamoImportAPI, tableName string, note *schema.Note, policy ConflictPolicy) (schema.ImportStatus, string, error) {
+	status, existing, err := restoreOrCompare(ctx, api, tableName, note)
+	if err != nil || status != "" {
+		return status, "", err
+	}
+	switch policy {
+	case ConflictOverwrite:
+		if _, err = ddb.UpdateNote(ctx, api, tableName, note, existing.Version); err != nil {
+			return "", "", err
+		}
+		return schema.ImportOverwritten, "", nil
+	case ConflictRename:
+		for n := 2; n <= maxRenameAttempts; n++ {
+			renamed := *note
+			renamed.Title = fmt.Sprintf("%s (%d)", note.Title, n)
+			if len(renamed.Title) > schema.MaxTitleBytes {
+				break
+			}
+			status, _, err := restoreOrCompare(ctx, api, tableName, &renamed)
+			if err != nil {
+				return "", "", err
+			}
+			switch status {
+			case schema.ImportCreated:
+				return schema.ImportRenamed, renamed.Title, nil
+			case schema.ImportUnchanged:
+				return schema.ImportUnchanged, renamed.Title, nil
+			}
+		}
+		return "", "", fmt.Errorf("no free title was found for %q", note.Title)
+	default:
+		return schema.ImportSkipped, "", nil
+	}
+}
+
+// restoreOrCompare restores the Note when its owner and title are free, returning ImportCreated, or returns
+// ImportUnchanged when the existing Note has the same message.  An empty ImportStatus means the existing Note, which is
+// returned, differs.
+func restoreOrCompare(ctx context.Context, api DynamoImportAPI, tableName string, note *schema.Note) (schema.ImportStatus, *schema.Note, error) {
+	existing, err := ddb.GetNote(ctx, api, tableName, note.Owner, note.Title)
+	var nfe *ddb.NoteNotFoundError
+	if errors.As(err, &nfe) {
+		if _, err = ddb.RestoreNote(ctx, api, tableName, note); err != nil {
+			return "", nil, err
+		}
+		return schema.ImportCreated, nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	if existing.Message == note.Message {
+		return schema.ImportUnchanged, existing, nil
+	}
+	return "", existing, nil
+}
@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			source := ddbfake.NewNotesTable("notes")
+			for i := range archivedNotes {
+				if _, err := ddb.RestoreNote(ctx, source, "notes", &archivedNotes[i]); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			var buf bytes.Buffer
+			count, err := Export(ctx, source, "notes", format, &buf)
+			if err != nil || count != len(archivedNotes) {
+				t.Fatalf("expected %d notes but exported %d, %v", len(archivedNotes), count, err)
+			}
+
+			target := ddbfake.NewNotesTable("notes")
+			response, err := Import(ctx, target, "notes", format, bytes.NewReader(buf.Bytes()), ConflictSkip)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.Counts[schema.ImportCreated] != len(archivedNotes) {
+				t.Errorf("expected every note to be created but got %+v", response.Counts)
+			}
+			if expected, actual := scanNotes(t, source), scanNotes(t, target); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected %+v but got %+v", expected, actual)
+			}
+
+			response, err = Import(ctx, target, "notes", format, bytes.NewReader(buf.Bytes()), ConflictRename)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.Counts[schema.ImportUnchanged] != len(archivedNotes) {
+				t.Errorf("expected every note to be unchanged on a second import but got %+v", response.Counts)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	archive := "{\"owner\":\"a\",\"title\":\"1\",\"message\":\"imported\"}\n" +
+		"{\"owner\":\"a\",\"title\":\"2\",\"message\":\"same\"}\n" +
+		"{\"owner\":\"a\",\"title\":\"3\",\"message\":\"new\"}\n" +
+		"{\"owner\":\"\",\"title\":\"4\",\"message\":\"m\"}\n"
+
+	cases := map[string]struct {
+		policy           ConflictPolicy
+		existing         []schema.Note
+		expectedResults  []schema.ImportResult
+		expectedMessages map[string]string
+	}{
+		"skip": {
+			policy: ConflictSkip,
+			expectedResults: []schema.ImportResult{
+				{Index: 0, Owner: "a", Title: "1", Status: schema.ImportSkipped},
+				{Index: 1, Owner: "a", Title: "2", Status: schema.ImportUnchanged},
+				{Index: 2, Owner: "a", Title: "3", Status: schema.ImportCreated},
+			},
+			expectedMessages: map[string]string{"1": "existing", "2": "same", "3": "new"},
+		},
+		"overwrite": {
+			policy: ConflictOverwrite,
+			expectedResults: []schema.ImportResult{
+				{Index: 0, Owner: "a", Title: "1", Status: schema.ImportOverwritten},
+				{Index: 1, Owner: "a", Title: "2", Status: schema.ImportUnchanged},
+				{Index: 2, Owner: "a", Title: "3", Status: schema.ImportCreated},
+			},
+			expectedMessages: map[string]string{"1": "imported", "2": "same", "3": "new"},
+		},
+		"rename": {
+			policy: ConflictRename,
+			expectedResults: []schema.ImportResult{
+				{Index: 0, Owner: "a", Title: "1", Status: schema.ImportRenamed, NewTitle: "1 (2)"},
+				{Index: 1, Owner: "a", Title: "2", Status: schema.ImportUnchanged},
+				{Index: 2, Owner: "a", Title: "3", Status: schema.ImportCreated},
+			},
+			expectedMessages: map[string]string{"1": "existing", "1 (2)": "imported", "2": "same", "3": "new"},
+		},
+		"rename after a previous rename": {
+			policy:   ConflictRename,
+			existing: []schema.Note{{Owner: "a", Title: "1 (2)", Message: "other"}, {Owner: "a", Title: "1 (3)", Message: "imported"}},
+			expectedResults: []schema.ImportResult{
+				{Index: 0, Owner: "a", Title: "1", Status: schema.ImportUnchanged, NewTitle: "1 (3)"},
+				{Index: 1, Owner: "a", Title: "2", Status: schema.ImportUnchanged},
+				{Index: 2, Owner: "a", Title: "3", Status: schema.ImportCreated},
+			},
+			expectedMessages: map[string]string{"1": "existing", "1 (2)": "other", "1 (3)": "imported", "2": "same", "3": "new"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			api := ddbfake.NewNotesTable("notes")
+			existing := append([]schema.Note{{Owner: "a", Title: "1", Message: "existing"}, {Owner: "a", Title: "2", Message: "same"}}, tt.existing...)
+			for i := range existing {
+				if _, err := ddb.CreateNote(ctx, api, "notes", &existing[i]); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			response, err := Import(ctx, api, "notes", JSONLines, strings.NewReader(archive), tt.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			expectedResults := append(tt.expectedResults, schema.ImportResult{
+				Index: 3, Title: "4", Status: schema.ImportRejected,
+				Errors: []schema.FieldError{{Field: "owner", Message: "is required"}},
+			})
+			if !reflect.DeepEqual(response.Results, expectedResults) {
+				t.Errorf("expected %+v but got %+v", expectedResults, response.Results)
+			}
+			if response.Counts[schema.ImportRejected] != 1 {
+				t.Errorf("expected a rejected note in %+v", response.Counts)
+			}
+			messages := make(map[string]string)
+			for _, note := range scanNotes(t, api) {
+				messages[note.Title] = note.Message
+			}
+			if !reflect.DeepEqual(messages, tt.expectedMessages) {
+				t.Errorf("expected %v but got %v", tt.expectedMessages, messages)
+			}
+		})
+	}
+}
+
+func TestImport_InvalidArchive(t *testing.T) {
+	api := ddbfake.NewNotesTable("notes")
+	archive := "{\"owner\":\"a\",\"title\":\"1\",\"message\":\"m\"}\nnot json\n"
+
+	response, err := Import(context.Background(), api, "notes", JSONLines, strings.NewReader(archive), ConflictSkip)
+
+	var de *DecodeError
+	if err == nil || !errors.As(err, &de) {
+		t.Fatalf("expected a DecodeError but got %v", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Status != schema.ImportCreated {
+		t.Errorf("expected the first note to be created but got %+v", response.Results)
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, policy := range ConflictPolicies {
+		if p, err := ParseConflictPolicy(string(policy)); err != nil || p != policy {
+			t.Errorf("expected %q but got %q, %v", policy, p, err)
+		}
+	}
+	if _, err := ParseConflictPolicy("merge"); err == nil {
+		t.Error("expected an unknown conflict policy error")
+	}
+}
+
+// scanNotes returns every Note in the table sorted by owner and title, without the version that restoring a Note resets
+func scanNotes(t *testing.T, api ddb.DynamoScanAPI) []schema.Note {
+	t.Helper()
+	notes, err := ddb.Scan(context.Background(), api, "notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := range notes {
+		notes[i].Version = 0
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].Owner+"/"+notes[i].Title < notes[j].Owner+"/"+notes[j].Title
+	})
+	return notes
+}
@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"io"
+	"strings"
+)
+
+// maxLineBytes is the longest line the JSON Lines decoder reads, enough for a Note with the largest message once escaped
+const maxLineBytes = 4 * 1024 * 1024
+
+type jsonLinesEncoder struct {
+	encoder *json.Encoder
+}
+
+func newJSONLinesEncoder(w io.Writer) *jsonLinesEncoder {
+	return &jsonLinesEncoder{encoder: json.NewEncoder(w)}
+}
+
+func (e *jsonLinesEncoder) Encode(note *schema.Note) error {
+	return e.encoder.Encode(schema.NewNoteResponse(note))
+}
+
+func (e *jsonLinesEncoder) Close() error { return nil }
+
+type jsonLinesDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLinesDecoder(r io.Reader) *jsonLinesDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	return &jsonLinesDecoder{scanner: scanner}
+}
+
+// Decode reads the next NoteResponse, skipping blank lines
+func (d *jsonLinesDecoder) Decode() (*schema.Note, error) {
+	for d.scanner.Scan() {
+		d.line++
+		line := d.scanner.Bytes()
+		if strings.TrimSpace(string(line)) == "" {
+			continue
+		}
+		var response schema.NoteResponse
+		if err := json.Unmarshal(line, &response); err != nil {
+			return nil, &DecodeError{Entry: fmt.Sprintf("line %d", d.line), err: err}
+		}
+		note := schema.NoteFromResponse(&response)
+		if response.UpdatedAt.IsZero() {
+			note.UpdatedAt = 0
+		}
+		return note, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, &DecodeError{Entry: fmt.Sprintf("line %d", d.line+1), err: err}
+	}
+	return nil, io.EOF
+}
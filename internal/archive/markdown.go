@@ -0,0 +1,148 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// frontMatterDelimiter opens and closes the YAML front matter of a Markdown file
+const frontMatterDelimiter = "---\n"
+
+// frontMatter holds every field of a Note apart from the message, which is the body of the Markdown file
+type frontMatter struct {
+	Owner     string     `yaml:"owner"`
+	Title     string     `yaml:"title"`
+	Version   int64      `yaml:"version,omitempty"`
+	CreatedAt *time.Time `yaml:"created_at,omitempty"`
+	UpdatedAt *time.Time `yaml:"updated_at,omitempty"`
+}
+
+type markdownEncoder struct {
+	writer *tar.Writer
+	dirs   map[string]bool
+}
+
+func newMarkdownEncoder(w io.Writer) *markdownEncoder {
+	return &markdownEncoder{writer: tar.NewWriter(w), dirs: make(map[string]bool)}
+}
+
+// Encode writes the Note to <owner>/<title>.md, escaping the owner and title so that any value is a single path element
+func (e *markdownEncoder) Encode(note *schema.Note) error {
+	response := schema.NewNoteResponse(note)
+	matter, err := yaml.Marshal(&frontMatter{
+		Owner:     response.Owner,
+		Title:     response.Title,
+		Version:   response.Version,
+		CreatedAt: response.CreatedAt,
+		UpdatedAt: &response.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	body.WriteString(frontMatterDelimiter)
+	body.Write(matter)
+	body.WriteString(frontMatterDelimiter)
+	body.WriteString(response.Message)
+	body.WriteString("\n")
+
+	dir := url.PathEscape(response.Owner)
+	if !e.dirs[dir] {
+		if err = e.writer.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0755, ModTime: response.UpdatedAt}); err != nil {
+			return err
+		}
+		e.dirs[dir] = true
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(dir, url.PathEscape(response.Title)+".md"),
+		Mode:     0644,
+		Size:     int64(body.Len()),
+		ModTime:  response.UpdatedAt,
+	}
+	if err = e.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = e.writer.Write(body.Bytes())
+	return err
+}
+
+func (e *markdownEncoder) Close() error {
+	return e.writer.Close()
+}
+
+type markdownDecoder struct {
+	reader *tar.Reader
+}
+
+func newMarkdownDecoder(r io.Reader) *markdownDecoder {
+	return &markdownDecoder{reader: tar.NewReader(r)}
+}
+
+// Decode reads the next .md file, skipping directories and any other files.  The owner and title are read from the front
+// matter, so renaming a file does not change the Note.
+func (d *markdownDecoder) Decode() (*schema.Note, error) {
+	for {
+		header, err := d.reader.Next()
+		if err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, &DecodeError{Entry: "archive", err: err}
+		}
+		if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".md" {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(d.reader, maxLineBytes))
+		if err != nil {
+			return nil, &DecodeError{Entry: header.Name, err: err}
+		}
+		note, err := parseMarkdown(string(content))
+		if err != nil {
+			return nil, &DecodeError{Entry: header.Name, err: err}
+		}
+		return note, nil
+	}
+}
+
+func parseMarkdown(content string) (*schema.Note, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(content, frontMatterDelimiter) {
+		return nil, errors.New("missing front matter")
+	}
+	content = strings.TrimPrefix(content, frontMatterDelimiter)
+	end := strings.Index(content, "\n"+frontMatterDelimiter)
+	if end < 0 {
+		return nil, errors.New("front matter is not closed")
+	}
+	var matter frontMatter
+	if err := yaml.Unmarshal([]byte(content[:end+1]), &matter); err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	}
+	note := &schema.Note{
+		Owner:     matter.Owner,
+		Title:     matter.Title,
+		Message:   strings.TrimSuffix(content[end+1+len(frontMatterDelimiter):], "\n"),
+		Version:   matter.Version,
+		CreatedAt: unixMilli(matter.CreatedAt),
+		UpdatedAt: unixMilli(matter.UpdatedAt),
+	}
+	note.Timestamp = note.UpdatedAt
+	return note, nil
+}
+
+// unixMilli returns t in epoch millis, or zero when t is nil
+func unixMilli(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
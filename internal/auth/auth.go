@@ -0,0 +1,133 @@
+// Package auth identifies the caller of the Notes API and decides which Notes they may read and write.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"os"
+)
+
+const (
+	// AdminScope lets the caller read the Notes of every owner and use the admin endpoints
+	AdminScope = "notes:admin"
+
+	// JWKSLocationEnv is the file or URL of the JWKS that signs bearer tokens
+	JWKSLocationEnv = "JWKS_LOCATION"
+	// JWTIssuerEnv is the iss claim every token must carry, empty to accept any issuer
+	JWTIssuerEnv = "JWT_ISSUER"
+	// JWTAudienceEnv is the aud claim every token must carry, empty to accept any audience
+	JWTAudienceEnv = "JWT_AUDIENCE"
+	// AuthorizerContextEnv, when "true", trusts the Principal passed on by the notes_authorizer function instead of
+	// verifying tokens
+	AuthorizerContextEnv = "AUTHORIZER_CONTEXT"
+)
+
+// Principal is the authenticated caller of a request.
+//
+// A nil Principal means authentication is disabled, and is allowed everything.
+type Principal struct {
+	// Owner is the owner of the Notes the caller may write, the subject of their token
+	Owner  string
+	Scopes []string
+}
+
+// HasScope reports whether the caller was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireOwner returns a 403 apigw.RequestError unless the caller is the owner.  Holding AdminScope does not help, the
+// writer only writes the Notes of the caller, and admins write the Notes of other owners through the admin import.
+func (p *Principal) RequireOwner(owner string) error {
+	if p == nil || p.Owner == owner {
+		return nil
+	}
+	return &apigw.RequestError{StatusCode: http.StatusForbidden, Detail: fmt.Sprintf("the notes of %q can only be written by %q", owner, owner)}
+}
+
+// RequireReader returns a 403 apigw.RequestError unless the caller is the owner or holds AdminScope
+func (p *Principal) RequireReader(owner string) error {
+	if p == nil || p.Owner == owner || p.HasScope(AdminScope) {
+		return nil
+	}
+	return &apigw.RequestError{StatusCode: http.StatusForbidden, Detail: fmt.Sprintf("the notes of %q can only be read by %q", owner, owner)}
+}
+
+// RequireAdmin returns a 403 apigw.RequestError unless the caller holds AdminScope
+func (p *Principal) RequireAdmin() error {
+	if p.HasScope(AdminScope) {
+		return nil
+	}
+	return &apigw.RequestError{StatusCode: http.StatusForbidden, Detail: fmt.Sprintf("the %s scope is required", AdminScope)}
+}
+
+// Authenticator identifies the caller of a request, returning a 401 apigw.RequestError when it cannot
+type Authenticator interface {
+	Authenticate(ctx context.Context, request events.APIGatewayProxyRequest) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator
+type AuthenticatorFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, request events.APIGatewayProxyRequest) (*Principal, error) {
+	return f(ctx, request)
+}
+
+// Authenticate returns the caller of the request, or a nil Principal when the Authenticator is nil
+func Authenticate(ctx context.Context, a Authenticator, request events.APIGatewayProxyRequest) (*Principal, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return a.Authenticate(ctx, request)
+}
+
+// AuthenticatorFromEnv returns AuthorizerContext when AuthorizerContextEnv is "true", otherwise the VerifierFromEnv.  It
+// returns an error when neither is configured, so a function that is missing its settings refuses to start instead of
+// allowing every request.
+func AuthenticatorFromEnv(ctx context.Context) (Authenticator, error) {
+	if os.Getenv(AuthorizerContextEnv) == "true" {
+		return AuthorizerContext{}, nil
+	}
+	v, err := VerifierFromEnv(ctx)
+	switch {
+	case err != nil:
+		return nil, err
+	case v == nil:
+		return nil, fmt.Errorf("either %s must be true or %s must be set", AuthorizerContextEnv, JWKSLocationEnv)
+	}
+	return v, nil
+}
+
+// VerifierFromEnv returns a Verifier for the JWKS named by JWKSLocationEnv, or nil when it is not set
+func VerifierFromEnv(ctx context.Context) (*Verifier, error) {
+	location := os.Getenv(JWKSLocationEnv)
+	if location == "" {
+		return nil, nil
+	}
+	keys, err := LoadKeySet(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{Keys: keys, Issuer: os.Getenv(JWTIssuerEnv), Audience: os.Getenv(JWTAudienceEnv)}, nil
+}
+
+// MustAuthenticatorFromEnv is AuthenticatorFromEnv, panicking when authentication is not configured or the JWKS cannot
+// be loaded.  It is intended to be called from a function's init.
+func MustAuthenticatorFromEnv() Authenticator {
+	a, err := AuthenticatorFromEnv(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrincipal(t *testing.T) {
+	owner := &Principal{Owner: "test-owner"}
+	admin := &Principal{Owner: "admin", Scopes: []string{AdminScope}}
+
+	cases := map[string]struct {
+		check         func() error
+		expectAllowed bool
+	}{
+		"owner writes their notes":            {check: func() error { return owner.RequireOwner("test-owner") }, expectAllowed: true},
+		"owner writes notes of another owner": {check: func() error { return owner.RequireOwner("other") }},
+		"admin writes notes of another owner": {check: func() error { return admin.RequireOwner("other") }},
+		"owner reads their notes":             {check: func() error { return owner.RequireReader("test-owner") }, expectAllowed: true},
+		"owner reads notes of another owner":  {check: func() error { return owner.RequireReader("other") }},
+		"admin reads notes of another owner":  {check: func() error { return admin.RequireReader("other") }, expectAllowed: true},
+		"owner uses the admin endpoints":      {check: func() error { return owner.RequireAdmin() }},
+		"admin uses the admin endpoints":      {check: func() error { return admin.RequireAdmin() }, expectAllowed: true},
+		"disabled authentication":             {check: func() error { return (*Principal)(nil).RequireOwner("other") }, expectAllowed: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tt.check()
+
+			if tt.expectAllowed {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			var rerr *apigw.RequestError
+			if !errors.As(err, &rerr) || rerr.StatusCode != http.StatusForbidden {
+				t.Errorf("expected a 403 request error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(testJWKS), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]struct {
+		env       map[string]string
+		expected  func(a Authenticator) bool
+		expectErr bool
+	}{
+		"authorizer context": {
+			env:      map[string]string{AuthorizerContextEnv: "true", JWKSLocationEnv: path},
+			expected: func(a Authenticator) bool { _, ok := a.(AuthorizerContext); return ok },
+		},
+		"jwks": {
+			env:      map[string]string{JWKSLocationEnv: path},
+			expected: func(a Authenticator) bool { _, ok := a.(*Verifier); return ok },
+		},
+		"unreadable jwks": {
+			env:       map[string]string{JWKSLocationEnv: filepath.Join(t.TempDir(), "missing.json")},
+			expectErr: true,
+		},
+		"nothing configured": {
+			env:       map[string]string{AuthorizerContextEnv: "false"},
+			expectErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{AuthorizerContextEnv, JWKSLocationEnv, JWTIssuerEnv, JWTAudienceEnv} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			a, err := AuthenticatorFromEnv(context.Background())
+
+			if tt.expectErr {
+				if err == nil || a != nil {
+					t.Errorf("expected an error but got %v", a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !tt.expected(a) {
+				t.Errorf("unexpected authenticator %T", a)
+			}
+		})
+	}
+}
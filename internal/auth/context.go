@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ownerContextKey and scopesContextKey name the Principal in the context returned by the Lambda authorizer.  API
+	// Gateway only passes strings, numbers and booleans through, so the scopes are space separated like the scope claim.
+	ownerContextKey  = "owner"
+	scopesContextKey = "scopes"
+)
+
+// Context is the context of a Lambda authorizer response, which API Gateway hands to the integration as
+// request.RequestContext.Authorizer
+func (p *Principal) Context() map[string]interface{} {
+	return map[string]interface{}{
+		ownerContextKey:  p.Owner,
+		scopesContextKey: strings.Join(p.Scopes, " "),
+	}
+}
+
+// PrincipalFromContext reads the Principal from the context returned by the Lambda authorizer, false when there is none
+func PrincipalFromContext(authorizer map[string]interface{}) (*Principal, bool) {
+	owner, _ := authorizer[ownerContextKey].(string)
+	if owner == "" {
+		return nil, false
+	}
+	scopes, _ := authorizer[scopesContextKey].(string)
+	return &Principal{Owner: owner, Scopes: strings.Fields(scopes)}, true
+}
+
+// AuthorizerContext authenticates requests that API Gateway has already authorized with the notes_authorizer function,
+// trusting the Principal in the authorizer context
+type AuthorizerContext struct{}
+
+func (AuthorizerContext) Authenticate(_ context.Context, request events.APIGatewayProxyRequest) (*Principal, error) {
+	principal, ok := PrincipalFromContext(request.RequestContext.Authorizer)
+	if !ok {
+		return nil, &apigw.RequestError{StatusCode: http.StatusUnauthorized, Detail: "the request was not authorized"}
+	}
+	return principal, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAuthorizerContext(t *testing.T) {
+	cases := map[string]struct {
+		authorizer        map[string]interface{}
+		expectedPrincipal *Principal
+	}{
+		"principal": {
+			authorizer:        (&Principal{Owner: "test-owner", Scopes: []string{AdminScope, "notes:read"}}).Context(),
+			expectedPrincipal: &Principal{Owner: "test-owner", Scopes: []string{AdminScope, "notes:read"}},
+		},
+		"principal without scopes": {
+			authorizer:        map[string]interface{}{"owner": "test-owner", "scopes": ""},
+			expectedPrincipal: &Principal{Owner: "test-owner", Scopes: []string{}},
+		},
+		"missing owner": {
+			authorizer: map[string]interface{}{"scopes": AdminScope},
+		},
+		"missing authorizer": {},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{
+				RequestContext: events.APIGatewayProxyRequestContext{Authorizer: tt.authorizer},
+			}
+
+			principal, err := AuthorizerContext{}.Authenticate(context.Background(), request)
+
+			if tt.expectedPrincipal == nil {
+				var rerr *apigw.RequestError
+				if !errors.As(err, &rerr) || rerr.StatusCode != http.StatusUnauthorized {
+					t.Errorf("expected a 401 request error but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(principal, tt.expectedPrincipal) {
+				t.Errorf("expected %+v but got %+v", tt.expectedPrincipal, principal)
+			}
+		})
+	}
+}
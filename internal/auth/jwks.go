@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// HS256 is HMAC with SHA-256, signed with a shared "oct" key
+	HS256 = "HS256"
+	// RS256 is RSASSA-PKCS1-v1_5 with SHA-256, signed with the private half of an "RSA" key
+	RS256 = "RS256"
+
+	// jwksTimeout bounds fetching a JWKS from a URL
+	jwksTimeout = 10 * time.Second
+)
+
+// KeySet holds the keys of a JSON Web Key Set that can verify tokens
+type KeySet struct {
+	keys []jsonWebKey
+}
+
+// jsonWebKey is a single key of a JWKS, the key is a []byte for HS256 and an *rsa.PublicKey for RS256
+type jsonWebKey struct {
+	id  string
+	alg string
+	key interface{}
+}
+
+// rawJSONWebKey holds the members of a JWK used by this package
+type rawJSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// K is the secret of an "oct" key
+	K string `json:"k"`
+	// N and E are the modulus and exponent of an "RSA" key
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+// ParseKeySet reads a JWKS.  Keys that are not for signatures or use another algorithm than HS256 or RS256 are skipped,
+// but at least one usable key is required.
+func ParseKeySet(b []byte) (*KeySet, error) {
+	var jwks struct {
+		Keys []rawJSONWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, fmt.Errorf("the JWKS is not valid JSON: %w", err)
+	}
+	set := &KeySet{}
+	for i, raw := range jwks.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		var key jsonWebKey
+		var err error
+		switch {
+		case raw.Kty == "oct" && (raw.Alg == "" || raw.Alg == HS256):
+			key, err = hmacKey(raw)
+		case raw.Kty == "RSA" && (raw.Alg == "" || raw.Alg == RS256):
+			key, err = rsaKey(raw)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d of the JWKS: %w", i, err)
+		}
+		set.keys = append(set.keys, key)
+	}
+	if len(set.keys) == 0 {
+		return nil, errors.New("the JWKS has no HS256 or RS256 signing keys")
+	}
+	return set, nil
+}
+
+func hmacKey(raw rawJSONWebKey) (jsonWebKey, error) {
+	secret, err := base64.RawURLEncoding.DecodeString(raw.K)
+	if err != nil || len(secret) == 0 {
+		return jsonWebKey{}, errors.New("k must be a base64url encoded secret")
+	}
+	return jsonWebKey{id: raw.Kid, alg: HS256, key: secret}, nil
+}
+
+func rsaKey(raw rawJSONWebKey) (jsonWebKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(raw.N)
+	if err != nil || len(n) == 0 {
+		return jsonWebKey{}, errors.New("n must be a base64url encoded modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(raw.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return jsonWebKey{}, errors.New("e must be a base64url encoded exponent")
+	}
+	exponent := new(big.Int).SetBytes(e).Int64()
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent)}
+	return jsonWebKey{id: raw.Kid, alg: RS256, key: key}, nil
+}
+
+// LoadKeySet reads the JWKS at location, an http or https URL or the path of a file, which may be given as a file URL
+func LoadKeySet(ctx context.Context, location string) (*KeySet, error) {
+	var b []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		b, err = fetchKeySet(ctx, location)
+	} else {
+		b, err = os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the JWKS from %s: %w", location, err)
+	}
+	return ParseKeySet(b)
+}
+
+func fetchKeySet(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, jwksTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// key returns the key that verifies a token signed with alg.  A token without a key ID can only be verified when the set
+// has a single key for the algorithm.
+func (s *KeySet) key(id, alg string) (interface{}, error) {
+	var found []interface{}
+	for _, k := range s.keys {
+		if k.alg == alg && (id == "" || k.id == id) {
+			found = append(found, k.key)
+		}
+	}
+	switch {
+	case len(found) == 0 && id != "":
+		return nil, fmt.Errorf("no %s key with ID %q", alg, id)
+	case len(found) == 0:
+		return nil, fmt.Errorf("no %s key", alg)
+	case len(found) > 1:
+		return nil, fmt.Errorf("several %s keys match, the token must name one with kid", alg)
+	}
+	return found[0], nil
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testJWKS = `{"keys": [{"kty": "oct", "kid": "hmac", "k": "dGVzdC1zZWNyZXQ"}]}`
+
+func TestParseKeySet(t *testing.T) {
+	cases := map[string]struct {
+		jwks          string
+		expectedKeys  int
+		expectedError string
+	}{
+		"hmac key": {
+			jwks:         testJWKS,
+			expectedKeys: 1,
+		},
+		"keys for other uses and algorithms are skipped": {
+			jwks:         `{"keys": [{"kty": "oct", "k": "dGVzdA", "use": "enc"}, {"kty": "oct", "k": "dGVzdA", "alg": "HS512"}, {"kty": "oct", "k": "dGVzdA"}]}`,
+			expectedKeys: 1,
+		},
+		"no usable keys": {
+			jwks:          `{"keys": [{"kty": "EC", "crv": "P-256"}]}`,
+			expectedError: "the JWKS has no HS256 or RS256 signing keys",
+		},
+		"invalid rsa key": {
+			jwks:          `{"keys": [{"kty": "RSA", "n": "", "e": "AQAB"}]}`,
+			expectedError: "key 0 of the JWKS: n must be a base64url encoded modulus",
+		},
+		"invalid json": {
+			jwks:          `{"keys": `,
+			expectedError: "the JWKS is not valid JSON",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			keys, err := ParseKeySet([]byte(tt.jwks))
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error %q but got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(keys.keys) != tt.expectedKeys {
+				t.Errorf("expected %d keys but got %d", tt.expectedKeys, len(keys.keys))
+			}
+		})
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(testJWKS), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testJWKS))
+	}))
+	defer server.Close()
+
+	cases := map[string]struct {
+		location    string
+		expectError bool
+	}{
+		"file":         {location: path},
+		"file url":     {location: "file://" + path},
+		"url":          {location: server.URL + "/.well-known/jwks.json"},
+		"missing file": {location: path + ".missing", expectError: true},
+		"missing url":  {location: server.URL + "/missing", expectError: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			keys, err := LoadKeySet(context.Background(), tt.location)
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err = keys.key("hmac", HS256); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
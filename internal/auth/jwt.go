@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the clocks of the issuer and the API may drift apart when checking exp and nbf
+const clockSkew = 30 * time.Second
+
+// ErrInvalidToken is wrapped by every error returned by Verifier.Verify
+var ErrInvalidToken = errors.New("invalid token")
+
+// Verifier authenticates requests with a JWT bearer token signed by one of its keys
+type Verifier struct {
+	Keys *KeySet
+	// Issuer and Audience, when set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+	// Now returns the current time, nil uses time.Now
+	Now func() time.Time
+}
+
+// Claims are the JWT claims read by the Verifier
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	// Scope is the space separated list of granted scopes
+	Scope string `json:"scope"`
+}
+
+// Principal is the caller identified by the claims: the subject, with the scopes of the scope claim
+func (c *Claims) Principal() *Principal {
+	return &Principal{Owner: c.Subject, Scopes: strings.Fields(c.Scope)}
+}
+
+// audience is the aud claim, which may be a single string or an array of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// Authenticate verifies the bearer token of the Authorization header, the Principal is the subject of the token
+func (v *Verifier) Authenticate(_ context.Context, request events.APIGatewayProxyRequest) (*Principal, error) {
+	fields := strings.Fields(apigw.Header(request, "Authorization"))
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "Bearer") {
+		return nil, &apigw.RequestError{StatusCode: http.StatusUnauthorized, Detail: "the Authorization header must be a bearer token"}
+	}
+	claims, err := v.Verify(fields[1])
+	if err != nil {
+		log.Printf("rejected bearer token: %s", err)
+		return nil, &apigw.RequestError{StatusCode: http.StatusUnauthorized, Detail: err.Error()}
+	}
+	return claims.Principal(), nil
+}
+
+// Verify checks the signature and the registered claims of a compact JWT, returning its Claims.  A token must have a
+// subject and an expiry.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: a JWT has three parts", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: the header %s", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], parts[2]); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: the claims %s", ErrInvalidToken, err)
+	}
+	if err := v.verifyClaims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
+
+func (v *Verifier) verifySignature(alg, kid, signingInput, encodedSignature string) error {
+	if alg != HS256 && alg != RS256 {
+		return fmt.Errorf("alg %q is not supported", alg)
+	}
+	key, err := v.Keys.key(kid, alg)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return errors.New("the signature is not base64url encoded")
+	}
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("the signature does not match")
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) != nil {
+			return errors.New("the signature does not match")
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) verifyClaims(claims *Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	switch {
+	case claims.Subject == "":
+		return errors.New("sub is required")
+	case claims.ExpiresAt == 0:
+		return errors.New("exp is required")
+	case now.Add(-clockSkew).After(time.Unix(claims.ExpiresAt, 0)):
+		return errors.New("the token has expired")
+	case claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)):
+		return errors.New("the token is not valid yet")
+	case v.Issuer != "" && claims.Issuer != v.Issuer:
+		return fmt.Errorf("iss must be %q", v.Issuer)
+	case v.Audience != "" && !claims.Audience.contains(v.Audience):
+		return fmt.Errorf("aud must include %q", v.Audience)
+	}
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment unmarshals a base64url encoded JSON segment of a JWT
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("is not base64url encoded")
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return errors.New("is not a JSON object")
+	}
+	return nil
+}
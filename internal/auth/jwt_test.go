@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/aws/aws-lambda-go/events"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("test-secret")
+	testNow    = time.Date(2021, 12, 8, 21, 46, 37, 0, time.UTC)
+)
+
+// testKeySet returns a JWKS with an HS256 key, "hmac", and an RS256 key, "rsa", for the private key
+func testKeySet(t *testing.T, private *rsa.PrivateKey) []byte {
+	t.Helper()
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "oct", "kid": "hmac", "alg": HS256, "k": base64.RawURLEncoding.EncodeToString(testSecret)},
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(private.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private.E)).Bytes()),
+			},
+			{"kty": "EC", "kid": "ec", "crv": "P-256"},
+		},
+	}
+	b, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return b
+}
+
+// sign returns a compact JWT for the claims, signed with the HMAC secret or the RSA private key
+func sign(t *testing.T, header map[string]string, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signingInput := encode(header) + "." + encode(claims)
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	keys, err := ParseKeySet(testKeySet(t, private))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":   "test-owner",
+			"iss":   "test-issuer",
+			"aud":   []string{"notes", "other"},
+			"exp":   testNow.Add(time.Hour).Unix(),
+			"scope": "notes:read " + AdminScope,
+		}
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	cases := map[string]struct {
+		token         string
+		expectedError string
+	}{
+		"hs256": {
+			token: sign(t, map[string]string{"alg": HS256, "kid": "hmac"}, valid(), testSecret),
+		},
+		"hs256 without a key id": {
+			token: sign(t, map[string]string{"alg": HS256}, valid(), testSecret),
+		},
+		"rs256": {
+			token: sign(t, map[string]string{"alg": RS256, "kid": "rsa"}, valid(), private),
+		},
+		"audience as a string": {
+			token: sign(t, map[string]string{"alg": HS256}, with("aud", "notes"), testSecret),
+		},
+		"expired within the clock skew": {
+			token: sign(t, map[string]string{"alg": HS256}, with("exp", testNow.Add(-10*time.Second).Unix()), testSecret),
+		},
+		"wrong hmac secret": {
+			token:         sign(t, map[string]string{"alg": HS256}, valid(), []byte("other-secret")),
+			expectedError: "invalid token: the signature does not match",
+		},
+		"wrong rsa key": {
+			token:         sign(t, map[string]string{"alg": RS256, "kid": "rsa"}, valid(), other),
+			expectedError: "invalid token: the signature does not match",
+		},
+		"hs256 signed with the rsa key id": {
+			token:         sign(t, map[string]string{"alg": HS256, "kid": "rsa"}, valid(), testSecret),
+			expectedError: `invalid token: no HS256 key with ID "rsa"`,
+		},
+		"unsigned": {
+			token:         sign(t, map[string]string{"alg": "none"}, valid(), nil),
+			expectedError: `invalid token: alg "none" is not supported`,
+		},
+		"expired": {
+			token:         sign(t, map[string]string{"alg": HS256}, with("exp", testNow.Add(-time.Minute).Unix()), testSecret),
+			expectedError: "invalid token: the token has expired",
+		},
+		"not valid yet": {
+			token:         sign(t, map[string]string{"alg": HS256}, with("nbf", testNow.Add(time.Minute).Unix()), testSecret),
+			expectedError: "invalid token: the token is not valid yet",
+		},
+		"without an expiry": {
+			token:         sign(t, map[string]string{"alg": HS256}, with("exp", nil), testSecret),
+			expectedError: "invalid token: exp is required",
+		},
+		"without a subject": {
+			token:         sign(t, map[string]string{"alg": HS256}, with("sub", nil), testSecret),
+			expectedError: "invalid token: sub is required",
+		},
+		"another issuer": {
+			token:         sign(t, map[string]string{"alg": HS256}, with("iss", "other-issuer"), testSecret),
+			expectedError: `invalid token: iss must be "test-issuer"`,
+		},
+		"another audience": {
+			token:         sign(t, map[string]string{"alg": HS256}, with("aud", "other"), testSecret),
+			expectedError: `invalid token: aud must include "notes"`,
+		},
+		"not a jwt": {
+			token:         "not-a-jwt",
+			expectedError: "invalid token: a JWT has three parts",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			v := &Verifier{Keys: keys, Issuer: "test-issuer", Audience: "notes", Now: func() time.Time { return testNow }}
+
+			claims, err := v.Verify(tt.token)
+
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("expected error %q but got %v", tt.expectedError, err)
+				}
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("expected %v to wrap ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if claims.Subject != "test-owner" {
+				t.Errorf("expected subject test-owner but got %q", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestVerifier_Authenticate(t *testing.T) {
+	keys, err := ParseKeySet([]byte(fmt.Sprintf(`{"keys": [{"kty": "oct", "k": %q}]}`, base64.RawURLEncoding.EncodeToString(testSecret))))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	token := sign(t, map[string]string{"alg": HS256}, map[string]interface{}{
+		"sub":   "test-owner",
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"scope": "notes:read " + AdminScope,
+	}, testSecret)
+
+	cases := map[string]struct {
+		authorization      string
+		expectedStatusCode int
+	}{
+		"bearer token":         {authorization: "Bearer " + token},
+		"lowercase scheme":     {authorization: "bearer " + token},
+		"missing header":       {expectedStatusCode: http.StatusUnauthorized},
+		"basic credentials":    {authorization: "Basic dGVzdDp0ZXN0", expectedStatusCode: http.StatusUnauthorized},
+		"invalid bearer token": {authorization: "Bearer " + token + "x", expectedStatusCode: http.StatusUnauthorized},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			v := &Verifier{Keys: keys, Now: func() time.Time { return testNow }}
+			request := events.APIGatewayProxyRequest{Headers: map[string]string{}}
+			if tt.authorization != "" {
+				request.Headers["authorization"] = tt.authorization
+			}
+
+			principal, err := v.Authenticate(context.Background(), request)
+
+			if tt.expectedStatusCode != 0 {
+				var rerr *apigw.RequestError
+				if !errors.As(err, &rerr) || rerr.StatusCode != tt.expectedStatusCode {
+					t.Fatalf("expected a %d request error but got %v", tt.expectedStatusCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if principal.Owner != "test-owner" || !principal.HasScope(AdminScope) {
+				t.Errorf("unexpected principal %+v", principal)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Package authorizer is the API Gateway Lambda authorizer of the Notes API.  It identifies the caller from a JWT or an API
+// key in the Authorization header and passes them on to the functions in the authorizer context.
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// bearerScheme carries a JWT in the Authorization header
+	bearerScheme = "Bearer"
+	// apiKeyScheme carries an API key in the Authorization header
+	apiKeyScheme = "ApiKey"
+)
+
+// ErrUnauthorized is returned for requests without valid credentials.  API Gateway only answers 401 Unauthorized for this
+// exact message, any other error is a 500.
+var ErrUnauthorized = errors.New("Unauthorized")
+
+// Handler authorizes requests with a JWT checked by the Verifier or an API key stored in a DynamoDB table
+type Handler struct {
+	API ddb.DynamoGetItemAPI
+	// APIKeysTableName is the table of API keys, API keys are refused when it is empty
+	APIKeysTableName string
+	// Verifier checks bearer tokens, they are refused when it is nil
+	Verifier *auth.Verifier
+}
+
+// Handle is the REQUEST authorizer handler.  The policy allows every method of the stage, as API Gateway caches it for
+// the Authorization header whatever the method, and the functions check what the caller may do with the Principal of the
+// context.
+func (h *Handler) Handle(ctx context.Context, request events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	principal, err := h.authenticate(ctx, request)
+	if err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, err
+	}
+	log.Printf("authorized %q with scopes %q", principal.Owner, principal.Scopes)
+	return events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: principal.Owner,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{
+				{Action: []string{"execute-api:Invoke"}, Effect: "Allow", Resource: []string{stageArn(request.MethodArn) + "/*"}},
+			},
+		},
+		Context: principal.Context(),
+	}, nil
+}
+
+// authenticate returns the caller named by the credentials of the Authorization header, ErrUnauthorized when they are
+// missing or not valid
+func (h *Handler) authenticate(ctx context.Context, request events.APIGatewayCustomAuthorizerRequestTypeRequest) (*auth.Principal, error) {
+	fields := strings.Fields(header(request.Headers, "Authorization"))
+	if len(fields) != 2 {
+		log.Println("refused a request without credentials")
+		return nil, ErrUnauthorized
+	}
+	scheme, credentials := fields[0], fields[1]
+	switch {
+	case strings.EqualFold(scheme, bearerScheme) && h.Verifier != nil:
+		claims, err := h.Verifier.Verify(credentials)
+		if err != nil {
+			log.Printf("refused bearer token: %s", err)
+			return nil, ErrUnauthorized
+		}
+		return claims.Principal(), nil
+	case strings.EqualFold(scheme, apiKeyScheme) && h.APIKeysTableName != "":
+		apiKey, err := ddb.GetAPIKey(ctx, h.API, h.APIKeysTableName, credentials)
+		if errors.Is(err, ddb.ErrAPIKeyNotFound) {
+			log.Println("refused unknown api key")
+			return nil, ErrUnauthorized
+		} else if err != nil {
+			return nil, err
+		}
+		if apiKey.Expired(time.Now()) {
+			log.Printf("refused expired api key of %q", apiKey.Owner)
+			return nil, ErrUnauthorized
+		}
+		return &auth.Principal{Owner: apiKey.Owner, Scopes: apiKey.Scopes}, nil
+	default:
+		log.Printf("refused unsupported %q credentials", scheme)
+		return nil, ErrUnauthorized
+	}
+}
+
+// stageArn trims the method and resource from a method ARN, arn:aws:execute-api:region:account:api/stage/GET/notes, to
+// leave the ARN of the stage
+func stageArn(methodArn string) string {
+	parts := strings.SplitN(methodArn, "/", 3)
+	if len(parts) < 2 {
+		return methodArn
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// header returns the named header, which API Gateway passes with the casing used by the client
+func header(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
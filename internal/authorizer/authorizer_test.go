@@ -0,0 +1,141 @@
+package authorizer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testTableName = "api-keys"
+	testMethodArn = "arn:aws:execute-api:us-east-2:123456789012:abcdef1234/dev/GET/notes/test-owner"
+)
+
+// hs256Token returns a JWT signed with the secret
+func hs256Token(secret []byte, claims string) string {
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandler_Handle(t *testing.T) {
+	secret := []byte("test-secret")
+	keys, err := auth.ParseKeySet([]byte(`{"keys": [{"kty": "oct", "k": "` + base64.RawURLEncoding.EncodeToString(secret) + `"}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expiry := time.Now().Add(time.Hour).Unix()
+	token := hs256Token(secret, `{"sub": "test-owner", "scope": "notes:admin", "exp": `+strconv.FormatInt(expiry, 10)+`}`)
+
+	cases := map[string]struct {
+		authorization     string
+		expectedPrincipal *auth.Principal
+		expectedError     error
+	}{
+		"bearer token": {
+			authorization:     "Bearer " + token,
+			expectedPrincipal: &auth.Principal{Owner: "test-owner", Scopes: []string{auth.AdminScope}},
+		},
+		"api key": {
+			authorization:     "ApiKey valid-key",
+			expectedPrincipal: &auth.Principal{Owner: "key-owner", Scopes: []string{"notes:read"}},
+		},
+		"lowercase scheme": {
+			authorization:     "apikey valid-key",
+			expectedPrincipal: &auth.Principal{Owner: "key-owner", Scopes: []string{"notes:read"}},
+		},
+		"invalid bearer token": {
+			authorization: "Bearer " + hs256Token([]byte("other-secret"), `{"sub": "test-owner"}`),
+			expectedError: ErrUnauthorized,
+		},
+		"unknown api key": {
+			authorization: "ApiKey unknown-key",
+			expectedError: ErrUnauthorized,
+		},
+		"expired api key": {
+			authorization: "ApiKey expired-key",
+			expectedError: ErrUnauthorized,
+		},
+		"basic credentials": {
+			authorization: "Basic dGVzdDp0ZXN0",
+			expectedError: ErrUnauthorized,
+		},
+		"missing credentials": {
+			expectedError: ErrUnauthorized,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.New()
+			if _, err := ddb.CreateAPIKeysTable(ctx, api, testTableName); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, k := range []schema.APIKey{
+				{KeyHash: schema.HashAPIKey("valid-key"), Owner: "key-owner", Scopes: []string{"notes:read"}, ExpiresAt: expiry},
+				{KeyHash: schema.HashAPIKey("expired-key"), Owner: "key-owner", ExpiresAt: time.Now().Add(-time.Hour).Unix()},
+			} {
+				if err := ddb.PutAPIKey(ctx, api, testTableName, &k); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			h := &Handler{API: api, APIKeysTableName: testTableName, Verifier: &auth.Verifier{Keys: keys}}
+			request := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+				Type:      "REQUEST",
+				MethodArn: testMethodArn,
+				Headers:   map[string]string{"authorization": tt.authorization},
+			}
+
+			response, err := h.Handle(ctx, request)
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Fatalf("expected error %v but got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.PrincipalID != tt.expectedPrincipal.Owner {
+				t.Errorf("expected principal %q but got %q", tt.expectedPrincipal.Owner, response.PrincipalID)
+			}
+			statement := response.PolicyDocument.Statement[0]
+			expectedResource := []string{"arn:aws:execute-api:us-east-2:123456789012:abcdef1234/dev/*"}
+			if statement.Effect != "Allow" || !reflect.DeepEqual(statement.Resource, expectedResource) {
+				t.Errorf("expected the policy to allow %v but got %+v", expectedResource, statement)
+			}
+			principal, ok := auth.PrincipalFromContext(response.Context)
+			if !ok || !reflect.DeepEqual(principal, tt.expectedPrincipal) {
+				t.Errorf("expected the context to carry %+v but got %+v", tt.expectedPrincipal, response.Context)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleDynamoDBError(t *testing.T) {
+	h := &Handler{API: ddbfake.New(), APIKeysTableName: "missing-table"}
+
+	_, err := h.Handle(context.Background(), events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		MethodArn: testMethodArn,
+		Headers:   map[string]string{"Authorization": "ApiKey valid-key"},
+	})
+
+	if err == nil || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected a DynamoDB error but got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package bootstrap builds the AWS configuration shared by every function.
+//
+// All settings are read from the environment so that the same binary can run in AWS, in SAM local, or against
+// DynamoDB Local.
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-xray-sdk-go/instrumentation/awsv2"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// DynamoDBEndpointEnv overrides the DynamoDB endpoint, we assume this points at a local service
+	DynamoDBEndpointEnv = "DYNAMODB_API_URL_OVERRIDE"
+	// XRayDisabledEnv is also read by the X-Ray SDK, when "true" the clients are not instrumented
+	XRayDisabledEnv = "AWS_XRAY_SDK_DISABLED"
+	// RetryMaxAttemptsEnv is the maximum number of attempts for each AWS API call
+	RetryMaxAttemptsEnv = "RETRY_MAX_ATTEMPTS"
+	// RetryMaxBackoffEnv is the maximum delay between attempts, as a time.Duration string
+	RetryMaxBackoffEnv = "RETRY_MAX_BACKOFF"
+
+	// localRegion is used when connecting to a local service and no region has been configured
+	localRegion = "us-east-1"
+)
+
+// localCredentials are accepted by DynamoDB Local and LocalStack
+var localCredentials = aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test", Source: "bootstrap"}
+
+// Options describes how the AWS configuration is built.  The zero value uses the SDK defaults.
+type Options struct {
+	// DynamoDBEndpoint replaces the DynamoDB endpoint, other services keep their default endpoints
+	DynamoDBEndpoint string
+	// Region is used when the environment does not provide one
+	Region string
+	// Credentials replace the default credential chain
+	Credentials *aws.Credentials
+	// XRay instruments every client created from the configuration
+	XRay bool
+	// MaxAttempts and MaxBackoff configure the standard retryer, zero values keep the SDK defaults
+	MaxAttempts int
+	MaxBackoff  time.Duration
+}
+
+// OptionsFromEnv reads the Options from the environment.
+//
+// When the DynamoDB endpoint is overridden and no access key is set, the local credentials and region are used.
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		DynamoDBEndpoint: os.Getenv(DynamoDBEndpointEnv),
+		XRay:             os.Getenv(XRayDisabledEnv) != "true",
+	}
+	if opts.DynamoDBEndpoint != "" {
+		opts.Region = localRegion
+		if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+			creds := localCredentials
+			opts.Credentials = &creds
+		}
+	}
+	if v := os.Getenv(RetryMaxAttemptsEnv); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return opts, fmt.Errorf("%s must be a positive number: %q", RetryMaxAttemptsEnv, v)
+		}
+		opts.MaxAttempts = attempts
+	}
+	if v := os.Getenv(RetryMaxBackoffEnv); v != "" {
+		backoff, err := time.ParseDuration(v)
+		if err != nil || backoff <= 0 {
+			return opts, fmt.Errorf("%s must be a positive duration: %q", RetryMaxBackoffEnv, v)
+		}
+		opts.MaxBackoff = backoff
+	}
+	return opts, nil
+}
+
+// LoadConfig builds the aws.Config described by the Options
+func LoadConfig(ctx context.Context, opts Options) (aws.Config, error) {
+	var optionsFuncs []func(options *config.LoadOptions) error
+	if opts.DynamoDBEndpoint != "" {
+		log.Printf("Overriding default DynamoDB API URI: %s", opts.DynamoDBEndpoint)
+		optionsFuncs = append(optionsFuncs, config.WithEndpointResolverWithOptions(dynamoDBEndpointResolver(opts.DynamoDBEndpoint)))
+	}
+	if opts.Region != "" {
+		optionsFuncs = append(optionsFuncs, config.WithDefaultRegion(opts.Region))
+	}
+	if opts.Credentials != nil {
+		creds := *opts.Credentials
+		optionsFuncs = append(optionsFuncs, config.WithCredentialsProvider(aws.CredentialsProviderFunc(
+			func(ctx context.Context) (aws.Credentials, error) {
+				return creds, nil
+			})))
+	}
+	if opts.MaxAttempts > 0 || opts.MaxBackoff > 0 {
+		optionsFuncs = append(optionsFuncs, config.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				if opts.MaxAttempts > 0 {
+					o.MaxAttempts = opts.MaxAttempts
+				}
+				if opts.MaxBackoff > 0 {
+					o.MaxBackoff = opts.MaxBackoff
+				}
+			})
+		}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, optionsFuncs...)
+	if err != nil {
+		return cfg, err
+	}
+	if opts.XRay {
+		// Instrumenting AWS SDK v2
+		awsv2.AWSV2Instrumentor(&cfg.APIOptions)
+	}
+	return cfg, nil
+}
+
+// LoadConfigFromEnv builds the aws.Config using OptionsFromEnv
+func LoadConfigFromEnv(ctx context.Context) (aws.Config, error) {
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		return aws.Config{}, err
+	}
+	return LoadConfig(ctx, opts)
+}
+
+// MustDynamoDBClient returns a DynamoDB Client configured from the environment, panicking when the configuration cannot
+// be loaded.  It is intended to be called from a function's init.
+func MustDynamoDBClient() *dynamodb.Client {
+	cfg, err := LoadConfigFromEnv(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	return dynamodb.NewFromConfig(cfg)
+}
+
+// dynamoDBEndpointResolver sends DynamoDB calls to the url, every other service falls back to its default endpoint
+func dynamoDBEndpointResolver(url string) aws.EndpointResolverWithOptions {
+	return aws.EndpointResolverWithOptionsFunc(
+		func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+			if service != dynamodb.ServiceID {
+				return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+			}
+			return aws.Endpoint{
+				PartitionID: "aws",
+				URL:         url,
+			}, nil
+		})
+}
@@ -0,0 +1,171 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	cases := map[string]struct {
+		env             map[string]string
+		expectedOptions Options
+		expectErr       bool
+	}{
+		"empty environment uses defaults": {
+			expectedOptions: Options{XRay: true},
+		},
+		"endpoint override uses local region and credentials": {
+			env: map[string]string{DynamoDBEndpointEnv: "http://localhost:8000"},
+			expectedOptions: Options{
+				DynamoDBEndpoint: "http://localhost:8000",
+				Region:           localRegion,
+				Credentials:      &localCredentials,
+				XRay:             true,
+			},
+		},
+		"endpoint override keeps configured credentials": {
+			env: map[string]string{DynamoDBEndpointEnv: "http://localhost:8000", "AWS_ACCESS_KEY_ID": "AKID"},
+			expectedOptions: Options{
+				DynamoDBEndpoint: "http://localhost:8000",
+				Region:           localRegion,
+				XRay:             true,
+			},
+		},
+		"xray can be disabled": {
+			env:             map[string]string{XRayDisabledEnv: "true"},
+			expectedOptions: Options{},
+		},
+		"retry policy is read": {
+			env:             map[string]string{RetryMaxAttemptsEnv: "5", RetryMaxBackoffEnv: "2s"},
+			expectedOptions: Options{XRay: true, MaxAttempts: 5, MaxBackoff: 2 * time.Second},
+		},
+		"invalid max attempts returns error": {
+			env:       map[string]string{RetryMaxAttemptsEnv: "zero"},
+			expectErr: true,
+		},
+		"invalid max backoff returns error": {
+			env:       map[string]string{RetryMaxBackoffEnv: "-1s"},
+			expectErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			actual, err := OptionsFromEnv()
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(actual, tt.expectedOptions) {
+				t.Fatalf("unexpected options: wanted %+v got %+v", tt.expectedOptions, actual)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("endpoint override only applies to DynamoDB", func(t *testing.T) {
+		clearEnv(t)
+		cfg, err := LoadConfig(ctx, Options{DynamoDBEndpoint: "http://localhost:8000"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		endpoint, err := cfg.EndpointResolverWithOptions.ResolveEndpoint(dynamodb.ServiceID, "us-east-1")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if endpoint.URL != "http://localhost:8000" {
+			t.Fatalf("unexpected endpoint: %q", endpoint.URL)
+		}
+		_, err = cfg.EndpointResolverWithOptions.ResolveEndpoint("CodeDeploy", "us-east-1")
+		var notFound *aws.EndpointNotFoundError
+		if !errors.As(err, &notFound) {
+			t.Fatalf("expected other services to use the default endpoint, got %v", err)
+		}
+	})
+
+	t.Run("region and credentials are applied", func(t *testing.T) {
+		clearEnv(t)
+		cfg, err := LoadConfig(ctx, Options{Region: "us-west-2", Credentials: &localCredentials})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if cfg.Region != "us-west-2" {
+			t.Fatalf("unexpected region: %q", cfg.Region)
+		}
+		creds, err := cfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if creds.AccessKeyID != localCredentials.AccessKeyID {
+			t.Fatalf("unexpected credentials: %+v", creds)
+		}
+	})
+
+	t.Run("environment region takes precedence", func(t *testing.T) {
+		clearEnv(t)
+		t.Setenv("AWS_REGION", "eu-west-1")
+		cfg, err := LoadConfig(ctx, Options{Region: localRegion})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if cfg.Region != "eu-west-1" {
+			t.Fatalf("unexpected region: %q", cfg.Region)
+		}
+	})
+
+	t.Run("retry policy is applied", func(t *testing.T) {
+		clearEnv(t)
+		cfg, err := LoadConfig(ctx, Options{MaxAttempts: 7, MaxBackoff: time.Second})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if attempts := cfg.Retryer().MaxAttempts(); attempts != 7 {
+			t.Fatalf("unexpected max attempts: %d", attempts)
+		}
+	})
+
+	t.Run("xray instruments clients", func(t *testing.T) {
+		clearEnv(t)
+		plain, err := LoadConfig(ctx, Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		instrumented, err := LoadConfig(ctx, Options{XRay: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(instrumented.APIOptions) <= len(plain.APIOptions) {
+			t.Fatalf("expected X-Ray middleware to be added: %d <= %d", len(instrumented.APIOptions), len(plain.APIOptions))
+		}
+	})
+}
+
+// clearEnv isolates the test from the AWS configuration of the machine running it
+func clearEnv(t *testing.T) {
+	t.Helper()
+	missing := filepath.Join(t.TempDir(), "missing")
+	for _, k := range []string{DynamoDBEndpointEnv, XRayDisabledEnv, RetryMaxAttemptsEnv, RetryMaxBackoffEnv,
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_PROFILE"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", missing)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", missing)
+}
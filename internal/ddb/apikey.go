@@ -0,0 +1,110 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"log"
+)
+
+// ErrAPIKeyNotFound is returned when no API key is stored for a key, which is then not a valid key
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// CreateAPIKeysTable creates a table described by schema.APIKeysKeySchema with on-demand billing.  The table is usually
+// CREATING when this returns, see WaitForTable.
+func CreateAPIKeysTable(ctx context.Context, api DynamoCreateTableAPI, tableName string) (*types.TableDescription, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	log.Printf("creating table %s\n", tableName)
+	output, err := api.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String(tableName),
+		KeySchema:            schema.APIKeysKeySchema,
+		AttributeDefinitions: schema.APIKeysAttributeDefinitions,
+		BillingMode:          types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	return output.TableDescription, nil
+}
+
+// PutAPIKey stores the API key, which must not exist already
+func PutAPIKey(ctx context.Context, api DynamoPutItemAPI, tableName string, apiKey *schema.APIKey) error {
+	if tableName == "" {
+		return errors.New("tableName must be provided")
+	}
+	if apiKey.KeyHash == "" || apiKey.Owner == "" {
+		return errors.New("key hash and owner must be provided")
+	}
+	item, err := attributevalue.MarshalMap(apiKey)
+	if err != nil {
+		return err
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("key_hash"))).Build()
+	if err != nil {
+		return err
+	}
+	log.Printf("storing api key for owner %q\n", apiKey.Owner)
+	_, err = api.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(tableName),
+		Item:                      item,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		return errors.New("an api key with the same hash already exists")
+	} else if err != nil {
+		return wrapClientError(err)
+	}
+	return nil
+}
+
+// GetAPIKey returns the stored API key for the key, looked up by its schema.HashAPIKey.
+//
+// ErrAPIKeyNotFound is returned when the key is not stored.
+func GetAPIKey(ctx context.Context, api DynamoGetItemAPI, tableName, key string) (*schema.APIKey, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	output, err := api.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       map[string]types.AttributeValue{"key_hash": &types.AttributeValueMemberS{Value: schema.HashAPIKey(key)}},
+	})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	if len(output.Item) == 0 {
+		return nil, ErrAPIKeyNotFound
+	}
+	var apiKey schema.APIKey
+	if err = attributevalue.UnmarshalMap(output.Item, &apiKey); err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// DeleteAPIKey removes the stored API key for the key, returning ErrAPIKeyNotFound when it is not stored
+func DeleteAPIKey(ctx context.Context, api DynamoDeleteItemAPI, tableName, key string) error {
+	if tableName == "" {
+		return errors.New("tableName must be provided")
+	}
+	output, err := api.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:    aws.String(tableName),
+		Key:          map[string]types.AttributeValue{"key_hash": &types.AttributeValueMemberS{Value: schema.HashAPIKey(key)}},
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return wrapClientError(err)
+	}
+	if len(output.Attributes) == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"reflect"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.New()
+	if _, err := CreateAPIKeysTable(ctx, api, "api-keys"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	stored := &schema.APIKey{
+		KeyHash:   schema.HashAPIKey("test-key"),
+		Owner:     "test-owner",
+		Scopes:    []string{"notes:admin"},
+		CreatedAt: 1638999997000,
+		ExpiresAt: 1670535997,
+	}
+
+	if err := PutAPIKey(ctx, api, "api-keys", stored); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := PutAPIKey(ctx, api, "api-keys", stored); err == nil {
+		t.Error("expected an error storing the same key twice")
+	}
+	got, err := GetAPIKey(ctx, api, "api-keys", "test-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(stored, got) {
+		t.Errorf("expected %+v but got %+v", stored, got)
+	}
+	if _, err = GetAPIKey(ctx, api, "api-keys", "other-key"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound but got %v", err)
+	}
+	if err = DeleteAPIKey(ctx, api, "api-keys", "test-key"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = DeleteAPIKey(ctx, api, "api-keys", "test-key"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound but got %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"log"
+	"time"
+)
+
+const (
+	// BatchWriteLimit is the largest number of items DynamoDB accepts in a single BatchWriteItem request
+	BatchWriteLimit = 25
+	// BatchWriteMaxAttempts is the number of times a request of a chunk is sent before its unprocessed Notes are reported
+	// as failed
+	BatchWriteMaxAttempts = 5
+)
+
+// batchRetryDelay is the wait before the first retry of unprocessed Notes, doubling with every attempt
+var batchRetryDelay = 50 * time.Millisecond
+
+// DynamoBatchGetItemAPI is a stand-in for the BatchGetItem function that exists on the AWS DynamoDB Client
+type DynamoBatchGetItemAPI interface {
+	BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// DynamoBatchWriteItemAPI is a stand-in for the BatchWriteItem function that exists on the AWS DynamoDB Client
+type DynamoBatchWriteItemAPI interface {
+	BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// DynamoBatchAPI is the set of DynamoDB Client functions needed by BatchAddNotes
+type DynamoBatchAPI interface {
+	DynamoBatchGetItemAPI
+	DynamoBatchWriteItemAPI
+}
+
+// UnprocessedNoteError is returned for a Note that DynamoDB left unprocessed on every attempt, usually because the
+// table was throttled.
+type UnprocessedNoteError struct {
+	Owner, Title string
+	Attempts     int
+}
+
+func (e *UnprocessedNoteError) Error() string {
+	return fmt.Sprintf("note %q for owner %q was not processed after %d attempts", e.Title, e.Owner, e.Attempts)
+}
+
+// BatchAddNotes writes new Notes with BatchWriteItem in chunks of BatchWriteLimit.  The items of a BatchWriteItem
+// request cannot be conditional, so the Notes of a chunk are first looked up with BatchGetItem and the ones that already
+// exist are left as they are.  A Note created by another writer between the two requests is still overwritten.
+//
+// The returned slice holds an error for every Note, in the order given: nil when the Note was written, a
+// NoteExistsError when a Note with the same owner and title already exists, an UnprocessedNoteError when it was still
+// unprocessed after BatchWriteMaxAttempts, or a DynamoDBError when its request failed.  The Notes must have distinct
+// keys, DynamoDB rejects a chunk that reads or writes the same item twice.  When ctx is done the batch stops and every
+// Note that was not written holds the error that is also returned.
+func BatchAddNotes(ctx context.Context, api DynamoBatchAPI, tableName string, notes []schema.Note) ([]error, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	now := time.Now().UnixMilli()
+	results := make([]error, len(notes))
+	for start := 0; start < len(notes); start += BatchWriteLimit {
+		end := start + BatchWriteLimit
+		if end > len(notes) {
+			end = len(notes)
+		}
+		if err := batchWriteChunk(ctx, api, tableName, notes[start:end], now, results[start:end]); err != nil {
+			for i := end; i < len(notes); i++ {
+				results[i] = err
+			}
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// batchWriteChunk writes the Notes of a chunk that do not exist yet, retrying UnprocessedItems with exponential backoff
+// and recording the outcome of each Note in results.  Only a marshalling error or ctx being done stops the whole batch,
+// the error is then recorded for every Note of the chunk that was not written.
+func batchWriteChunk(ctx context.Context, api DynamoBatchAPI, tableName string, notes []schema.Note, now int64, results []error) error {
+	pending := make(map[string]int, len(notes))
+	for i := range notes {
+		pending[batchKey(notes[i].Owner, notes[i].Title)] = i
+	}
+	fail := func(err error) error {
+		for _, i := range pending {
+			results[i] = err
+		}
+		return err
+	}
+	if err := batchSkipExisting(ctx, api, tableName, notes, pending, results); err != nil {
+		return fail(err)
+	}
+	requests := make([]types.WriteRequest, 0, len(pending))
+	for i := range notes {
+		if _, ok := pending[batchKey(notes[i].Owner, notes[i].Title)]; !ok {
+			continue
+		}
+		item, err := batchItem(notes[i], now)
+		if err != nil {
+			return fail(err)
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	for attempt := 1; len(requests) > 0; attempt++ {
+		log.Printf("writing %d notes to %s (attempt %d)\n", len(requests), tableName, attempt)
+		output, err := api.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{tableName: requests},
+		})
+		if err != nil {
+			for _, i := range pending {
+				results[i] = wrapClientError(err)
+			}
+			return nil
+		}
+		requests = output.UnprocessedItems[tableName]
+		unprocessed := make(map[string]int, len(requests))
+		for _, request := range requests {
+			if request.PutRequest == nil {
+				continue
+			}
+			k, err := batchItemKey(request.PutRequest.Item)
+			if err != nil {
+				return err
+			}
+			if i, ok := pending[k]; ok {
+				unprocessed[k] = i
+			}
+		}
+		pending = unprocessed
+		if len(pending) > 0 && attempt == BatchWriteMaxAttempts {
+			for _, i := range pending {
+				results[i] = &UnprocessedNoteError{Owner: notes[i].Owner, Title: notes[i].Title, Attempts: attempt}
+			}
+			return nil
+		}
+		if len(pending) > 0 {
+			if err = batchWait(ctx, attempt, len(pending)); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	return nil
+}
+
+// batchSkipExisting looks up the pending Notes with BatchGetItem, retrying UnprocessedKeys with exponential backoff.
+// Notes that already exist, that could not be looked up or that were still unprocessed after BatchWriteMaxAttempts are
+// removed from pending with their error recorded in results.  Only ctx being done or a malformed response returns an
+// error.
+func batchSkipExisting(ctx context.Context, api DynamoBatchGetItemAPI, tableName string, notes []schema.Note, pending map[string]int, results []error) error {
+	keys := make([]map[string]types.AttributeValue, 0, len(notes))
+	for i := range notes {
+		key, err := noteKey(notes[i].Owner, notes[i].Title)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	// only the key is needed to tell that a Note exists
+	request := types.KeysAndAttributes{
+		Keys:                     keys,
+		ProjectionExpression:     aws.String("#owner, #title"),
+		ExpressionAttributeNames: map[string]string{"#owner": "owner", "#title": "title"},
+	}
+	unread := make(map[string]int, len(pending))
+	for k, i := range pending {
+		unread[k] = i
+	}
+	skip := func(k string, err error) {
+		results[unread[k]] = err
+		delete(pending, k)
+		delete(unread, k)
+	}
+
+	for attempt := 1; len(request.Keys) > 0; attempt++ {
+		log.Printf("looking up %d notes in %s (attempt %d)\n", len(request.Keys), tableName, attempt)
+		output, err := api.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{tableName: request},
+		})
+		if err != nil {
+			for k := range unread {
+				skip(k, wrapClientError(err))
+			}
+			return nil
+		}
+		for _, item := range output.Responses[tableName] {
+			k, err := batchItemKey(item)
+			if err != nil {
+				return err
+			}
+			if i, ok := unread[k]; ok {
+				skip(k, &NoteExistsError{Owner: notes[i].Owner, Title: notes[i].Title})
+			}
+		}
+		request = output.UnprocessedKeys[tableName]
+		unprocessed := make(map[string]int, len(request.Keys))
+		for _, key := range request.Keys {
+			k, err := batchItemKey(key)
+			if err != nil {
+				return err
+			}
+			if i, ok := unread[k]; ok {
+				unprocessed[k] = i
+			}
+		}
+		// the Notes that were read without an item do not exist
+		unread = unprocessed
+		if len(unread) > 0 && attempt == BatchWriteMaxAttempts {
+			for k, i := range unread {
+				skip(k, &UnprocessedNoteError{Owner: notes[i].Owner, Title: notes[i].Title, Attempts: attempt})
+			}
+			return nil
+		}
+		if len(unread) > 0 {
+			if err = batchWait(ctx, attempt, len(unread)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// batchWait waits before the next attempt of a chunk, doubling batchRetryDelay with every attempt.  It returns ctx.Err()
+// when ctx is done first.
+func batchWait(ctx context.Context, attempt, unprocessed int) error {
+	delay := batchRetryDelay << (attempt - 1)
+	log.Printf("%d notes were not processed, retrying in %s\n", unprocessed, delay)
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// batchItem is the full item written for a Note by BatchAddNotes, with the attributes buildUpdateExpression sets for a
+// new Note
+func batchItem(note schema.Note, now int64) (map[string]types.AttributeValue, error) {
+	note.Timestamp = now
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	note.ExpiresAt = schema.ExpiresAtFromTimestamp(now)
+	note.Version = 1
+	item, err := attributevalue.MarshalMap(note)
+	if err != nil {
+		return nil, err
+	}
+	item[schema.RecentNotesPartitionAttribute] = &types.AttributeValueMemberS{Value: schema.RecentNotesPartition}
+	return item, nil
+}
+
+// batchItemKey is the batchKey of an item or primary key returned by DynamoDB
+func batchItemKey(item map[string]types.AttributeValue) (string, error) {
+	var key schema.Note
+	if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+		return "", err
+	}
+	return batchKey(key.Owner, key.Title), nil
+}
+
+// batchKey identifies a Note within a batch
+func batchKey(owner, title string) string {
+	return owner + "\x00" + title
+}
@@ -0,0 +1,281 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"testing"
+	"time"
+)
+
+type mockDynamoBatchWriteItemAPI func(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+
+func (m mockDynamoBatchWriteItemAPI) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	return m(ctx, input, optFns...)
+}
+
+type mockDynamoBatchGetItemAPI func(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+
+func (m mockDynamoBatchGetItemAPI) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return m(ctx, input, optFns...)
+}
+
+// batchAPI combines the BatchGetItem and BatchWriteItem of different clients
+type batchAPI struct {
+	DynamoBatchGetItemAPI
+	DynamoBatchWriteItemAPI
+}
+
+func TestBatchAddNotes(t *testing.T) {
+	defer func(delay time.Duration) { batchRetryDelay = delay }(batchRetryDelay)
+	batchRetryDelay = time.Millisecond
+	var notes []schema.Note
+	for i := 0; i < 60; i++ {
+		notes = append(notes, schema.Note{Owner: fmt.Sprintf("owner-%d", i%3), Title: fmt.Sprintf("title-%d", i), Message: "message"})
+	}
+
+	cases := map[string]struct {
+		// wrap returns the API under test, counting its BatchWriteItem calls, given the fake holding the table
+		wrap              func(api *ddbfake.Client, calls *int) DynamoBatchAPI
+		expectedCalls     int
+		expectedWritten   int
+		expectedErrorType func(err error) bool
+	}{
+		"every note is written in chunks": {
+			wrap:            func(api *ddbfake.Client, calls *int) DynamoBatchAPI { return batchAPI{api, counting(api, calls)} },
+			expectedCalls:   3,
+			expectedWritten: 60,
+		},
+		"unprocessed items are retried": {
+			wrap: func(api *ddbfake.Client, calls *int) DynamoBatchAPI {
+				return batchAPI{api, counting(mockDynamoBatchWriteItemAPI(func(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+					return leaveUnprocessed(ctx, api, input, *calls%2 == 1)
+				}), calls)}
+			},
+			expectedCalls:   6,
+			expectedWritten: 60,
+		},
+		"items that are never processed fail": {
+			wrap: func(api *ddbfake.Client, calls *int) DynamoBatchAPI {
+				return batchAPI{api, counting(mockDynamoBatchWriteItemAPI(func(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+					return leaveUnprocessed(ctx, api, input, true)
+				}), calls)}
+			},
+			expectedCalls:   3 * BatchWriteMaxAttempts,
+			expectedWritten: 57,
+			expectedErrorType: func(err error) bool {
+				var uerr *UnprocessedNoteError
+				return errors.As(err, &uerr) && uerr.Attempts == BatchWriteMaxAttempts
+			},
+		},
+		"unprocessed keys are looked up again": {
+			wrap: func(api *ddbfake.Client, calls *int) DynamoBatchAPI {
+				lookups := 0
+				return batchAPI{mockDynamoBatchGetItemAPI(func(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+					lookups++
+					return leaveKeysUnprocessed(ctx, api, input, lookups%2 == 1)
+				}), counting(api, calls)}
+			},
+			expectedCalls:   3,
+			expectedWritten: 60,
+		},
+		"keys that are never processed fail": {
+			wrap: func(api *ddbfake.Client, calls *int) DynamoBatchAPI {
+				return batchAPI{mockDynamoBatchGetItemAPI(func(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+					return leaveKeysUnprocessed(ctx, api, input, true)
+				}), counting(api, calls)}
+			},
+			expectedCalls:   3,
+			expectedWritten: 57,
+			expectedErrorType: func(err error) bool {
+				var uerr *UnprocessedNoteError
+				return errors.As(err, &uerr) && uerr.Attempts == BatchWriteMaxAttempts
+			},
+		},
+		"lookup errors fail the chunk": {
+			wrap: func(api *ddbfake.Client, calls *int) DynamoBatchAPI {
+				lookups := 0
+				return batchAPI{mockDynamoBatchGetItemAPI(func(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+					if lookups++; lookups == 2 {
+						return nil, errors.New("throttled")
+					}
+					return api.BatchGetItem(ctx, input, optFns...)
+				}), counting(api, calls)}
+			},
+			expectedCalls:   2,
+			expectedWritten: 35,
+			expectedErrorType: func(err error) bool {
+				var derr *DynamoDBError
+				return errors.As(err, &derr)
+			},
+		},
+		"client errors fail the chunk": {
+			wrap: func(api *ddbfake.Client, calls *int) DynamoBatchAPI {
+				return batchAPI{api, counting(mockDynamoBatchWriteItemAPI(func(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+					if *calls == 2 {
+						return nil, errors.New("throttled")
+					}
+					return api.BatchWriteItem(ctx, input, optFns...)
+				}), calls)}
+			},
+			expectedCalls:   3,
+			expectedWritten: 35,
+			expectedErrorType: func(err error) bool {
+				var derr *DynamoDBError
+				return errors.As(err, &derr)
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake := ddbfake.NewNotesTable("notes")
+			calls := 0
+
+			results, err := BatchAddNotes(context.Background(), tt.wrap(fake, &calls), "notes", notes)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %d calls but got %d", tt.expectedCalls, calls)
+			}
+			written := 0
+			for i, result := range results {
+				if result == nil {
+					written++
+				} else if tt.expectedErrorType == nil || !tt.expectedErrorType(result) {
+					t.Errorf("unexpected error for note %d: %s", i, result)
+				}
+			}
+			if written != tt.expectedWritten || len(fake.Items("notes")) != tt.expectedWritten {
+				t.Errorf("expected %d notes to be written but got %d results and %d items", tt.expectedWritten, written, len(fake.Items("notes")))
+			}
+		})
+	}
+}
+
+func TestBatchAddNotes_DoesNotOverwriteNotes(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable("notes")
+	if _, err := AddNote(ctx, api, "notes", &schema.Note{Owner: "a", Title: "1", Message: "old"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := AddNote(ctx, api, "notes", &schema.Note{Owner: "a", Title: "1", Message: "older"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	results, err := BatchAddNotes(ctx, api, "notes", []schema.Note{{Owner: "a", Title: "1", Message: "new"}, {Owner: "b", Title: "1", Message: "new"}})
+
+	if err != nil || results[1] != nil {
+		t.Fatalf("unexpected errors: %v %v", err, results)
+	}
+	var eerr *NoteExistsError
+	if !errors.As(results[0], &eerr) || eerr.Owner != "a" || eerr.Title != "1" {
+		t.Errorf("expected a NoteExistsError for the existing note but got %v", results[0])
+	}
+	existing, err := GetNote(ctx, api, "notes", "a", "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if existing.Message != "older" || existing.Version != 2 {
+		t.Errorf("expected the existing note to be kept but got %+v", existing)
+	}
+	page, err := FindRecentNotesPage(ctx, api, "notes", 0, PageRequest{SigningKey: []byte("secret")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(page.Notes) != 2 {
+		t.Fatalf("expected both notes in the recent notes index but got %+v", page.Notes)
+	}
+	created, err := GetNote(ctx, api, "notes", "b", "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if created.Message != "new" || created.Version != 1 || created.CreatedAt == 0 || created.UpdatedAt != created.Timestamp ||
+		created.ExpiresAt != created.Timestamp/1000 {
+		t.Errorf("unexpected note: %+v", created)
+	}
+	if _, err = BatchAddNotes(ctx, api, "", nil); err == nil {
+		t.Errorf("expected an error for a missing table name")
+	}
+}
+
+func TestBatchAddNotes_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	api := batchAPI{mockDynamoBatchGetItemAPI(func(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+		return &dynamodb.BatchGetItemOutput{UnprocessedKeys: input.RequestItems}, nil
+	}), ddbfake.NewNotesTable("notes")}
+	notes := []schema.Note{{Owner: "a", Title: "1", Message: "new"}}
+
+	results, err := BatchAddNotes(ctx, api, "notes", notes)
+
+	if !errors.Is(err, context.Canceled) || len(results) != 1 || !errors.Is(results[0], context.Canceled) {
+		t.Errorf("expected the batch to stop with %v but got %v %v", context.Canceled, err, results)
+	}
+}
+
+// counting counts the calls made to api
+func counting(api DynamoBatchWriteItemAPI, calls *int) DynamoBatchWriteItemAPI {
+	return mockDynamoBatchWriteItemAPI(func(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+		*calls++
+		return api.BatchWriteItem(ctx, input, optFns...)
+	})
+}
+
+// leaveUnprocessed writes the request with the fake, returning the last item of every table as unprocessed when skip is
+// true instead of writing it
+func leaveUnprocessed(ctx context.Context, api *ddbfake.Client, input *dynamodb.BatchWriteItemInput, skip bool) (*dynamodb.BatchWriteItemOutput, error) {
+	if !skip {
+		return api.BatchWriteItem(ctx, input)
+	}
+	processed := make(map[string][]types.WriteRequest)
+	unprocessed := make(map[string][]types.WriteRequest)
+	for table, requests := range input.RequestItems {
+		last := len(requests) - 1
+		unprocessed[table] = requests[last:]
+		if last > 0 {
+			processed[table] = requests[:last]
+		}
+	}
+	if len(processed) > 0 {
+		if _, err := api.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: processed}); err != nil {
+			return nil, err
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
+}
+
+// leaveKeysUnprocessed looks up the request with the fake, returning the last key of every table as unprocessed when
+// skip is true instead of looking it up
+func leaveKeysUnprocessed(ctx context.Context, api *ddbfake.Client, input *dynamodb.BatchGetItemInput, skip bool) (*dynamodb.BatchGetItemOutput, error) {
+	if !skip {
+		return api.BatchGetItem(ctx, input)
+	}
+	processed := make(map[string]types.KeysAndAttributes)
+	unprocessed := make(map[string]types.KeysAndAttributes)
+	for table, request := range input.RequestItems {
+		last := len(request.Keys) - 1
+		rest := request
+		rest.Keys = request.Keys[last:]
+		unprocessed[table] = rest
+		if last > 0 {
+			request.Keys = request.Keys[:last]
+			processed[table] = request
+		}
+	}
+	output := &dynamodb.BatchGetItemOutput{UnprocessedKeys: unprocessed}
+	if len(processed) > 0 {
+		read, err := api.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: processed})
+		if err != nil {
+			return nil, err
+		}
+		output.Responses = read.Responses
+	}
+	return output, nil
+}
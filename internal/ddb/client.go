@@ -6,6 +6,7 @@ package ddb
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/akijowski/tweek-2021-sam/internal/schema"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -17,10 +18,32 @@ import (
 )
 
 const (
-	TableScanLimit = int32(25)
+	TableScanLimit  = int32(25)
 	TableQueryLimit = int32(25)
+	// MaxPageLimit is the largest page size a caller may request through a PageRequest
+	MaxPageLimit = int32(100)
+	// AnyVersion can be given to UpdateNote to skip the version check
+	AnyVersion = int64(-1)
 )
 
+// PageRequest describes a single page of results.
+//
+// A zero Limit uses the default limit for the operation and an empty Cursor starts from the beginning of the results.
+// The SigningKey is used to verify the Cursor and to sign the next one.
+type PageRequest struct {
+	Limit      int32
+	Cursor     string
+	SigningKey []byte
+}
+
+// NotesPage is a page of Notes along with the cursor for the following page.
+//
+// NextCursor is empty when there are no more results.
+type NotesPage struct {
+	Notes      []schema.Note
+	NextCursor string
+}
+
 // DynamoUpdateItemAPI is a stand-in for the UpdateItem function that exists on the AWS DynamoDB Client
 type DynamoUpdateItemAPI interface {
 	UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
@@ -36,33 +59,95 @@ type DynamoQueryAPI interface {
 	Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.QueryOutput, error)
 }
 
+// DynamoGetItemAPI is a stand-in for the GetItem function that exists on the AWS DynamoDB Client
+type DynamoGetItemAPI interface {
+	GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// DynamoDeleteItemAPI is a stand-in for the DeleteItem function that exists on the AWS DynamoDB Client
+type DynamoDeleteItemAPI interface {
+	DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
 // DynamoDBError encapsulates client errors and returns a consistent error string
 type DynamoDBError struct {
 	ClientMessage string
+	err           error
 }
 
 func (e *DynamoDBError) Error() string { return "a DynamoDB error occurred" }
 
+func (e *DynamoDBError) Unwrap() error { return e.err }
+
+// NoteExistsError is returned when a Note already exists for the given primary key
+type NoteExistsError struct {
+	Owner string
+	Title string
+}
+
+func (e *NoteExistsError) Error() string {
+	return fmt.Sprintf("note %q already exists for owner %q", e.Title, e.Owner)
+}
+
+// PreconditionFailedError is returned when a conditional update does not match the stored version of a Note
+type PreconditionFailedError struct {
+	Owner string
+	Title string
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return fmt.Sprintf("note %q for owner %q does not match the expected version", e.Title, e.Owner)
+}
+
+// NoteNotFoundError is returned when no Note exists for the given primary key
+type NoteNotFoundError struct {
+	Owner string
+	Title string
+}
+
+func (e *NoteNotFoundError) Error() string {
+	return fmt.Sprintf("note %q not found for owner %q", e.Title, e.Owner)
+}
+
 // AddNote receives the schema.Note and calls the DynamoUpdateItemAPI.UpdateItem function, transforming the Note to the correct
-// dynamodb.UpdateItemInput struct.
+// dynamodb.UpdateItemInput struct.  An existing Note with the same owner and title is overwritten.
 //
 // The return value is the Owner of the Note
 func AddNote(ctx context.Context, api DynamoUpdateItemAPI, tableName string, note *schema.Note) (string, error) {
+	return writeNote(ctx, api, tableName, note, nil)
+}
+
+// CreateNote behaves like AddNote but will not overwrite an existing Note.
+//
+// A NoteExistsError is returned when a Note with the same owner and title already exists.
+func CreateNote(ctx context.Context, api DynamoUpdateItemAPI, tableName string, note *schema.Note) (string, error) {
+	condition := expression.AttributeNotExists(expression.Name("owner"))
+	owner, err := writeNote(ctx, api, tableName, note, &condition)
+	if isConditionalCheckFailed(err) {
+		return "", &NoteExistsError{Owner: note.Owner, Title: note.Title}
+	}
+	return owner, err
+}
+
+func writeNote(ctx context.Context, api DynamoUpdateItemAPI, tableName string, note *schema.Note, condition *expression.ConditionBuilder) (string, error) {
 
 	if tableName == "" {
 		return "", errors.New("tableName must be provided")
 	}
 
-	keys, err := attributevalue.MarshalMap(map[string]string{"owner": note.Owner, "title": note.Title})
+	keys, err := noteKey(note.Owner, note.Title)
 	if err != nil {
 		return "", err
 	}
 
 	log.Printf("writing %+v to %s", note, tableName)
-	expr, err := expression.
+	builder := expression.
 		NewBuilder().
-		WithUpdate(buildUpdateExpression(note)).
-		Build()
+		WithUpdate(buildUpdateExpression(note))
+	if condition != nil {
+		builder = builder.WithCondition(*condition)
+	}
+	expr, err := builder.Build()
 	if err != nil {
 		return "", err
 	}
@@ -71,6 +156,7 @@ func AddNote(ctx context.Context, api DynamoUpdateItemAPI, tableName string, not
 		TableName:                 aws.String(tableName),
 		Key:                       keys,
 		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		ReturnValues:              types.ReturnValueUpdatedNew,
@@ -79,69 +165,339 @@ func AddNote(ctx context.Context, api DynamoUpdateItemAPI, tableName string, not
 	log.Printf("input, %+v", input)
 	output, err := api.UpdateItem(ctx, input)
 	if err != nil {
-		return "", &DynamoDBError{ClientMessage: err.Error()}
+		return "", wrapClientError(err)
 	}
 	log.Printf("output, %+v", output)
 	return note.Owner, nil
 }
 
-// Scan calls the DynamoScanAPI.Scan function, returning a []schema.Note.
+// UpdateNote calls the DynamoUpdateItemAPI.UpdateItem function, replacing the message of an existing Note only when its
+// stored version equals expectedVersion.  AnyVersion skips the version check, and a zero expectedVersion matches Notes
+// written before versions were recorded.
+//
+// The updated schema.Note is returned.  A PreconditionFailedError is returned when the Note does not exist or its version
+// does not match.
+func UpdateNote(ctx context.Context, api DynamoUpdateItemAPI, tableName string, note *schema.Note, expectedVersion int64) (*schema.Note, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	keys, err := noteKey(note.Owner, note.Title)
+	if err != nil {
+		return nil, err
+	}
+	condition := expression.AttributeExists(expression.Name("owner"))
+	if expectedVersion != AnyVersion {
+		condition = condition.And(versionCondition(expectedVersion))
+	}
+	expr, err := expression.NewBuilder().
+		WithUpdate(buildUpdateExpression(note)).
+		WithCondition(condition).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("updating %+v in %s (expected version: %d)", note, tableName, expectedVersion)
+	output, err := api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       keys,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if isConditionalCheckFailed(err) {
+		return nil, &PreconditionFailedError{Owner: note.Owner, Title: note.Title}
+	} else if err != nil {
+		return nil, wrapClientError(err)
+	}
+	var updated schema.Note
+	if err = attributevalue.UnmarshalMap(output.Attributes, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// GetNote calls the DynamoGetItemAPI.GetItem function, returning the schema.Note with the given owner and title.
+//
+// A NoteNotFoundError is returned when the Note does not exist.
+func GetNote(ctx context.Context, api DynamoGetItemAPI, tableName, owner, title string) (*schema.Note, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	if owner == "" || title == "" {
+		return nil, errors.New("owner and title must be provided")
+	}
+	keys, err := noteKey(owner, title)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("getting note %q for owner %q\n", title, owner)
+	output, err := api.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       keys,
+	})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	if len(output.Item) == 0 {
+		return nil, &NoteNotFoundError{Owner: owner, Title: title}
+	}
+	var note schema.Note
+	if err = attributevalue.UnmarshalMap(output.Item, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// DeleteNote calls the DynamoDeleteItemAPI.DeleteItem function, removing the Note with the given owner and title.
+//
+// A NoteNotFoundError is returned when the Note does not exist.
+func DeleteNote(ctx context.Context, api DynamoDeleteItemAPI, tableName, owner, title string) error {
+	if tableName == "" {
+		return errors.New("tableName must be provided")
+	}
+	if owner == "" || title == "" {
+		return errors.New("owner and title must be provided")
+	}
+	keys, err := noteKey(owner, title)
+	if err != nil {
+		return err
+	}
+	log.Printf("deleting note %q for owner %q\n", title, owner)
+	output, err := api.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:    aws.String(tableName),
+		Key:          keys,
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return wrapClientError(err)
+	}
+	if len(output.Attributes) == 0 {
+		return &NoteNotFoundError{Owner: owner, Title: title}
+	}
+	return nil
+}
+
+// scanCursorScope is the scope of the cursors of ScanPage, see EncodeCursor
+const scanCursorScope = "scan"
+
+// firstPageSigningKey signs the cursors of Scan and FindNotesByOwner, which only return the first page and discard them
+var firstPageSigningKey = []byte("first-page")
+
+// Scan calls the DynamoScanAPI.Scan function, returning the first page of schema.Note.
 func Scan(ctx context.Context, api DynamoScanAPI, tableName string) ([]schema.Note, error) {
+	page, err := ScanPage(ctx, api, tableName, PageRequest{SigningKey: firstPageSigningKey})
+	if err != nil {
+		return nil, err
+	}
+	return page.Notes, nil
+}
+
+// ScanPage calls the DynamoScanAPI.Scan function, returning a single NotesPage starting at the PageRequest cursor.
+func ScanPage(ctx context.Context, api DynamoScanAPI, tableName string, page PageRequest) (*NotesPage, error) {
 	if tableName == "" {
 		return nil, errors.New("tableName must be provided")
 	}
-	log.Printf("scanning table (limit: %d)\n", TableScanLimit)
+	startKey, err := DecodeCursor(page.Cursor, scanCursorScope, page.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	limit := pageLimit(page.Limit, TableScanLimit)
+	log.Printf("scanning table (limit: %d)\n", limit)
 	output, err := api.Scan(ctx, &dynamodb.ScanInput{
-		TableName: aws.String(tableName),
-		Limit: aws.Int32(TableScanLimit),
+		TableName:         aws.String(tableName),
+		Limit:             aws.Int32(limit),
+		ExclusiveStartKey: startKey,
 	})
 	if err != nil {
-		return nil, &DynamoDBError{ClientMessage: err.Error()}
+		return nil, wrapClientError(err)
 	}
 	log.Printf("scanned %d items\n", output.ScannedCount)
-	var notes []schema.Note
-	if err = attributevalue.UnmarshalListOfMaps(output.Items, &notes); err != nil {
+	return buildNotesPage(output.Items, output.LastEvaluatedKey, scanCursorScope, page.SigningKey)
+}
+
+// ScanNotesSincePage is ScanPage for the Notes updated after since in epoch millis, reading timestamps recorded in either
+// epoch seconds or millis.  Unlike FindRecentNotesPage it finds Notes that are not in the schema.RecentNotesIndexName
+// index yet, in no particular order.
+func ScanNotesSincePage(ctx context.Context, api DynamoScanAPI, tableName string, since int64, page PageRequest) (*NotesPage, error) {
+	if since == 0 {
+		return ScanPage(ctx, api, tableName, page)
+	}
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	scope := fmt.Sprintf("%s:%d", scanCursorScope, since)
+	startKey, err := DecodeCursor(page.Cursor, scope, page.SigningKey)
+	if err != nil {
 		return nil, err
 	}
-	return notes, nil
+	timestamp := expression.Name("timestamp")
+	expr, err := expression.NewBuilder().
+		WithFilter(timestamp.GreaterThan(expression.Value(since)).
+			Or(timestamp.GreaterThan(expression.Value(since / 1000)).
+				And(timestamp.LessThan(expression.Value(schema.SecondTimestampLimit))))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	limit := pageLimit(page.Limit, TableScanLimit)
+	log.Printf("scanning table for notes since %d (limit: %d)\n", since, limit)
+	output, err := api.Scan(ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		Limit:                     aws.Int32(limit),
+		ExclusiveStartKey:         startKey,
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	log.Printf("scanned %d items\n", output.ScannedCount)
+	return buildNotesPage(output.Items, output.LastEvaluatedKey, scope, page.SigningKey)
 }
 
-// FindNotesByOwner calls the DynamoQueryAPI.Query function, returning a []schema.Note for the given owner.
+// FindNotesByOwner calls the DynamoQueryAPI.Query function, returning the first page of schema.Note for the given owner.
 func FindNotesByOwner(ctx context.Context, api DynamoQueryAPI, tableName, owner string) ([]schema.Note, error) {
+	page, err := FindNotesByOwnerPage(ctx, api, tableName, owner, PageRequest{SigningKey: firstPageSigningKey})
+	if err != nil {
+		return nil, err
+	}
+	return page.Notes, nil
+}
+
+// FindNotesByOwnerPage calls the DynamoQueryAPI.Query function, returning a single NotesPage for the given owner starting
+// at the PageRequest cursor.
+func FindNotesByOwnerPage(ctx context.Context, api DynamoQueryAPI, tableName, owner string, page PageRequest) (*NotesPage, error) {
 	if tableName == "" {
 		return nil, errors.New("tableName must be provided")
 	}
 	if owner == "" {
 		return nil, errors.New("owner must be provided")
 	}
+	scope := "owner:" + owner
+	startKey, err := DecodeCursor(page.Cursor, scope, page.SigningKey)
+	if err != nil {
+		return nil, err
+	}
 	expr, err := expression.NewBuilder().
 		WithKeyCondition(expression.KeyEqual(expression.Key("owner"), expression.Value(owner))).
 		Build()
 	if err != nil {
 		return nil, err
 	}
+	limit := pageLimit(page.Limit, TableQueryLimit)
 	input := &dynamodb.QueryInput{
-		TableName: aws.String(tableName),
-		Limit: aws.Int32(TableQueryLimit),
-		ExpressionAttributeNames: expr.Names(),
+		TableName:                 aws.String(tableName),
+		Limit:                     aws.Int32(limit),
+		ExclusiveStartKey:         startKey,
+		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
-		KeyConditionExpression: expr.KeyCondition(),
+		KeyConditionExpression:    expr.KeyCondition(),
 	}
-	log.Printf("querying for owner %q (limit: %d)\n", owner, TableQueryLimit)
+	log.Printf("querying for owner %q (limit: %d)\n", owner, limit)
 	output, err := api.Query(ctx, input)
 	if err != nil {
-		return nil, &DynamoDBError{ClientMessage: err.Error()}
+		return nil, wrapClientError(err)
 	}
 	log.Printf("scanned %d items\n", output.ScannedCount)
-	var notes []schema.Note
-	if err = attributevalue.UnmarshalListOfMaps(output.Items, &notes); err != nil {
+	return buildNotesPage(output.Items, output.LastEvaluatedKey, scope, page.SigningKey)
+}
+
+// FindRecentNotesPage calls the DynamoQueryAPI.Query function on the schema.RecentNotesIndexName index, returning a single
+// NotesPage of the most recently updated Notes across every owner, starting at the PageRequest cursor.  When since is not
+// zero only Notes updated after that time in epoch millis are returned.
+func FindRecentNotesPage(ctx context.Context, api DynamoQueryAPI, tableName string, since int64, page PageRequest) (*NotesPage, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	// the key of a page is outside the key condition of another since, which DynamoDB refuses
+	scope := fmt.Sprintf("recent:%d", since)
+	startKey, err := DecodeCursor(page.Cursor, scope, page.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	keyCondition := expression.KeyEqual(expression.Key(schema.RecentNotesPartitionAttribute), expression.Value(schema.RecentNotesPartition))
+	if since != 0 {
+		keyCondition = keyCondition.And(expression.KeyGreaterThan(expression.Key("updated_at"), expression.Value(since)))
+	}
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
 		return nil, err
 	}
-	return notes, nil
+	limit := pageLimit(page.Limit, TableQueryLimit)
+	log.Printf("querying for recent notes since %d (limit: %d)\n", since, limit)
+	output, err := api.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		IndexName:                 aws.String(schema.RecentNotesIndexName),
+		Limit:                     aws.Int32(limit),
+		ScanIndexForward:          aws.Bool(false),
+		ExclusiveStartKey:         startKey,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+	})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	log.Printf("scanned %d items\n", output.ScannedCount)
+	return buildNotesPage(output.Items, output.LastEvaluatedKey, scope, page.SigningKey)
 }
 
+// buildUpdateExpression writes the message and records the time of the write.  created_at is only set by the first write
+// of a Note, so it survives every later update.  The partition attribute places the Note in the schema.RecentNotesIndexName
+// index.
 func buildUpdateExpression(note *schema.Note) expression.UpdateBuilder {
+	millis := time.Now().UnixMilli()
+	now := expression.Value(millis)
 	return expression.
 		Set(expression.Name("message"), expression.Value(note.Message)).
-		Set(expression.Name("timestamp"), expression.Value(time.Now().Unix()))
+		Set(expression.Name("timestamp"), now).
+		Set(expression.Name("expires_at"), expression.Value(schema.ExpiresAtFromTimestamp(millis))).
+		Set(expression.Name("updated_at"), now).
+		Set(expression.Name(schema.RecentNotesPartitionAttribute), expression.Value(schema.RecentNotesPartition)).
+		Set(expression.Name("created_at"), expression.Name("created_at").IfNotExists(now)).
+		Add(expression.Name("version"), expression.Value(1))
+}
+
+// wrapClientError wraps an error returned by the DynamoDB Client in a DynamoDBError, keeping the original error available
+// to errors.As so that specific service exceptions can still be identified.
+func wrapClientError(err error) error {
+	return &DynamoDBError{ClientMessage: err.Error(), err: err}
+}
+
+// isConditionalCheckFailed reports whether the error was caused by a ConditionExpression evaluating to false
+func isConditionalCheckFailed(err error) bool {
+	var ccf *types.ConditionalCheckFailedException
+	return errors.As(err, &ccf)
+}
+
+// noteKey builds the primary key described by schema.NotesKeySchema
+func noteKey(owner, title string) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMap(map[string]string{"owner": owner, "title": title})
+}
+
+// pageLimit applies the default limit when none was requested and caps the limit at MaxPageLimit.
+func pageLimit(requested, defaultLimit int32) int32 {
+	if requested <= 0 {
+		return defaultLimit
+	}
+	if requested > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return requested
+}
+
+func buildNotesPage(items []map[string]types.AttributeValue, lastKey map[string]types.AttributeValue, scope string, signingKey []byte) (*NotesPage, error) {
+	var notes []schema.Note
+	if err := attributevalue.UnmarshalListOfMaps(items, &notes); err != nil {
+		return nil, err
+	}
+	cursor, err := EncodeCursor(lastKey, scope, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return &NotesPage{Notes: notes, NextCursor: cursor}, nil
 }
@@ -159,6 +159,51 @@ func TestScan_IntegrationTest(t *testing.T) {
 	}
 }
 
+func TestScanAll_IntegrationTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+	name := fmt.Sprintf("scan-all-%s-%d", *tableName, rand.Int31())
+	if err := createTable(ctx, name); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() {
+		if err := deleteTable(ctx, name); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}()
+	var expectedNotes []schema.Note
+	for i := 0; i < 20; i++ {
+		expectedNotes = append(expectedNotes, schema.Note{Owner: fmt.Sprintf("owner%d", i%5), Title: fmt.Sprintf("title%d", i)})
+	}
+	if err := saveToTable(ctx, name, expectedNotes); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	notes := make(chan schema.Note)
+	received := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range notes {
+			received++
+		}
+	}()
+	summary, err := ScanAll(ctx, dynamoClient, name, ScanAllRequest{TotalSegments: 3, PageLimit: 4}, notes)
+	<-done
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if received != len(expectedNotes) || summary.Count != int64(len(expectedNotes)) {
+		t.Errorf("incorrect number of notes: wanted %d got %d (summary %+v)", len(expectedNotes), received, summary)
+	}
+	if summary.ConsumedCapacity <= 0 {
+		t.Errorf("expected consumed capacity to be reported but got %+v", summary)
+	}
+}
+
 func TestFindNotesByOwner_IntegrationTest(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -287,34 +332,17 @@ func createDynamoConfig(ctx context.Context) (aws.Config, error) {
 }
 
 func createTable(ctx context.Context, tableName string) error {
-	fmt.Printf("creating table: %s\n", tableName)
-	if _, err := dynamoClient.CreateTable(ctx, &dynamodb.CreateTableInput{
-		TableName:             aws.String(tableName),
-		KeySchema:             schema.NotesKeySchema,
-		AttributeDefinitions:  schema.NotesAttributeDefinitions,
-		ProvisionedThroughput: schema.NotesProvisionedThroughput,
-	}); err != nil {
+	if _, err := CreateNotesTable(ctx, dynamoClient, tableName); err != nil {
 		return err
 	}
-	fmt.Printf("waiting for %q to become ACTIVE\n", tableName)
-	waiter := dynamodb.NewTableExistsWaiter(dynamoClient, func(opts *dynamodb.TableExistsWaiterOptions) {
-		opts.LogWaitAttempts = true
-	})
-	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, 3*time.Minute)
+	return WaitForTable(ctx, dynamoClient, tableName, 3*time.Minute)
 }
 
 func deleteTable(ctx context.Context, tableName string) error {
-	fmt.Printf("deleting table: %s\n", tableName)
-	if _, err := dynamoClient.DeleteTable(ctx, &dynamodb.DeleteTableInput{
-		TableName: aws.String(tableName),
-	}); err != nil {
+	if _, err := DeleteTable(ctx, dynamoClient, tableName); err != nil {
 		return err
 	}
-	fmt.Printf("waiting for table %q to be removed\n", tableName)
-	waiter := dynamodb.NewTableNotExistsWaiter(dynamoClient, func(opts *dynamodb.TableNotExistsWaiterOptions) {
-		opts.LogWaitAttempts = true
-	})
-	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, 3*time.Minute)
+	return WaitForTableDeleted(ctx, dynamoClient, tableName, 3*time.Minute)
 }
 
 func saveToTable(ctx context.Context, tableName string, notes []schema.Note) error {
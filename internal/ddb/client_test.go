@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
 	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,6 +35,18 @@ func (m mockDynamoQueryAPI) Query(ctx context.Context, input *dynamodb.QueryInpu
 	return m(ctx, input, optFns...)
 }
 
+type mockDynamoGetItemAPI func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+
+func (m mockDynamoGetItemAPI) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return m(ctx, input, optFns...)
+}
+
+type mockDynamoDeleteItemAPI func(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+
+func (m mockDynamoDeleteItemAPI) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return m(ctx, input, optFns...)
+}
+
 func TestAddNote(t *testing.T) {
 	cases := map[string]struct {
 		clientBuilder func(t *testing.T, expectedNote *schema.Note, expectedError error) DynamoUpdateItemAPI
@@ -108,6 +124,338 @@ func TestAddNote(t *testing.T) {
 	}
 }
 
+func TestCreateNote(t *testing.T) {
+	note := &schema.Note{
+		Owner:   "foo",
+		Title:   "titlefoo",
+		Message: "messagefoo",
+	}
+
+	cases := map[string]struct {
+		clientBuilder func(t *testing.T) DynamoUpdateItemAPI
+		expectedErr   error
+	}{
+		"new note is created with a condition": {
+			clientBuilder: func(t *testing.T) DynamoUpdateItemAPI {
+				return mockDynamoUpdateItemAPI(func(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					validateUpdateInputKey(t, note, input.Key)
+					if input.ConditionExpression == nil || !strings.Contains(*input.ConditionExpression, "attribute_not_exists") {
+						t.Fatalf("unexpected condition expression: %v", input.ConditionExpression)
+					}
+					return &dynamodb.UpdateItemOutput{}, nil
+				})
+			},
+		},
+		"failed condition returns note exists error": {
+			clientBuilder: func(t *testing.T) DynamoUpdateItemAPI {
+				return mockDynamoUpdateItemAPI(func(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+				})
+			},
+			expectedErr: &NoteExistsError{Owner: "foo", Title: "titlefoo"},
+		},
+		"returns dynamo error": {
+			clientBuilder: func(t *testing.T) DynamoUpdateItemAPI {
+				return mockDynamoUpdateItemAPI(func(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					return nil, errors.New("foo")
+				})
+			},
+			expectedErr: errors.New("a DynamoDB error occurred"),
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := tt.clientBuilder(t)
+
+			actual, err := CreateNote(ctx, api, "MY_TABLE", note)
+			if tt.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if actual != note.Owner {
+					t.Fatalf("unexpected result: wanted %q, got %q", note.Owner, actual)
+				}
+			} else {
+				if err == nil || err.Error() != tt.expectedErr.Error() {
+					t.Fatalf("unexpected error: wanted %q got %v", tt.expectedErr, err)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateNote(t *testing.T) {
+	note := &schema.Note{
+		Owner:   "foo",
+		Title:   "titlefoo",
+		Message: "updated",
+	}
+	updated, err := attributevalue.MarshalMap(&schema.Note{Owner: "foo", Title: "titlefoo", Message: "updated", Version: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]struct {
+		clientBuilder   func(t *testing.T) DynamoUpdateItemAPI
+		expectedVersion int64
+		expectedErr     error
+	}{
+		"matching version returns updated note": {
+			clientBuilder: func(t *testing.T) DynamoUpdateItemAPI {
+				return mockDynamoUpdateItemAPI(func(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					validateUpdateInputKey(t, note, input.Key)
+					if !isValueInExpression(input.ExpressionAttributeValues, &types.AttributeValueMemberN{Value: "2"}) {
+						t.Fatalf("expected version missing from condition values: %+v", input.ExpressionAttributeValues)
+					}
+					return &dynamodb.UpdateItemOutput{Attributes: updated}, nil
+				})
+			},
+			expectedVersion: 2,
+		},
+		"any version only checks existence": {
+			clientBuilder: func(t *testing.T) DynamoUpdateItemAPI {
+				return mockDynamoUpdateItemAPI(func(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					if *input.ConditionExpression != "attribute_exists (#0)" {
+						t.Fatalf("unexpected condition: %s", *input.ConditionExpression)
+					}
+					return &dynamodb.UpdateItemOutput{Attributes: updated}, nil
+				})
+			},
+			expectedVersion: AnyVersion,
+		},
+		"failed condition returns precondition failed": {
+			clientBuilder: func(t *testing.T) DynamoUpdateItemAPI {
+				return mockDynamoUpdateItemAPI(func(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+				})
+			},
+			expectedVersion: 1,
+			expectedErr:     &PreconditionFailedError{Owner: "foo", Title: "titlefoo"},
+		},
+		"returns dynamo error": {
+			clientBuilder: func(t *testing.T) DynamoUpdateItemAPI {
+				return mockDynamoUpdateItemAPI(func(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+					t.Helper()
+					return nil, errors.New("foo")
+				})
+			},
+			expectedVersion: 1,
+			expectedErr:     errors.New("a DynamoDB error occurred"),
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := tt.clientBuilder(t)
+
+			actual, err := UpdateNote(ctx, api, "MY_TABLE", note, tt.expectedVersion)
+			if tt.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if actual.Version != 3 || actual.Message != note.Message {
+					t.Fatalf("unexpected note: %+v", actual)
+				}
+			} else {
+				if err == nil || err.Error() != tt.expectedErr.Error() {
+					t.Fatalf("unexpected error: wanted %q got %v", tt.expectedErr, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetNote(t *testing.T) {
+	expectedNote := &schema.Note{
+		Owner:     "owner",
+		Title:     "title",
+		Message:   "message",
+		Timestamp: time.Now().UnixMilli(),
+	}
+	item, err := attributevalue.MarshalMap(expectedNote)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]struct {
+		clientBuilder func(t *testing.T) DynamoGetItemAPI
+		tableName     string
+		owner         string
+		title         string
+		expectedErr   error
+	}{
+		"valid request returns successfully": {
+			clientBuilder: func(t *testing.T) DynamoGetItemAPI {
+				return mockDynamoGetItemAPI(func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					validateUpdateInputKey(t, expectedNote, input.Key)
+					return &dynamodb.GetItemOutput{Item: item}, nil
+				})
+			},
+			tableName: "MY_TABLE",
+			owner:     "owner",
+			title:     "title",
+		},
+		"missing item returns not found": {
+			clientBuilder: func(t *testing.T) DynamoGetItemAPI {
+				return mockDynamoGetItemAPI(func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return &dynamodb.GetItemOutput{}, nil
+				})
+			},
+			tableName:   "MY_TABLE",
+			owner:       "owner",
+			title:       "title",
+			expectedErr: &NoteNotFoundError{Owner: "owner", Title: "title"},
+		},
+		"missing table name returns error": {
+			clientBuilder: func(t *testing.T) DynamoGetItemAPI {
+				return mockDynamoGetItemAPI(func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return nil, nil
+				})
+			},
+			owner:       "owner",
+			title:       "title",
+			expectedErr: errors.New("tableName must be provided"),
+		},
+		"missing title returns error": {
+			clientBuilder: func(t *testing.T) DynamoGetItemAPI {
+				return mockDynamoGetItemAPI(func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return nil, nil
+				})
+			},
+			tableName:   "MY_TABLE",
+			owner:       "owner",
+			expectedErr: errors.New("owner and title must be provided"),
+		},
+		"returns dynamo error": {
+			clientBuilder: func(t *testing.T) DynamoGetItemAPI {
+				return mockDynamoGetItemAPI(func(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					t.Helper()
+					return nil, errors.New("foo")
+				})
+			},
+			tableName:   "MY_TABLE",
+			owner:       "owner",
+			title:       "title",
+			expectedErr: errors.New("a DynamoDB error occurred"),
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := tt.clientBuilder(t)
+
+			actual, err := GetNote(ctx, api, tt.tableName, tt.owner, tt.title)
+			if tt.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !reflect.DeepEqual(actual, expectedNote) {
+					t.Fatalf("unexpected note: wanted %+v got %+v", expectedNote, actual)
+				}
+			} else {
+				if err.Error() != tt.expectedErr.Error() {
+					t.Fatalf("unexpected error: wanted %q got %s", tt.expectedErr, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteNote(t *testing.T) {
+	expectedNote := &schema.Note{Owner: "owner", Title: "title"}
+
+	cases := map[string]struct {
+		clientBuilder func(t *testing.T) DynamoDeleteItemAPI
+		tableName     string
+		owner         string
+		title         string
+		expectedErr   error
+	}{
+		"existing note is deleted": {
+			clientBuilder: func(t *testing.T) DynamoDeleteItemAPI {
+				return mockDynamoDeleteItemAPI(func(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+					t.Helper()
+					validateUpdateInputKey(t, expectedNote, input.Key)
+					if input.ReturnValues != types.ReturnValueAllOld {
+						t.Fatalf("unexpected return values: %q", input.ReturnValues)
+					}
+					return &dynamodb.DeleteItemOutput{Attributes: input.Key}, nil
+				})
+			},
+			tableName: "MY_TABLE",
+			owner:     "owner",
+			title:     "title",
+		},
+		"missing note returns not found": {
+			clientBuilder: func(t *testing.T) DynamoDeleteItemAPI {
+				return mockDynamoDeleteItemAPI(func(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+					t.Helper()
+					return &dynamodb.DeleteItemOutput{}, nil
+				})
+			},
+			tableName:   "MY_TABLE",
+			owner:       "owner",
+			title:       "title",
+			expectedErr: &NoteNotFoundError{Owner: "owner", Title: "title"},
+		},
+		"missing table name returns error": {
+			clientBuilder: func(t *testing.T) DynamoDeleteItemAPI {
+				return mockDynamoDeleteItemAPI(func(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+					t.Helper()
+					return nil, nil
+				})
+			},
+			owner:       "owner",
+			title:       "title",
+			expectedErr: errors.New("tableName must be provided"),
+		},
+		"returns dynamo error": {
+			clientBuilder: func(t *testing.T) DynamoDeleteItemAPI {
+				return mockDynamoDeleteItemAPI(func(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+					t.Helper()
+					return nil, errors.New("foo")
+				})
+			},
+			tableName:   "MY_TABLE",
+			owner:       "owner",
+			title:       "title",
+			expectedErr: errors.New("a DynamoDB error occurred"),
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := tt.clientBuilder(t)
+
+			err := DeleteNote(ctx, api, tt.tableName, tt.owner, tt.title)
+			if tt.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			} else {
+				if err == nil || err.Error() != tt.expectedErr.Error() {
+					t.Fatalf("unexpected error: wanted %q got %v", tt.expectedErr, err)
+				}
+			}
+		})
+	}
+}
+
 func TestScan(t *testing.T) {
 	validNotesResponses := []schema.Note{
 		{
@@ -301,6 +649,201 @@ func TestFindNotesByOwner(t *testing.T) {
 	}
 }
 
+func TestScanPage(t *testing.T) {
+	signingKey := []byte("secret")
+	lastKey := map[string]types.AttributeValue{
+		"owner": &types.AttributeValueMemberS{Value: "owner"},
+		"title": &types.AttributeValueMemberS{Value: "title"},
+	}
+	cursor, err := EncodeCursor(lastKey, scanCursorScope, signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	otherCursor, err := EncodeCursor(lastKey, "owner:owner", signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]struct {
+		clientBuilder  func(t *testing.T) DynamoScanAPI
+		page           PageRequest
+		expectedCursor string
+		expectedErr    error
+	}{
+		"last evaluated key returns next cursor": {
+			clientBuilder: func(t *testing.T) DynamoScanAPI {
+				return mockDynamoScanAPI(func(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+					t.Helper()
+					if *input.Limit != TableScanLimit {
+						t.Fatalf("unexpected limit: wanted %d got %d", TableScanLimit, *input.Limit)
+					}
+					if input.ExclusiveStartKey != nil {
+						t.Fatalf("unexpected start key: %+v", input.ExclusiveStartKey)
+					}
+					return &dynamodb.ScanOutput{LastEvaluatedKey: lastKey}, nil
+				})
+			},
+			page:           PageRequest{SigningKey: signingKey},
+			expectedCursor: cursor,
+		},
+		"cursor is used as exclusive start key": {
+			clientBuilder: func(t *testing.T) DynamoScanAPI {
+				return mockDynamoScanAPI(func(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+					t.Helper()
+					if *input.Limit != 10 {
+						t.Fatalf("unexpected limit: wanted %d got %d", 10, *input.Limit)
+					}
+					if !reflect.DeepEqual(input.ExclusiveStartKey, lastKey) {
+						t.Fatalf("unexpected start key: wanted %+v got %+v", lastKey, input.ExclusiveStartKey)
+					}
+					return &dynamodb.ScanOutput{}, nil
+				})
+			},
+			page: PageRequest{Limit: 10, Cursor: cursor, SigningKey: signingKey},
+		},
+		"limit is capped": {
+			clientBuilder: func(t *testing.T) DynamoScanAPI {
+				return mockDynamoScanAPI(func(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+					t.Helper()
+					if *input.Limit != MaxPageLimit {
+						t.Fatalf("unexpected limit: wanted %d got %d", MaxPageLimit, *input.Limit)
+					}
+					return &dynamodb.ScanOutput{}, nil
+				})
+			},
+			page: PageRequest{Limit: MaxPageLimit + 1, SigningKey: signingKey},
+		},
+		"invalid cursor returns error": {
+			clientBuilder: func(t *testing.T) DynamoScanAPI {
+				return mockDynamoScanAPI(func(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+					t.Helper()
+					t.Fatal("scan should not be called")
+					return nil, nil
+				})
+			},
+			page:        PageRequest{Cursor: cursor, SigningKey: []byte("other")},
+			expectedErr: ErrInvalidCursor,
+		},
+		"cursor of another listing returns error": {
+			clientBuilder: func(t *testing.T) DynamoScanAPI {
+				return mockDynamoScanAPI(func(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+					t.Helper()
+					t.Fatal("scan should not be called")
+					return nil, nil
+				})
+			},
+			page:        PageRequest{Cursor: otherCursor, SigningKey: signingKey},
+			expectedErr: ErrInvalidCursor,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := tt.clientBuilder(t)
+
+			page, err := ScanPage(ctx, api, "MY_TABLE", tt.page)
+			if tt.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if page.NextCursor != tt.expectedCursor {
+					t.Fatalf("unexpected cursor: wanted %q got %q", tt.expectedCursor, page.NextCursor)
+				}
+			} else if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("unexpected error: wanted %q got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFindNotesByOwnerPage(t *testing.T) {
+	signingKey := []byte("secret")
+	lastKey := map[string]types.AttributeValue{
+		"owner": &types.AttributeValueMemberS{Value: "owner"},
+		"title": &types.AttributeValueMemberS{Value: "title"},
+	}
+	cursor, err := EncodeCursor(lastKey, "owner:owner", signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	otherOwnerCursor, err := EncodeCursor(lastKey, "owner:other", signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]struct {
+		clientBuilder  func(t *testing.T) DynamoQueryAPI
+		page           PageRequest
+		expectedCursor string
+		expectedErr    error
+	}{
+		"last evaluated key returns next cursor": {
+			clientBuilder: func(t *testing.T) DynamoQueryAPI {
+				return mockDynamoQueryAPI(func(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					t.Helper()
+					return &dynamodb.QueryOutput{LastEvaluatedKey: lastKey}, nil
+				})
+			},
+			page:           PageRequest{SigningKey: signingKey},
+			expectedCursor: cursor,
+		},
+		"cursor is used as exclusive start key": {
+			clientBuilder: func(t *testing.T) DynamoQueryAPI {
+				return mockDynamoQueryAPI(func(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					t.Helper()
+					if !reflect.DeepEqual(input.ExclusiveStartKey, lastKey) {
+						t.Fatalf("unexpected start key: wanted %+v got %+v", lastKey, input.ExclusiveStartKey)
+					}
+					return &dynamodb.QueryOutput{}, nil
+				})
+			},
+			page: PageRequest{Cursor: cursor, SigningKey: signingKey},
+		},
+		"invalid cursor returns error": {
+			clientBuilder: func(t *testing.T) DynamoQueryAPI {
+				return mockDynamoQueryAPI(func(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					t.Helper()
+					t.Fatal("query should not be called")
+					return nil, nil
+				})
+			},
+			page:        PageRequest{Cursor: "garbage", SigningKey: signingKey},
+			expectedErr: ErrInvalidCursor,
+		},
+		"cursor of another owner returns error": {
+			clientBuilder: func(t *testing.T) DynamoQueryAPI {
+				return mockDynamoQueryAPI(func(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+					t.Helper()
+					t.Fatal("query should not be called")
+					return nil, nil
+				})
+			},
+			page:        PageRequest{Cursor: otherOwnerCursor, SigningKey: signingKey},
+			expectedErr: ErrInvalidCursor,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := tt.clientBuilder(t)
+
+			page, err := FindNotesByOwnerPage(ctx, api, "MY_TABLE", "owner", tt.page)
+			if tt.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if page.NextCursor != tt.expectedCursor {
+					t.Fatalf("unexpected cursor: wanted %q got %q", tt.expectedCursor, page.NextCursor)
+				}
+			} else if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("unexpected error: wanted %q got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
 func validateUpdateInputKey(t *testing.T, expectedNote *schema.Note, actualKeys map[string]types.AttributeValue) {
 	var actualKeyMap map[string]string
 	err := attributevalue.UnmarshalMap(actualKeys, &actualKeyMap)
@@ -340,6 +883,16 @@ func isOwnerInKeyExpression(names map[string]string, values map[string]types.Att
 	return hasName && hasValue
 }
 
+// isValueInExpression verifies that the expression values contain the expected value
+func isValueInExpression(values map[string]types.AttributeValue, expected types.AttributeValue) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, expected) {
+			return true
+		}
+	}
+	return false
+}
+
 func marshalListOfMaps(in []schema.Note) ([]map[string]types.AttributeValue, error) {
 	var out []map[string]types.AttributeValue
 	for _, n := range in {
@@ -351,3 +904,142 @@ func marshalListOfMaps(in []schema.Note) ([]map[string]types.AttributeValue, err
 	}
 	return out, nil
 }
+
+func TestUpdateNote_KeepsCreatedAt(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable("notes")
+	if _, err := CreateNote(ctx, api, "notes", &schema.Note{Owner: "a", Title: "1", Message: "first"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	created, err := GetNote(ctx, api, "notes", "a", "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if created.CreatedAt == 0 || created.CreatedAt != created.UpdatedAt {
+		t.Fatalf("expected created_at and updated_at to be recorded but got %+v", created)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	updated, err := UpdateNote(ctx, api, "notes", &schema.Note{Owner: "a", Title: "1", Message: "second"}, created.Version)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if updated.CreatedAt != created.CreatedAt {
+		t.Errorf("expected created_at %d to be kept but got %d", created.CreatedAt, updated.CreatedAt)
+	}
+	if updated.UpdatedAt <= created.UpdatedAt || updated.Timestamp != updated.UpdatedAt {
+		t.Errorf("expected updated_at to move forward from %d but got %+v", created.UpdatedAt, updated)
+	}
+	if updated.ExpiresAt != updated.Timestamp/1000 {
+		t.Errorf("expected expires_at to be the timestamp in epoch seconds but got %+v", updated)
+	}
+}
+
+func TestFindRecentNotesPage(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable("notes")
+	var createdAt []int64
+	for _, note := range []schema.Note{{Owner: "a", Title: "1"}, {Owner: "b", Title: "1"}, {Owner: "a", Title: "2"}} {
+		if _, err := CreateNote(ctx, api, "notes", &note); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		stored, err := GetNote(ctx, api, "notes", note.Owner, note.Title)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		createdAt = append(createdAt, stored.UpdatedAt)
+		time.Sleep(2 * time.Millisecond)
+	}
+	signingKey := []byte("test-signing-key")
+	titles := func(page *NotesPage) []string {
+		var titles []string
+		for _, n := range page.Notes {
+			titles = append(titles, n.Owner+"/"+n.Title)
+		}
+		return titles
+	}
+
+	first, err := FindRecentNotesPage(ctx, api, "notes", 0, PageRequest{Limit: 2, SigningKey: signingKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, err := FindRecentNotesPage(ctx, api, "notes", 0, PageRequest{Limit: 2, Cursor: first.NextCursor, SigningKey: signingKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	since, err := FindRecentNotesPage(ctx, api, "notes", createdAt[0], PageRequest{SigningKey: signingKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = FindRecentNotesPage(ctx, api, "notes", createdAt[0], PageRequest{Cursor: first.NextCursor, SigningKey: signingKey})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected a cursor of another since to be %v but got %v", ErrInvalidCursor, err)
+	}
+
+	if got := titles(first); !reflect.DeepEqual(got, []string{"a/2", "b/1"}) || first.NextCursor == "" {
+		t.Errorf("expected the most recent notes and a cursor but got %v, %q", got, first.NextCursor)
+	}
+	if got := titles(second); !reflect.DeepEqual(got, []string{"a/1"}) {
+		t.Errorf("expected the oldest note on the second page but got %v", got)
+	}
+	if got := titles(since); !reflect.DeepEqual(got, []string{"a/2", "b/1"}) {
+		t.Errorf("expected only the notes updated after the first one but got %v", got)
+	}
+}
+
+func TestScanNotesSincePage(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable("notes")
+	// Notes written before the millis migration hold epoch seconds and are missing from the recent notes index
+	for _, note := range []schema.Note{
+		{Owner: "a", Title: "old-seconds", Timestamp: 1600000000},
+		{Owner: "a", Title: "new-seconds", Timestamp: 1700000000},
+		{Owner: "b", Title: "old-millis", Timestamp: 1600000000000},
+		{Owner: "b", Title: "new-millis", Timestamp: 1700000000000},
+	} {
+		item, err := attributevalue.MarshalMap(note)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err = api.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("notes"), Item: item}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	signingKey := []byte("test-signing-key")
+	titles := func(page *NotesPage) []string {
+		var titles []string
+		for _, n := range page.Notes {
+			titles = append(titles, n.Owner+"/"+n.Title)
+		}
+		sort.Strings(titles)
+		return titles
+	}
+
+	all, err := ScanNotesSincePage(ctx, api, "notes", 0, PageRequest{SigningKey: signingKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	since, err := ScanNotesSincePage(ctx, api, "notes", 1650000000000, PageRequest{SigningKey: signingKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	first, err := ScanNotesSincePage(ctx, api, "notes", 1650000000000, PageRequest{Limit: 1, SigningKey: signingKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = ScanNotesSincePage(ctx, api, "notes", 1, PageRequest{Cursor: first.NextCursor, SigningKey: signingKey})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected a cursor of another since to be %v but got %v", ErrInvalidCursor, err)
+	}
+
+	if got := titles(all); len(got) != 4 {
+		t.Errorf("expected every note but got %v", got)
+	}
+	if got := titles(since); !reflect.DeepEqual(got, []string{"a/new-seconds", "b/new-millis"}) {
+		t.Errorf("expected the notes updated after since in either unit but got %v", got)
+	}
+	if first.NextCursor == "" {
+		t.Errorf("expected a cursor for the rest of the notes")
+	}
+}
@@ -0,0 +1,90 @@
+package ddb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a continuation token cannot be decoded, was not signed with the expected key, or
+// belongs to another listing.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorPayload is the signed content of a continuation token.  The scope names the listing the key was read from, as
+// the key of one query is not a valid ExclusiveStartKey for another.
+type cursorPayload struct {
+	Scope string                 `json:"scope"`
+	Key   map[string]interface{} `json:"key"`
+}
+
+// EncodeCursor turns a DynamoDB LastEvaluatedKey of the listing named by scope into an opaque continuation token.
+//
+// The token is the base64 encoded scope and key followed by an HMAC-SHA256 signature of them, so callers cannot craft
+// their own ExclusiveStartKey.  An empty key returns an empty token.  The signingKey must not be empty.
+func EncodeCursor(key map[string]types.AttributeValue, scope string, signingKey []byte) (string, error) {
+	if len(signingKey) == 0 {
+		return "", errors.New("a cursor signing key must be provided")
+	}
+	if len(key) == 0 {
+		return "", nil
+	}
+	plain := cursorPayload{Scope: scope}
+	if err := attributevalue.UnmarshalMap(key, &plain.Key); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(plain)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(encoded, signingKey)), nil
+}
+
+// DecodeCursor verifies a token created by EncodeCursor for the same scope and returns the DynamoDB ExclusiveStartKey it
+// represents.
+//
+// An empty token returns a nil key.  The signingKey must not be empty.
+func DecodeCursor(token, scope string, signingKey []byte) (map[string]types.AttributeValue, error) {
+	if len(signingKey) == 0 {
+		return nil, errors.New("a cursor signing key must be provided")
+	}
+	if token == "" {
+		return nil, nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, sign(parts[0], signingKey)) {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var plain cursorPayload
+	if err = json.Unmarshal(payload, &plain); err != nil || len(plain.Key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if plain.Scope != scope {
+		return nil, fmt.Errorf("%w: the cursor belongs to another listing", ErrInvalidCursor)
+	}
+	key, err := attributevalue.MarshalMap(plain.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+	return key, nil
+}
+
+func sign(payload string, signingKey []byte) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,134 @@
+package ddb
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"reflect"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	signingKey := []byte("secret")
+	cases := map[string]struct {
+		key map[string]types.AttributeValue
+	}{
+		"string key": {
+			key: map[string]types.AttributeValue{
+				"owner": &types.AttributeValueMemberS{Value: "owner"},
+				"title": &types.AttributeValueMemberS{Value: "title"},
+			},
+		},
+		"number key": {
+			key: map[string]types.AttributeValue{
+				"owner":     &types.AttributeValueMemberS{Value: "owner"},
+				"timestamp": &types.AttributeValueMemberN{Value: "1638999997000"},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			token, err := EncodeCursor(tt.key, "scope", signingKey)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			actual, err := DecodeCursor(token, "scope", signingKey)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var expected, decoded map[string]interface{}
+			if err = attributevalue.UnmarshalMap(tt.key, &expected); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err = attributevalue.UnmarshalMap(actual, &decoded); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(expected, decoded) {
+				t.Fatalf("unexpected key: wanted %+v got %+v", expected, decoded)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	valid, err := EncodeCursor(map[string]types.AttributeValue{
+		"owner": &types.AttributeValueMemberS{Value: "owner"},
+	}, "scope", []byte("secret"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := map[string]struct {
+		token      string
+		scope      string
+		signingKey []byte
+		// expectedErr is matched with errors.Is, or by message when it is not ErrInvalidCursor
+		expectedErr error
+	}{
+		"empty token returns nil key": {
+			token:      "",
+			scope:      "scope",
+			signingKey: []byte("secret"),
+		},
+		"empty signing key returns error": {
+			token:       valid,
+			scope:       "scope",
+			expectedErr: errors.New("a cursor signing key must be provided"),
+		},
+		"empty signing key and token returns error": {
+			scope:       "scope",
+			expectedErr: errors.New("a cursor signing key must be provided"),
+		},
+		"cursor of another scope returns error": {
+			token:       valid,
+			scope:       "other",
+			signingKey:  []byte("secret"),
+			expectedErr: ErrInvalidCursor,
+		},
+		"wrong signing key returns error": {
+			token:       valid,
+			scope:       "scope",
+			signingKey:  []byte("not-the-secret"),
+			expectedErr: ErrInvalidCursor,
+		},
+		"tampered payload returns error": {
+			token:       "eyJvd25lciI6ImFkbWluIn0" + valid[len(valid)-44:],
+			scope:       "scope",
+			signingKey:  []byte("secret"),
+			expectedErr: ErrInvalidCursor,
+		},
+		"malformed token returns error": {
+			token:       "not-a-cursor",
+			scope:       "scope",
+			signingKey:  []byte("secret"),
+			expectedErr: ErrInvalidCursor,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			key, err := DecodeCursor(tt.token, tt.scope, tt.signingKey)
+			if tt.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if key != nil {
+					t.Fatalf("unexpected key: %+v", key)
+				}
+			} else if err == nil || (!errors.Is(err, tt.expectedErr) && err.Error() != tt.expectedErr.Error()) {
+				t.Fatalf("unexpected error: wanted %q got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestEncodeCursor_EmptySigningKey(t *testing.T) {
+	_, err := EncodeCursor(map[string]types.AttributeValue{
+		"owner": &types.AttributeValueMemberS{Value: "owner"},
+	}, "scope", nil)
+
+	if err == nil {
+		t.Fatal("expected an error for an empty signing key")
+	}
+}
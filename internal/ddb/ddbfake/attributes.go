@@ -0,0 +1,329 @@
+package ddbfake
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"math/big"
+	"strings"
+)
+
+// typeName returns the DynamoDB data type descriptor of av, e.g. S or NS
+func typeName(av types.AttributeValue) string {
+	switch av.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	}
+	return ""
+}
+
+func parseNumber(n string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return nil, fmt.Errorf("a value provided cannot be converted into a number: %q", n)
+	}
+	return r, nil
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	return strings.TrimRight(r.FloatString(38), "0")
+}
+
+// compare orders two scalar values of the same type, returning false when they cannot be compared
+func compare(a, b types.AttributeValue) (int, bool) {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS:
+		bv, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av.Value, bv.Value), true
+	case *types.AttributeValueMemberN:
+		bv, ok := b.(*types.AttributeValueMemberN)
+		if !ok {
+			return 0, false
+		}
+		x, err := parseNumber(av.Value)
+		if err != nil {
+			return 0, false
+		}
+		y, err := parseNumber(bv.Value)
+		if err != nil {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case *types.AttributeValueMemberB:
+		bv, ok := b.(*types.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(av.Value, bv.Value), true
+	}
+	return 0, false
+}
+
+// equal reports whether two attribute values hold the same type and value.  Sets are equal regardless of order.
+func equal(a, b types.AttributeValue) bool {
+	if typeName(a) != typeName(b) {
+		return false
+	}
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		cmp, ok := compare(a, b)
+		return ok && cmp == 0
+	case *types.AttributeValueMemberBOOL:
+		return av.Value == b.(*types.AttributeValueMemberBOOL).Value
+	case *types.AttributeValueMemberNULL:
+		return true
+	case *types.AttributeValueMemberL:
+		bv := b.(*types.AttributeValueMemberL)
+		if len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for i := range av.Value {
+			if !equal(av.Value[i], bv.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		bv := b.(*types.AttributeValueMemberM)
+		if len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for k, v := range av.Value {
+			other, ok := bv.Value[k]
+			if !ok || !equal(v, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		x, y := setMembers(a), setMembers(b)
+		if len(x) != len(y) {
+			return false
+		}
+		for _, member := range x {
+			if indexOf(y, member) < 0 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// size implements the size function of a condition expression
+func size(av types.AttributeValue) (int, bool) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberB:
+		return len(v.Value), true
+	case *types.AttributeValueMemberL:
+		return len(v.Value), true
+	case *types.AttributeValueMemberM:
+		return len(v.Value), true
+	case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		return len(setMembers(av)), true
+	}
+	return 0, false
+}
+
+func beginsWith(av, prefix types.AttributeValue) bool {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		p, ok := prefix.(*types.AttributeValueMemberS)
+		return ok && strings.HasPrefix(v.Value, p.Value)
+	case *types.AttributeValueMemberB:
+		p, ok := prefix.(*types.AttributeValueMemberB)
+		return ok && bytes.HasPrefix(v.Value, p.Value)
+	}
+	return false
+}
+
+func contains(av, operand types.AttributeValue) bool {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		s, ok := operand.(*types.AttributeValueMemberS)
+		return ok && strings.Contains(v.Value, s.Value)
+	case *types.AttributeValueMemberB:
+		b, ok := operand.(*types.AttributeValueMemberB)
+		return ok && bytes.Contains(v.Value, b.Value)
+	case *types.AttributeValueMemberL:
+		for _, element := range v.Value {
+			if equal(element, operand) {
+				return true
+			}
+		}
+		return false
+	case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		return indexOf(setMembers(av), operand) >= 0
+	}
+	return false
+}
+
+// setMembers returns the members of a set as scalar attribute values
+func setMembers(av types.AttributeValue) []types.AttributeValue {
+	var members []types.AttributeValue
+	switch v := av.(type) {
+	case *types.AttributeValueMemberSS:
+		for _, s := range v.Value {
+			members = append(members, &types.AttributeValueMemberS{Value: s})
+		}
+	case *types.AttributeValueMemberNS:
+		for _, n := range v.Value {
+			members = append(members, &types.AttributeValueMemberN{Value: n})
+		}
+	case *types.AttributeValueMemberBS:
+		for _, b := range v.Value {
+			members = append(members, &types.AttributeValueMemberB{Value: b})
+		}
+	}
+	return members
+}
+
+// newSet builds a set of the given type from scalar members, returning nil for an empty set
+func newSet(setType string, members []types.AttributeValue) types.AttributeValue {
+	if len(members) == 0 {
+		return nil
+	}
+	switch setType {
+	case "SS":
+		set := &types.AttributeValueMemberSS{}
+		for _, m := range members {
+			set.Value = append(set.Value, m.(*types.AttributeValueMemberS).Value)
+		}
+		return set
+	case "NS":
+		set := &types.AttributeValueMemberNS{}
+		for _, m := range members {
+			set.Value = append(set.Value, m.(*types.AttributeValueMemberN).Value)
+		}
+		return set
+	default:
+		set := &types.AttributeValueMemberBS{}
+		for _, m := range members {
+			set.Value = append(set.Value, m.(*types.AttributeValueMemberB).Value)
+		}
+		return set
+	}
+}
+
+func indexOf(members []types.AttributeValue, av types.AttributeValue) int {
+	for i, member := range members {
+		if equal(member, av) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isSet(av types.AttributeValue) bool {
+	switch av.(type) {
+	case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		return true
+	}
+	return false
+}
+
+// addNumbers implements the + and - operators of a SET action
+func addNumbers(a, b types.AttributeValue, subtract bool) (types.AttributeValue, error) {
+	an, aok := a.(*types.AttributeValueMemberN)
+	bn, bok := b.(*types.AttributeValueMemberN)
+	if !aok || !bok {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+	x, err := parseNumber(an.Value)
+	if err != nil {
+		return nil, err
+	}
+	y, err := parseNumber(bn.Value)
+	if err != nil {
+		return nil, err
+	}
+	if subtract {
+		y.Neg(y)
+	}
+	return &types.AttributeValueMemberN{Value: formatNumber(x.Add(x, y))}, nil
+}
+
+// add implements the ADD action: numbers are incremented and sets gain the new members.  A missing attribute is treated
+// as zero or an empty set.
+func add(current, value types.AttributeValue) (types.AttributeValue, error) {
+	switch {
+	case typeName(value) == "N":
+		if current == nil {
+			return value, nil
+		}
+		return addNumbers(current, value, false)
+	case isSet(value):
+		if current == nil {
+			return value, nil
+		}
+		if typeName(current) != typeName(value) {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		members := setMembers(current)
+		for _, member := range setMembers(value) {
+			if indexOf(members, member) < 0 {
+				members = append(members, member)
+			}
+		}
+		return newSet(typeName(value), members), nil
+	}
+	return nil, fmt.Errorf("incorrect operand type for operator or function; operator: ADD, operand type: %s", typeName(value))
+}
+
+// remove implements the DELETE action, returning nil when no members are left
+func remove(current, value types.AttributeValue) (types.AttributeValue, error) {
+	if !isSet(value) {
+		return nil, fmt.Errorf("incorrect operand type for operator or function; operator: DELETE, operand type: %s", typeName(value))
+	}
+	if current == nil {
+		return nil, nil
+	}
+	if typeName(current) != typeName(value) {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+	remove := setMembers(value)
+	var members []types.AttributeValue
+	for _, member := range setMembers(current) {
+		if indexOf(remove, member) < 0 {
+			members = append(members, member)
+		}
+	}
+	return newSet(typeName(value), members), nil
+}
+
+// copyItem returns a shallow copy of item.  Attribute values are never modified in place, so sharing them is safe.
+func copyItem(item Item) Item {
+	if item == nil {
+		return nil
+	}
+	c := make(Item, len(item))
+	for k, v := range item {
+		c[k] = v
+	}
+	return c
+}
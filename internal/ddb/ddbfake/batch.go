@@ -0,0 +1,119 @@
+package ddbfake
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// maxBatchWriteItems is the largest number of write requests DynamoDB accepts in a single BatchWriteItem call
+	maxBatchWriteItems = 25
+	// maxBatchGetItems is the largest number of keys DynamoDB accepts in a single BatchGetItem call
+	maxBatchGetItems = 100
+)
+
+// BatchGetItem returns the items with the given primary keys from one or more tables, leaving out the keys that have no
+// item.  Every key is always processed, so UnprocessedKeys is always empty.
+func (c *Client) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, keys := range input.RequestItems {
+		count += len(keys.Keys)
+	}
+	if count == 0 {
+		return nil, validationError("1 validation error detected: value at 'requestItems' failed to satisfy constraint: map value must have length greater than or equal to 1")
+	}
+	if count > maxBatchGetItems {
+		return nil, validationError("too many items requested for the BatchGetItem call")
+	}
+	responses := make(map[string][]map[string]types.AttributeValue, len(input.RequestItems))
+	for tableName, keys := range input.RequestItems {
+		t, err := c.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(keys.Keys))
+		for _, key := range keys.Keys {
+			if err = t.validateKey(key); err != nil {
+				return nil, err
+			}
+			if seen[t.keyString(key)] {
+				return nil, validationError("provided list of item keys contains duplicates")
+			}
+			seen[t.keyString(key)] = true
+		}
+		found := []map[string]types.AttributeValue{}
+		for _, key := range keys.Keys {
+			item, ok := t.items[t.keyString(key)]
+			if !ok {
+				continue
+			}
+			projected, err := project(item, keys.ProjectionExpression, keys.ExpressionAttributeNames)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, projected)
+		}
+		responses[tableName] = found
+	}
+	return &dynamodb.BatchGetItemOutput{Responses: responses, UnprocessedKeys: map[string]types.KeysAndAttributes{}}, nil
+}
+
+// BatchWriteItem puts and deletes items in one or more tables.  Every request is validated before any is applied, and
+// every request is always processed, so UnprocessedItems is always empty.
+func (c *Client) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, requests := range input.RequestItems {
+		count += len(requests)
+	}
+	if count == 0 {
+		return nil, validationError("1 validation error detected: value at 'requestItems' failed to satisfy constraint: map value must have length greater than or equal to 1")
+	}
+	if count > maxBatchWriteItems {
+		return nil, validationError("too many items requested for the BatchWriteItem call")
+	}
+	for tableName, requests := range input.RequestItems {
+		t, err := c.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(requests))
+		for _, request := range requests {
+			var key string
+			switch {
+			case request.PutRequest != nil && request.DeleteRequest == nil:
+				if err = t.validateItem(request.PutRequest.Item); err != nil {
+					return nil, err
+				}
+				key = t.keyString(request.PutRequest.Item)
+			case request.DeleteRequest != nil && request.PutRequest == nil:
+				if err = t.validateKey(request.DeleteRequest.Key); err != nil {
+					return nil, err
+				}
+				key = t.keyString(request.DeleteRequest.Key)
+			default:
+				return nil, validationError("a WriteRequest must contain exactly one of PutRequest and DeleteRequest")
+			}
+			if seen[key] {
+				return nil, validationError("provided list of item keys contains duplicates")
+			}
+			seen[key] = true
+		}
+	}
+	for tableName, requests := range input.RequestItems {
+		t := c.tables[tableName]
+		for _, request := range requests {
+			if request.PutRequest != nil {
+				t.items[t.keyString(request.PutRequest.Item)] = copyItem(request.PutRequest.Item)
+			} else {
+				delete(t.items, t.keyString(request.DeleteRequest.Key))
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}, nil
+}
@@ -0,0 +1,602 @@
+// Package ddbfake is an in-memory stand-in for the AWS DynamoDB Client.
+//
+// The Client implements the ddb API interfaces with the key schema, conditional writes, update expressions, batch writes,
+// transactions, Limit/LastEvaluatedKey paging and parallel scan segments of the real service, so code built on the ddb
+// package can be tested in-process.  Only top level attribute paths are supported in expressions, the 1MB page size limit is not
+// enforced, and every scanned item is counted as half a read capacity unit.
+package ddbfake
+
+import (
+	"context"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"sync"
+	"time"
+)
+
+// Client is a set of in-memory DynamoDB tables.  It is safe for concurrent use.
+type Client struct {
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+// New returns a Client without any tables
+func New() *Client {
+	return &Client{tables: make(map[string]*table)}
+}
+
+// NewNotesTable returns a Client with an empty table described by schema.NotesKeySchema and
+// schema.NotesGlobalSecondaryIndexes
+func NewNotesTable(tableName string) *Client {
+	c := New()
+	_, err := c.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName:              aws.String(tableName),
+		KeySchema:              schema.NotesKeySchema,
+		AttributeDefinitions:   schema.NotesAttributeDefinitions,
+		GlobalSecondaryIndexes: schema.NotesGlobalSecondaryIndexes,
+		BillingMode:            types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+type table struct {
+	description    types.TableDescription
+	hashKey        string
+	rangeKey       string
+	attributeTypes map[string]types.ScalarAttributeType
+	indexes        map[string]*index
+	items          map[string]Item
+}
+
+// CreateTable creates an empty table that is immediately ACTIVE
+func (c *Client) CreateTable(ctx context.Context, input *dynamodb.CreateTableInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := aws.ToString(input.TableName)
+	if name == "" {
+		return nil, validationError("table name must be provided")
+	}
+	if _, ok := c.tables[name]; ok {
+		return nil, &types.ResourceInUseException{Message: aws.String(fmt.Sprintf("Table already exists: %s", name))}
+	}
+	t := &table{
+		attributeTypes: make(map[string]types.ScalarAttributeType),
+		indexes:        make(map[string]*index),
+		items:          make(map[string]Item),
+	}
+	for _, definition := range input.AttributeDefinitions {
+		t.attributeTypes[aws.ToString(definition.AttributeName)] = definition.AttributeType
+	}
+	for _, element := range input.KeySchema {
+		attribute := aws.ToString(element.AttributeName)
+		if _, ok := t.attributeTypes[attribute]; !ok {
+			return nil, validationError("no attribute definition for key attribute %s", attribute)
+		}
+		if element.KeyType == types.KeyTypeHash {
+			t.hashKey = attribute
+		} else {
+			t.rangeKey = attribute
+		}
+	}
+	if t.hashKey == "" {
+		return nil, validationError("the key schema must contain a HASH key")
+	}
+	var indexDescriptions []types.GlobalSecondaryIndexDescription
+	for _, gsi := range input.GlobalSecondaryIndexes {
+		idx, err := newIndex(t, gsi)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := t.indexes[aws.ToString(gsi.IndexName)]; ok {
+			return nil, validationError("duplicate index name: %s", aws.ToString(gsi.IndexName))
+		}
+		t.indexes[aws.ToString(gsi.IndexName)] = idx
+		indexDescriptions = append(indexDescriptions, idx.description)
+	}
+	t.description = types.TableDescription{
+		TableName:              aws.String(name),
+		TableArn:               aws.String(fmt.Sprintf("arn:aws:dynamodb:us-east-1:000000000000:table/%s", name)),
+		TableStatus:            types.TableStatusActive,
+		KeySchema:              input.KeySchema,
+		AttributeDefinitions:   input.AttributeDefinitions,
+		GlobalSecondaryIndexes: indexDescriptions,
+		ProvisionedThroughput:  throughputDescription(input.ProvisionedThroughput),
+		CreationDateTime:       aws.Time(time.Now()),
+	}
+	if input.BillingMode != "" {
+		t.description.BillingModeSummary = &types.BillingModeSummary{BillingMode: input.BillingMode}
+	}
+	c.tables[name] = t
+	return &dynamodb.CreateTableOutput{TableDescription: t.describe()}, nil
+}
+
+// DescribeTable describes the table, counting its items
+func (c *Client) DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeTableOutput{Table: t.describe()}, nil
+}
+
+// DeleteTable removes the table and its items immediately, describing it as DELETING
+func (c *Client) DeleteTable(ctx context.Context, input *dynamodb.DeleteTableInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteTableOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.tables, aws.ToString(input.TableName))
+	description := t.describe()
+	description.TableStatus = types.TableStatusDeleting
+	return &dynamodb.DeleteTableOutput{TableDescription: description}, nil
+}
+
+// PutItem replaces the item with the same primary key
+func (c *Client) PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.validateItem(input.Item); err != nil {
+		return nil, err
+	}
+	old := t.items[t.keyString(input.Item)]
+	if err = checkCondition(input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, old); err != nil {
+		return nil, err
+	}
+	t.items[t.keyString(input.Item)] = copyItem(input.Item)
+	output := &dynamodb.PutItemOutput{}
+	if input.ReturnValues == types.ReturnValueAllOld {
+		output.Attributes = copyItem(old)
+	}
+	return output, nil
+}
+
+// GetItem returns the item with the given primary key, or an empty output when there is none
+func (c *Client) GetItem(ctx context.Context, input *dynamodb.GetItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.validateKey(input.Key); err != nil {
+		return nil, err
+	}
+	item, ok := t.items[t.keyString(input.Key)]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	projected, err := project(item, input.ProjectionExpression, input.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: projected}, nil
+}
+
+// DeleteItem removes the item with the given primary key
+func (c *Client) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.validateKey(input.Key); err != nil {
+		return nil, err
+	}
+	key := t.keyString(input.Key)
+	old := t.items[key]
+	if err = checkCondition(input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, old); err != nil {
+		return nil, err
+	}
+	delete(t.items, key)
+	output := &dynamodb.DeleteItemOutput{}
+	if input.ReturnValues == types.ReturnValueAllOld {
+		output.Attributes = copyItem(old)
+	}
+	return output, nil
+}
+
+// UpdateItem applies the UpdateExpression to the item with the given primary key, creating the item when it does not exist
+func (c *Client) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.validateKey(input.Key); err != nil {
+		return nil, err
+	}
+	key := t.keyString(input.Key)
+	old := t.items[key]
+	if err = checkCondition(input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, old); err != nil {
+		return nil, err
+	}
+	updated, changed, err := t.update(old, input.Key, input.UpdateExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	t.items[key] = updated
+
+	output := &dynamodb.UpdateItemOutput{}
+	switch input.ReturnValues {
+	case types.ReturnValueAllOld:
+		output.Attributes = copyItem(old)
+	case types.ReturnValueAllNew:
+		output.Attributes = copyItem(updated)
+	case types.ReturnValueUpdatedOld:
+		output.Attributes = pick(old, changed)
+	case types.ReturnValueUpdatedNew:
+		output.Attributes = pick(updated, changed)
+	}
+	return output, nil
+}
+
+// Query returns the items of a single partition of the table or of an index in sort key order
+func (c *Client) Query(ctx context.Context, input *dynamodb.QueryInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if input.KeyConditionExpression == nil {
+		return nil, validationError("either the KeyConditions or KeyConditionExpression parameter must be specified in the request")
+	}
+	items, hashKey, rangeKey, order, err := t.source(input.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	kc, err := parseKeyCondition(*input.KeyConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, hashKey, rangeKey)
+	if err != nil {
+		return nil, validationError("invalid KeyConditionExpression: %s", err)
+	}
+	var matches []Item
+	for _, item := range items {
+		if !equal(item[hashKey], kc.partitionValue) {
+			continue
+		}
+		if ok, err := kc.eval(item); err != nil {
+			return nil, validationError("invalid KeyConditionExpression: %s", err)
+		} else if ok {
+			matches = append(matches, item)
+		}
+	}
+	forward := input.ScanIndexForward == nil || *input.ScanIndexForward
+	if !forward {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+	if len(input.ExclusiveStartKey) > 0 {
+		start := 0
+		for start < len(matches) && !order.after(matches[start], input.ExclusiveStartKey, forward) {
+			start++
+		}
+		matches = matches[start:]
+	}
+	p, err := page(order, matches, input.Limit, input.FilterExpression, input.ProjectionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.QueryOutput{
+		Items:            p.items,
+		Count:            p.count,
+		ScannedCount:     p.scanned,
+		LastEvaluatedKey: p.lastKey,
+	}, nil
+}
+
+// Scan returns every item in the table or an index in key order.  A parallel scan returns the items of its Segment in
+// key order, every item of a partition belongs to the same segment.
+func (c *Client) Scan(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	items, hashKey, _, order, err := t.source(input.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	if items, err = segment(items, hashKey, input.Segment, input.TotalSegments); err != nil {
+		return nil, err
+	}
+	if len(input.ExclusiveStartKey) > 0 {
+		start := 0
+		for start < len(items) && !order.after(items[start], input.ExclusiveStartKey, true) {
+			start++
+		}
+		items = items[start:]
+	}
+	p, err := page(order, items, input.Limit, input.FilterExpression, input.ProjectionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.ScanOutput{
+		Items:            p.items,
+		Count:            p.count,
+		ScannedCount:     p.scanned,
+		LastEvaluatedKey: p.lastKey,
+		ConsumedCapacity: consumedCapacity(input.TableName, input.ReturnConsumedCapacity, p.scanned),
+	}, nil
+}
+
+// Items returns a copy of every item in the table in primary key order, for making assertions in tests
+func (c *Client) Items(tableName string) []Item {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[tableName]
+	if !ok {
+		return nil
+	}
+	var items []Item
+	for _, item := range t.sortedItems() {
+		items = append(items, copyItem(item))
+	}
+	return items
+}
+
+func (c *Client) table(name *string) (*table, error) {
+	t, ok := c.tables[aws.ToString(name)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found")}
+	}
+	return t, nil
+}
+
+func (t *table) describe() *types.TableDescription {
+	description := t.description
+	description.ItemCount = int64(len(t.items))
+	return &description
+}
+
+func (t *table) keyAttributes() []string {
+	if t.rangeKey == "" {
+		return []string{t.hashKey}
+	}
+	return []string{t.hashKey, t.rangeKey}
+}
+
+// validateKey checks that key contains exactly the primary key attributes of the table
+func (t *table) validateKey(key Item) error {
+	if len(key) != len(t.keyAttributes()) {
+		return validationError("the provided key element does not match the schema")
+	}
+	return t.validateItem(key)
+}
+
+// validateItem checks that item contains the primary key attributes with the types given in the attribute definitions
+func (t *table) validateItem(item Item) error {
+	for _, attribute := range t.keyAttributes() {
+		av, ok := item[attribute]
+		if !ok || typeName(av) != string(t.attributeTypes[attribute]) {
+			return validationError("one or more parameter values were invalid: missing the key %s in the item", attribute)
+		}
+		if n, _ := size(av); n == 0 && typeName(av) != "N" {
+			return validationError("one or more parameter values are not valid: the AttributeValue for a key attribute cannot contain an empty value; key: %s", attribute)
+		}
+	}
+	return nil
+}
+
+// keyString encodes the primary key of item for use as a map key
+func (t *table) keyString(item Item) string {
+	var key string
+	for _, attribute := range t.keyAttributes() {
+		switch v := item[attribute].(type) {
+		case *types.AttributeValueMemberS:
+			key += fmt.Sprintf("%q;", v.Value)
+		case *types.AttributeValueMemberN:
+			n, err := parseNumber(v.Value)
+			if err != nil {
+				key += fmt.Sprintf("%q;", v.Value)
+			} else {
+				key += fmt.Sprintf("%q;", formatNumber(n))
+			}
+		case *types.AttributeValueMemberB:
+			key += fmt.Sprintf("%x;", v.Value)
+		}
+	}
+	return key
+}
+
+// sortedItems returns the items of the table ordered by partition key and then sort key
+func (t *table) sortedItems() []Item {
+	items := make([]Item, 0, len(t.items))
+	for _, item := range t.items {
+		items = append(items, item)
+	}
+	keyOrder(t.keyAttributes()).sort(items)
+	return items
+}
+
+// source returns the items read by a Query or Scan in read order, along with the key attributes of the table or index
+func (t *table) source(indexName *string) (items []Item, hashKey, rangeKey string, order keyOrder, err error) {
+	if indexName == nil {
+		return t.sortedItems(), t.hashKey, t.rangeKey, keyOrder(t.keyAttributes()), nil
+	}
+	idx, ok := t.indexes[*indexName]
+	if !ok {
+		return nil, "", "", nil, validationError("the table does not have the specified index: %s", *indexName)
+	}
+	return idx.items(t), idx.hashKey, idx.rangeKey, idx.order(t), nil
+}
+
+type readPage struct {
+	items   []Item
+	count   int32
+	scanned int32
+	lastKey Item
+}
+
+// page evaluates up to limit items, then applies the filter and projection to the ones that were evaluated
+func page(order keyOrder, items []Item, limit *int32, filterExpr, projectionExpr *string, names map[string]string, values map[string]types.AttributeValue) (*readPage, error) {
+	var filter condition
+	if filterExpr != nil {
+		var err error
+		if filter, err = parseCondition(*filterExpr, names, values); err != nil {
+			return nil, validationError("invalid FilterExpression: %s", err)
+		}
+	}
+	p := &readPage{}
+	if limit != nil && *limit < 1 {
+		return nil, validationError("1 validation error detected: value at 'limit' failed to satisfy constraint: member must have value greater than or equal to 1")
+	}
+	if limit != nil && int(*limit) <= len(items) {
+		items = items[:*limit]
+		if len(items) > 0 {
+			p.lastKey = order.key(items[len(items)-1])
+		}
+	}
+	for _, item := range items {
+		p.scanned++
+		if filter != nil {
+			ok, err := filter.eval(item)
+			if err != nil {
+				return nil, validationError("invalid FilterExpression: %s", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		projected, err := project(item, projectionExpr, names)
+		if err != nil {
+			return nil, err
+		}
+		p.items = append(p.items, projected)
+		p.count++
+	}
+	return p, nil
+}
+
+// update returns a copy of the old item, or of the key when there is no old item, with the UpdateExpression applied,
+// along with the names of the attributes that were changed
+func (t *table) update(old, key Item, expr *string, names map[string]string, values map[string]types.AttributeValue) (Item, []string, error) {
+	updated := copyItem(old)
+	if updated == nil {
+		updated = copyItem(key)
+	}
+	if expr == nil {
+		return updated, nil, nil
+	}
+	actions, err := parseUpdate(*expr, names, values)
+	if err != nil {
+		return nil, nil, validationError("invalid UpdateExpression: %s", err)
+	}
+	changed, err := t.applyUpdate(updated, actions)
+	if err != nil {
+		return nil, nil, err
+	}
+	return updated, changed, nil
+}
+
+// applyUpdate applies the actions to item, evaluating every operand against the item as it was before the update.  The
+// names of the attributes that were changed are returned.
+func (t *table) applyUpdate(item Item, actions []updateAction) ([]string, error) {
+	original := copyItem(item)
+	var changed []string
+	for _, action := range actions {
+		attribute := string(action.path)
+		for _, keyAttribute := range t.keyAttributes() {
+			if attribute == keyAttribute {
+				return nil, validationError("one or more parameter values were invalid: cannot update attribute %s. This attribute is part of the key", attribute)
+			}
+		}
+		var value types.AttributeValue
+		var err error
+		if action.value != nil {
+			if value, err = action.value.compute(original); err != nil {
+				return nil, validationError("invalid UpdateExpression: %s", err)
+			}
+		}
+		switch action.clause {
+		case "SET":
+			item[attribute] = value
+		case "REMOVE":
+			delete(item, attribute)
+		case "ADD":
+			if value, err = add(original[attribute], value); err != nil {
+				return nil, validationError("invalid UpdateExpression: %s", err)
+			}
+			item[attribute] = value
+		case "DELETE":
+			if value, err = remove(original[attribute], value); err != nil {
+				return nil, validationError("invalid UpdateExpression: %s", err)
+			}
+			if value == nil {
+				delete(item, attribute)
+			} else {
+				item[attribute] = value
+			}
+		}
+		changed = append(changed, attribute)
+	}
+	return changed, nil
+}
+
+// checkCondition evaluates a ConditionExpression against the current item, which is nil when it does not exist
+func checkCondition(expr *string, names map[string]string, values map[string]types.AttributeValue, item Item) error {
+	if expr == nil {
+		return nil
+	}
+	c, err := parseCondition(*expr, names, values)
+	if err != nil {
+		return validationError("invalid ConditionExpression: %s", err)
+	}
+	ok, err := c.eval(item)
+	if err != nil {
+		return validationError("invalid ConditionExpression: %s", err)
+	}
+	if !ok {
+		return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return nil
+}
+
+// project returns a copy of item containing only the attributes in the ProjectionExpression
+func project(item Item, expr *string, names map[string]string) (Item, error) {
+	if expr == nil {
+		return copyItem(item), nil
+	}
+	attributes, err := parseProjection(*expr, names)
+	if err != nil {
+		return nil, validationError("invalid ProjectionExpression: %s", err)
+	}
+	return pick(item, attributes), nil
+}
+
+// pick returns the given attributes of item that exist, or nil when there are none
+func pick(item Item, attributes []string) Item {
+	var picked Item
+	for _, attribute := range attributes {
+		if av, ok := item[attribute]; ok {
+			if picked == nil {
+				picked = make(Item)
+			}
+			picked[attribute] = av
+		}
+	}
+	return picked
+}
+
+// validationError mirrors the ValidationException returned by DynamoDB, which has no dedicated type in the SDK
+func validationError(format string, args ...interface{}) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: fmt.Sprintf(format, args...), Fault: smithy.FaultClient}
+}
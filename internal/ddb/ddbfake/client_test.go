@@ -0,0 +1,562 @@
+package ddbfake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"reflect"
+	"testing"
+)
+
+const testTableName = "notes"
+
+var testSigningKey = []byte("test-signing-key")
+
+func TestClient_NoteLifecycle(t *testing.T) {
+	ctx := context.Background()
+	client := NewNotesTable(testTableName)
+	note := &schema.Note{Owner: "test-owner", Title: "test-title", Message: "test-message"}
+
+	if _, err := ddb.CreateNote(ctx, client, testTableName, note); err != nil {
+		t.Fatalf("unexpected error creating note: %s", err)
+	}
+	var eerr *ddb.NoteExistsError
+	if _, err := ddb.CreateNote(ctx, client, testTableName, note); !errors.As(err, &eerr) {
+		t.Fatalf("expected a NoteExistsError but got %v", err)
+	}
+
+	got, err := ddb.GetNote(ctx, client, testTableName, note.Owner, note.Title)
+	if err != nil {
+		t.Fatalf("unexpected error getting note: %s", err)
+	}
+	if got.Message != note.Message || got.Version != 1 || got.Timestamp == 0 {
+		t.Errorf("unexpected note: %+v", got)
+	}
+
+	var perr *ddb.PreconditionFailedError
+	if _, err = ddb.UpdateNote(ctx, client, testTableName, &schema.Note{Owner: note.Owner, Title: note.Title, Message: "stale"}, 2); !errors.As(err, &perr) {
+		t.Fatalf("expected a PreconditionFailedError but got %v", err)
+	}
+	updated, err := ddb.UpdateNote(ctx, client, testTableName, &schema.Note{Owner: note.Owner, Title: note.Title, Message: "updated"}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error updating note: %s", err)
+	}
+	if updated.Message != "updated" || updated.Version != 2 {
+		t.Errorf("unexpected updated note: %+v", updated)
+	}
+	if _, err = ddb.UpdateNote(ctx, client, testTableName, &schema.Note{Owner: note.Owner, Title: "missing", Message: "m"}, ddb.AnyVersion); !errors.As(err, &perr) {
+		t.Errorf("expected updating a missing note to fail but got %v", err)
+	}
+
+	if err = ddb.DeleteNote(ctx, client, testTableName, note.Owner, note.Title); err != nil {
+		t.Fatalf("unexpected error deleting note: %s", err)
+	}
+	var nerr *ddb.NoteNotFoundError
+	if err = ddb.DeleteNote(ctx, client, testTableName, note.Owner, note.Title); !errors.As(err, &nerr) {
+		t.Errorf("expected a NoteNotFoundError but got %v", err)
+	}
+	if items := client.Items(testTableName); len(items) != 0 {
+		t.Errorf("expected an empty table but got %v", items)
+	}
+}
+
+func TestClient_Paging(t *testing.T) {
+	ctx := context.Background()
+	client := NewNotesTable(testTableName)
+	for _, n := range []schema.Note{
+		{Owner: "a", Title: "3"}, {Owner: "b", Title: "1"}, {Owner: "a", Title: "1"}, {Owner: "a", Title: "2"},
+	} {
+		if _, err := ddb.AddNote(ctx, client, testTableName, &n); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	cases := map[string]struct {
+		fetch         func(page ddb.PageRequest) (*ddb.NotesPage, error)
+		expectedPages [][]string
+	}{
+		"scan visits every note in key order": {
+			fetch: func(page ddb.PageRequest) (*ddb.NotesPage, error) {
+				return ddb.ScanPage(ctx, client, testTableName, page)
+			},
+			expectedPages: [][]string{{"a/1", "a/2"}, {"a/3", "b/1"}, nil},
+		},
+		"query stays in the partition": {
+			fetch: func(page ddb.PageRequest) (*ddb.NotesPage, error) {
+				return ddb.FindNotesByOwnerPage(ctx, client, testTableName, "a", page)
+			},
+			expectedPages: [][]string{{"a/1", "a/2"}, {"a/3"}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var pages [][]string
+			page := ddb.PageRequest{Limit: 2, SigningKey: testSigningKey}
+			for {
+				result, err := tt.fetch(page)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				var keys []string
+				for _, n := range result.Notes {
+					keys = append(keys, n.Owner+"/"+n.Title)
+				}
+				pages = append(pages, keys)
+				if result.NextCursor == "" || len(pages) > len(tt.expectedPages) {
+					break
+				}
+				page.Cursor = result.NextCursor
+			}
+			if !reflect.DeepEqual(tt.expectedPages, pages) {
+				t.Errorf("expected pages %v but got %v", tt.expectedPages, pages)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateItem(t *testing.T) {
+	key := map[string]types.AttributeValue{
+		"owner": &types.AttributeValueMemberS{Value: "test-owner"},
+		"title": &types.AttributeValueMemberS{Value: "test-title"},
+	}
+	cases := map[string]struct {
+		existing      map[string]interface{}
+		input         dynamodb.UpdateItemInput
+		expectedItem  map[string]interface{}
+		expectedError string
+	}{
+		"set, add and remove": {
+			existing: map[string]interface{}{"owner": "test-owner", "title": "test-title", "count": 1, "old": true},
+			input: dynamodb.UpdateItemInput{
+				UpdateExpression: aws.String("SET #m = :m, #c = #c + :one ADD #t :tags REMOVE #o"),
+				ExpressionAttributeNames: map[string]string{
+					"#m": "message", "#c": "count", "#t": "tags", "#o": "old",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":m":    &types.AttributeValueMemberS{Value: "hello"},
+					":one":  &types.AttributeValueMemberN{Value: "1"},
+					":tags": &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+				},
+			},
+			expectedItem: map[string]interface{}{"owner": "test-owner", "title": "test-title", "message": "hello", "count": 2.0, "tags": []string{"a", "b"}},
+		},
+		"if_not_exists keeps the existing value": {
+			existing: map[string]interface{}{"owner": "test-owner", "title": "test-title", "created": 1},
+			input: dynamodb.UpdateItemInput{
+				UpdateExpression:          aws.String("SET #c = if_not_exists(#c, :now), #u = :now"),
+				ExpressionAttributeNames:  map[string]string{"#c": "created", "#u": "updated"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":now": &types.AttributeValueMemberN{Value: "5"}},
+			},
+			expectedItem: map[string]interface{}{"owner": "test-owner", "title": "test-title", "created": 1.0, "updated": 5.0},
+		},
+		"condition on a missing item fails": {
+			input: dynamodb.UpdateItemInput{
+				UpdateExpression:          aws.String("SET #m = :m"),
+				ConditionExpression:       aws.String("attribute_exists (#o)"),
+				ExpressionAttributeNames:  map[string]string{"#m": "message", "#o": "owner"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":m": &types.AttributeValueMemberS{Value: "hello"}},
+			},
+			expectedError: "ConditionalCheckFailedException",
+		},
+		"key attributes cannot be updated": {
+			input: dynamodb.UpdateItemInput{
+				UpdateExpression:          aws.String("SET #t = :t"),
+				ExpressionAttributeNames:  map[string]string{"#t": "title"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":t": &types.AttributeValueMemberS{Value: "other"}},
+			},
+			expectedError: "ValidationException",
+		},
+		"undefined value placeholder": {
+			input: dynamodb.UpdateItemInput{
+				UpdateExpression:         aws.String("SET #m = :m"),
+				ExpressionAttributeNames: map[string]string{"#m": "message"},
+			},
+			expectedError: "ValidationException",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewNotesTable(testTableName)
+			if tt.existing != nil {
+				item, err := attributevalue.MarshalMap(tt.existing)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if _, err = client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(testTableName), Item: item}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			input := tt.input
+			input.TableName = aws.String(testTableName)
+			input.Key = key
+
+			_, err := client.UpdateItem(ctx, &input)
+
+			if tt.expectedError != "" {
+				var apiErr smithy.APIError
+				if !errors.As(err, &apiErr) || apiErr.ErrorCode() != tt.expectedError {
+					t.Fatalf("expected %s but got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var got map[string]interface{}
+			if err = attributevalue.UnmarshalMap(client.Items(testTableName)[0], &got); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(tt.expectedItem, got) {
+				t.Errorf("expected item %v but got %v", tt.expectedItem, got)
+			}
+		})
+	}
+}
+
+func TestClient_MissingTable(t *testing.T) {
+	_, err := New().GetItem(context.Background(), &dynamodb.GetItemInput{TableName: aws.String(testTableName)})
+	var rnf *types.ResourceNotFoundException
+	if !errors.As(err, &rnf) {
+		t.Errorf("expected a ResourceNotFoundException but got %v", err)
+	}
+}
+
+func TestClient_GlobalSecondaryIndex(t *testing.T) {
+	ctx := context.Background()
+	client := NewNotesTable(testTableName)
+	for _, item := range []map[string]interface{}{
+		{"owner": "a", "title": "1", "feed": "notes", "updated_at": 3},
+		{"owner": "a", "title": "2", "feed": "notes", "updated_at": 1},
+		{"owner": "b", "title": "1", "feed": "notes", "updated_at": 2},
+		{"owner": "c", "title": "1", "updated_at": 4},
+	} {
+		av, _ := attributevalue.MarshalMap(item)
+		if _, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(testTableName), Item: av}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	query := func(startKey map[string]types.AttributeValue) *dynamodb.QueryOutput {
+		output, err := client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(testTableName),
+			IndexName:                 aws.String(schema.RecentNotesIndexName),
+			KeyConditionExpression:    aws.String("feed = :feed"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":feed": &types.AttributeValueMemberS{Value: "notes"}},
+			ScanIndexForward:          aws.Bool(false),
+			Limit:                     aws.Int32(2),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return output
+	}
+	keys := func(items []Item) []string {
+		var keys []string
+		for _, item := range items {
+			keys = append(keys, item["owner"].(*types.AttributeValueMemberS).Value+"/"+item["title"].(*types.AttributeValueMemberS).Value)
+		}
+		return keys
+	}
+
+	first := query(nil)
+	second := query(first.LastEvaluatedKey)
+
+	if got := keys(first.Items); !reflect.DeepEqual(got, []string{"a/1", "b/1"}) {
+		t.Errorf("expected the first page to be the most recent notes but got %v", got)
+	}
+	if len(first.LastEvaluatedKey) != 4 {
+		t.Errorf("expected the LastEvaluatedKey to hold the index and table keys but got %v", first.LastEvaluatedKey)
+	}
+	if got := keys(second.Items); !reflect.DeepEqual(got, []string{"a/2"}) || second.LastEvaluatedKey != nil {
+		t.Errorf("expected the last page to hold the oldest note but got %v, %v", got, second.LastEvaluatedKey)
+	}
+	scan, err := client.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(testTableName), IndexName: aws.String(schema.RecentNotesIndexName)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if scan.Count != 3 {
+		t.Errorf("expected notes without the partition attribute to be left out of the index but scanned %v", keys(scan.Items))
+	}
+	var apiErr smithy.APIError
+	if _, err = client.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(testTableName), IndexName: aws.String("missing")}); !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ValidationException" {
+		t.Errorf("expected a ValidationException for a missing index but got %v", err)
+	}
+}
+
+func TestClient_ParallelScan(t *testing.T) {
+	ctx := context.Background()
+	client := NewNotesTable(testTableName)
+	expected := make(map[string]bool)
+	for _, owner := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		for _, title := range []string{"1", "2", "3"} {
+			if _, err := ddb.AddNote(ctx, client, testTableName, &schema.Note{Owner: owner, Title: title}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			expected[owner+"/"+title] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	owners := make(map[string]int32)
+	for segment := int32(0); segment < 3; segment++ {
+		input := &dynamodb.ScanInput{
+			TableName:              aws.String(testTableName),
+			Limit:                  aws.Int32(2),
+			Segment:                aws.Int32(segment),
+			TotalSegments:          aws.Int32(3),
+			ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		}
+		for {
+			output, err := client.Scan(ctx, input)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if output.ConsumedCapacity == nil || aws.ToFloat64(output.ConsumedCapacity.CapacityUnits) != float64(output.ScannedCount)/2 {
+				t.Errorf("expected consumed capacity for %d items but got %+v", output.ScannedCount, output.ConsumedCapacity)
+			}
+			var notes []schema.Note
+			if err = attributevalue.UnmarshalListOfMaps(output.Items, &notes); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, n := range notes {
+				key := n.Owner + "/" + n.Title
+				if seen[key] {
+					t.Errorf("expected %s to be scanned once", key)
+				}
+				seen[key] = true
+				if s, ok := owners[n.Owner]; ok && s != segment {
+					t.Errorf("expected every note of %s to be in segment %d but found one in %d", n.Owner, s, segment)
+				}
+				owners[n.Owner] = segment
+			}
+			if len(output.LastEvaluatedKey) == 0 {
+				break
+			}
+			input.ExclusiveStartKey = output.LastEvaluatedKey
+		}
+	}
+	if !reflect.DeepEqual(expected, seen) {
+		t.Errorf("expected every note to be scanned but got %v", seen)
+	}
+
+	for name, input := range map[string]*dynamodb.ScanInput{
+		"segment without total": {Segment: aws.Int32(0)},
+		"total without segment": {TotalSegments: aws.Int32(2)},
+		"segment out of range":  {Segment: aws.Int32(2), TotalSegments: aws.Int32(2)},
+		"no segments":           {Segment: aws.Int32(0), TotalSegments: aws.Int32(0)},
+	} {
+		input.TableName = aws.String(testTableName)
+		var apiErr smithy.APIError
+		if _, err := client.Scan(ctx, input); !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ValidationException" {
+			t.Errorf("%s: expected a ValidationException but got %v", name, err)
+		}
+	}
+}
+
+func TestClient_BatchWriteItem(t *testing.T) {
+	put := func(owner, title string) types.WriteRequest {
+		return types.WriteRequest{PutRequest: &types.PutRequest{Item: Item{
+			"owner": &types.AttributeValueMemberS{Value: owner},
+			"title": &types.AttributeValueMemberS{Value: title},
+		}}}
+	}
+	var tooMany []types.WriteRequest
+	for i := 0; i < 26; i++ {
+		tooMany = append(tooMany, put("a", string(rune('a'+i))))
+	}
+
+	cases := map[string]struct {
+		requests      []types.WriteRequest
+		expectedError string
+		expectedKeys  []string
+	}{
+		"puts and deletes": {
+			requests: []types.WriteRequest{
+				put("a", "2"), put("b", "1"),
+				{DeleteRequest: &types.DeleteRequest{Key: Item{
+					"owner": &types.AttributeValueMemberS{Value: "a"},
+					"title": &types.AttributeValueMemberS{Value: "1"},
+				}}},
+			},
+			expectedKeys: []string{"a/2", "b/1"},
+		},
+		"duplicate keys":    {requests: []types.WriteRequest{put("a", "2"), put("a", "2")}, expectedError: "ValidationException", expectedKeys: []string{"a/1"}},
+		"too many requests": {requests: tooMany, expectedError: "ValidationException", expectedKeys: []string{"a/1"}},
+		"no requests":       {expectedError: "ValidationException", expectedKeys: []string{"a/1"}},
+		"missing key":       {requests: []types.WriteRequest{put("a", "")}, expectedError: "ValidationException", expectedKeys: []string{"a/1"}},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewNotesTable(testTableName)
+			if _, err := ddb.AddNote(ctx, client, testTableName, &schema.Note{Owner: "a", Title: "1"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			_, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{testTableName: tt.requests},
+			})
+
+			var apiErr smithy.APIError
+			if tt.expectedError == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if tt.expectedError != "" && (!errors.As(err, &apiErr) || apiErr.ErrorCode() != tt.expectedError) {
+				t.Fatalf("expected a %s but got %v", tt.expectedError, err)
+			}
+			var keys []string
+			for _, item := range client.Items(testTableName) {
+				keys = append(keys, item["owner"].(*types.AttributeValueMemberS).Value+"/"+item["title"].(*types.AttributeValueMemberS).Value)
+			}
+			if !reflect.DeepEqual(tt.expectedKeys, keys) {
+				t.Errorf("expected keys %v but got %v", tt.expectedKeys, keys)
+			}
+		})
+	}
+}
+
+func TestClient_BatchGetItem(t *testing.T) {
+	key := func(owner, title string) Item {
+		return Item{"owner": &types.AttributeValueMemberS{Value: owner}, "title": &types.AttributeValueMemberS{Value: title}}
+	}
+	var tooMany []Item
+	for i := 0; i < 101; i++ {
+		tooMany = append(tooMany, key("a", fmt.Sprint(i)))
+	}
+
+	cases := map[string]struct {
+		keys          []Item
+		expectedError string
+		expectedKeys  []string
+	}{
+		"missing items are left out": {keys: []Item{key("a", "1"), key("a", "2")}, expectedKeys: []string{"a/1"}},
+		"duplicate keys":             {keys: []Item{key("a", "1"), key("a", "1")}, expectedError: "ValidationException"},
+		"too many keys":              {keys: tooMany, expectedError: "ValidationException"},
+		"no keys":                    {expectedError: "ValidationException"},
+		"missing key":                {keys: []Item{key("a", "")}, expectedError: "ValidationException"},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewNotesTable(testTableName)
+			if _, err := ddb.AddNote(ctx, client, testTableName, &schema.Note{Owner: "a", Title: "1"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			output, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]types.KeysAndAttributes{testTableName: {Keys: tt.keys}},
+			})
+
+			var apiErr smithy.APIError
+			if tt.expectedError != "" {
+				if !errors.As(err, &apiErr) || apiErr.ErrorCode() != tt.expectedError {
+					t.Fatalf("expected a %s but got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var keys []string
+			for _, item := range output.Responses[testTableName] {
+				keys = append(keys, item["owner"].(*types.AttributeValueMemberS).Value+"/"+item["title"].(*types.AttributeValueMemberS).Value)
+			}
+			if !reflect.DeepEqual(tt.expectedKeys, keys) {
+				t.Errorf("expected keys %v but got %v", tt.expectedKeys, keys)
+			}
+		})
+	}
+}
+
+func TestClient_TransactWriteItems(t *testing.T) {
+	key := func(owner, title string) Item {
+		return Item{"owner": &types.AttributeValueMemberS{Value: owner}, "title": &types.AttributeValueMemberS{Value: title}}
+	}
+	exists := aws.String("attribute_exists(#o)")
+	names := map[string]string{"#o": "owner"}
+
+	cases := map[string]struct {
+		items           []types.TransactWriteItem
+		expectedError   string
+		expectedReasons []string
+		expectedKeys    []string
+	}{
+		"every action is applied": {
+			items: []types.TransactWriteItem{
+				{Delete: &types.Delete{TableName: aws.String(testTableName), Key: key("a", "1"), ConditionExpression: exists, ExpressionAttributeNames: names}},
+				{Put: &types.Put{TableName: aws.String(testTableName), Item: key("a", "2")}},
+				{Update: &types.Update{TableName: aws.String(testTableName), Key: key("b", "1"), UpdateExpression: aws.String("SET #o = :o"),
+					ExpressionAttributeNames: map[string]string{"#o": "message"}, ExpressionAttributeValues: map[string]types.AttributeValue{":o": &types.AttributeValueMemberS{Value: "m"}}}},
+			},
+			expectedKeys: []string{"a/2", "b/1"},
+		},
+		"a failed condition cancels every action": {
+			items: []types.TransactWriteItem{
+				{Put: &types.Put{TableName: aws.String(testTableName), Item: key("a", "2")}},
+				{ConditionCheck: &types.ConditionCheck{TableName: aws.String(testTableName), Key: key("c", "1"), ConditionExpression: exists, ExpressionAttributeNames: names}},
+			},
+			expectedError:   "TransactionCanceledException",
+			expectedReasons: []string{"None", "ConditionalCheckFailed"},
+			expectedKeys:    []string{"a/1"},
+		},
+		"two actions on one item": {
+			items: []types.TransactWriteItem{
+				{Put: &types.Put{TableName: aws.String(testTableName), Item: key("a", "2")}},
+				{Delete: &types.Delete{TableName: aws.String(testTableName), Key: key("a", "2")}},
+			},
+			expectedError: "ValidationException",
+			expectedKeys:  []string{"a/1"},
+		},
+		"no actions": {
+			expectedError: "ValidationException",
+			expectedKeys:  []string{"a/1"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewNotesTable(testTableName)
+			if _, err := ddb.AddNote(ctx, client, testTableName, &schema.Note{Owner: "a", Title: "1"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: tt.items})
+
+			var apiErr smithy.APIError
+			if tt.expectedError == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if tt.expectedError != "" && (!errors.As(err, &apiErr) || apiErr.ErrorCode() != tt.expectedError) {
+				t.Fatalf("expected a %s but got %v", tt.expectedError, err)
+			}
+			var reasons []string
+			var tce *types.TransactionCanceledException
+			if errors.As(err, &tce) {
+				for _, r := range tce.CancellationReasons {
+					reasons = append(reasons, aws.ToString(r.Code))
+				}
+			}
+			if !reflect.DeepEqual(tt.expectedReasons, reasons) {
+				t.Errorf("expected cancellation reasons %v but got %v", tt.expectedReasons, reasons)
+			}
+			var keys []string
+			for _, item := range client.Items(testTableName) {
+				keys = append(keys, item["owner"].(*types.AttributeValueMemberS).Value+"/"+item["title"].(*types.AttributeValueMemberS).Value)
+			}
+			if !reflect.DeepEqual(tt.expectedKeys, keys) {
+				t.Errorf("expected keys %v but got %v", tt.expectedKeys, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,748 @@
+package ddbfake
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strings"
+	"unicode"
+)
+
+// Item is a single DynamoDB item
+type Item = map[string]types.AttributeValue
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenName
+	tokenValue
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':' || isIdentRune(r):
+			start := i
+			i++
+			for i < len(runes) && isIdentRune(runes[i]) {
+				i++
+			}
+			kind := tokenIdent
+			if r == '#' {
+				kind = tokenName
+			} else if r == ':' {
+				kind = tokenValue
+			}
+			if (kind == tokenName || kind == tokenValue) && i == start+1 {
+				return nil, fmt.Errorf("invalid token %q at position %d", string(r), start)
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[start:i])})
+		case strings.ContainsRune("(),.[]+-", r):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r)})
+			i++
+		case r == '=':
+			tokens = append(tokens, token{kind: tokenPunct, text: "="})
+			i++
+		case r == '<' || r == '>':
+			text := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				text += string(runes[i+1])
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: text})
+			i += len(text)
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parser turns the expression strings of a request in to evaluable trees, resolving the ExpressionAttributeNames and
+// ExpressionAttributeValues as it goes.
+type parser struct {
+	tokens []token
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func newParser(expr string, names map[string]string, values map[string]types.AttributeValue) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{tokens: tokens, names: names, values: values}, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token when it is the given punctuation or (case insensitive) keyword
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenPunct || t.kind == tokenIdent) && strings.EqualFold(t.text, text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q but found %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) expectEOF() error {
+	if t := p.peek(); t.kind != tokenEOF {
+		return fmt.Errorf("unexpected token %q", t.text)
+	}
+	return nil
+}
+
+// operand is a path, value or function that resolves to an attribute value for an item
+type operand interface {
+	resolve(item Item) (types.AttributeValue, bool)
+}
+
+type pathOperand string
+
+func (o pathOperand) resolve(item Item) (types.AttributeValue, bool) {
+	av, ok := item[string(o)]
+	return av, ok
+}
+
+type valueOperand struct{ av types.AttributeValue }
+
+func (o valueOperand) resolve(Item) (types.AttributeValue, bool) { return o.av, true }
+
+type sizeOperand struct{ path pathOperand }
+
+func (o sizeOperand) resolve(item Item) (types.AttributeValue, bool) {
+	av, ok := item[string(o.path)]
+	if !ok {
+		return nil, false
+	}
+	n, ok := size(av)
+	if !ok {
+		return nil, false
+	}
+	return &types.AttributeValueMemberN{Value: fmt.Sprint(n)}, true
+}
+
+// path parses a top level attribute name, either literal or a placeholder from ExpressionAttributeNames
+func (p *parser) path() (pathOperand, error) {
+	t := p.next()
+	var name string
+	switch t.kind {
+	case tokenName:
+		resolved, ok := p.names[t.text]
+		if !ok {
+			return "", fmt.Errorf("an expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+		}
+		name = resolved
+	case tokenIdent:
+		if isReservedWord(t.text) {
+			return "", fmt.Errorf("attribute name is a reserved keyword; reserved keyword: %s", t.text)
+		}
+		name = t.text
+	default:
+		return "", fmt.Errorf("expected an attribute name but found %q", t.text)
+	}
+	if next := p.peek(); next.kind == tokenPunct && (next.text == "." || next.text == "[") {
+		return "", fmt.Errorf("nested attribute paths are not supported: %s%s", name, next.text)
+	}
+	return pathOperand(name), nil
+}
+
+func (p *parser) value() (valueOperand, error) {
+	t := p.next()
+	if t.kind != tokenValue {
+		return valueOperand{}, fmt.Errorf("expected an attribute value but found %q", t.text)
+	}
+	av, ok := p.values[t.text]
+	if !ok {
+		return valueOperand{}, fmt.Errorf("an expression attribute value used in expression is not defined; attribute value: %s", t.text)
+	}
+	return valueOperand{av: av}, nil
+}
+
+func (p *parser) operand() (operand, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenValue:
+		return p.value()
+	case t.kind == tokenIdent && strings.EqualFold(t.text, "size") && p.tokens[p.pos+1].text == "(":
+		p.pos += 2
+		path, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		return sizeOperand{path: path}, p.expect(")")
+	default:
+		return p.path()
+	}
+}
+
+// condition is a parsed ConditionExpression, FilterExpression or KeyConditionExpression
+type condition interface {
+	eval(item Item) (bool, error)
+}
+
+type andCondition struct{ left, right condition }
+
+func (c andCondition) eval(item Item) (bool, error) {
+	ok, err := c.left.eval(item)
+	if err != nil || !ok {
+		return false, err
+	}
+	return c.right.eval(item)
+}
+
+type orCondition struct{ left, right condition }
+
+func (c orCondition) eval(item Item) (bool, error) {
+	ok, err := c.left.eval(item)
+	if err != nil || ok {
+		return ok, err
+	}
+	return c.right.eval(item)
+}
+
+type notCondition struct{ inner condition }
+
+func (c notCondition) eval(item Item) (bool, error) {
+	ok, err := c.inner.eval(item)
+	return !ok, err
+}
+
+type comparison struct {
+	op          string
+	left, right operand
+}
+
+func (c comparison) eval(item Item) (bool, error) {
+	left, lok := c.left.resolve(item)
+	right, rok := c.right.resolve(item)
+	if !lok || !rok {
+		return false, nil
+	}
+	switch c.op {
+	case "=":
+		return equal(left, right), nil
+	case "<>":
+		return !equal(left, right), nil
+	}
+	cmp, ok := compare(left, right)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type betweenCondition struct{ target, low, high operand }
+
+func (c betweenCondition) eval(item Item) (bool, error) {
+	ge, err := comparison{op: ">=", left: c.target, right: c.low}.eval(item)
+	if err != nil || !ge {
+		return false, err
+	}
+	return comparison{op: "<=", left: c.target, right: c.high}.eval(item)
+}
+
+type inCondition struct {
+	target  operand
+	choices []operand
+}
+
+func (c inCondition) eval(item Item) (bool, error) {
+	for _, choice := range c.choices {
+		if ok, err := (comparison{op: "=", left: c.target, right: choice}).eval(item); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+type functionCondition struct {
+	name string
+	args []operand
+}
+
+func (c functionCondition) eval(item Item) (bool, error) {
+	first, exists := c.args[0].resolve(item)
+	switch c.name {
+	case "attribute_exists":
+		return exists, nil
+	case "attribute_not_exists":
+		return !exists, nil
+	}
+	second, _ := c.args[1].resolve(item)
+	if !exists {
+		return false, nil
+	}
+	switch c.name {
+	case "attribute_type":
+		want, ok := second.(*types.AttributeValueMemberS)
+		return ok && typeName(first) == want.Value, nil
+	case "begins_with":
+		return beginsWith(first, second), nil
+	default:
+		return contains(first, second), nil
+	}
+}
+
+var conditionFunctions = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+// parseCondition parses a condition or filter expression
+func parseCondition(expr string, names map[string]string, values map[string]types.AttributeValue) (condition, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.expectEOF()
+}
+
+func (p *parser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (condition, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = andCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (condition, error) {
+	if p.accept("NOT") {
+		inner, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{inner: inner}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (condition, error) {
+	if p.accept("(") {
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+	if t := p.peek(); t.kind == tokenIdent && p.tokens[p.pos+1].text == "(" {
+		if arity, ok := conditionFunctions[strings.ToLower(t.text)]; ok {
+			return p.function(strings.ToLower(t.text), arity)
+		}
+	}
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	switch t := p.next(); {
+	case t.kind == tokenPunct && isComparator(t.text):
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return comparison{op: t.text, left: left, right: right}, nil
+	case strings.EqualFold(t.text, "BETWEEN"):
+		low, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenCondition{target: left, low: low, high: high}, nil
+	case strings.EqualFold(t.text, "IN"):
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		in := inCondition{target: left}
+		for {
+			choice, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			in.choices = append(in.choices, choice)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return in, p.expect(")")
+	default:
+		return nil, fmt.Errorf("expected a comparison but found %q", t.text)
+	}
+}
+
+func (p *parser) function(name string, arity int) (condition, error) {
+	p.pos += 2
+	fn := functionCondition{name: name}
+	path, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	fn.args = append(fn.args, path)
+	if arity == 2 {
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+		arg, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		fn.args = append(fn.args, arg)
+	}
+	return fn, p.expect(")")
+}
+
+func isComparator(text string) bool {
+	switch text {
+	case "=", "<>", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// keyCondition is a parsed KeyConditionExpression
+type keyCondition struct {
+	condition
+	partitionValue types.AttributeValue
+}
+
+// parseKeyCondition parses a key condition, which must test the partition key for equality and may contain a single
+// condition on the sort key.
+func parseKeyCondition(expr string, names map[string]string, values map[string]types.AttributeValue, hashKey, rangeKey string) (*keyCondition, error) {
+	c, err := parseCondition(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	var terms []condition
+	var flatten func(c condition) error
+	flatten = func(c condition) error {
+		switch t := c.(type) {
+		case andCondition:
+			if err := flatten(t.left); err != nil {
+				return err
+			}
+			return flatten(t.right)
+		case comparison, betweenCondition, functionCondition:
+			terms = append(terms, c)
+			return nil
+		default:
+			return fmt.Errorf("invalid operator used in KeyConditionExpression")
+		}
+	}
+	if err = flatten(c); err != nil {
+		return nil, err
+	}
+	kc := &keyCondition{condition: c}
+	for _, term := range terms {
+		switch t := term.(type) {
+		case comparison:
+			path, ok := t.left.(pathOperand)
+			value, isValue := t.right.(valueOperand)
+			if !ok || !isValue {
+				return nil, fmt.Errorf("invalid KeyConditionExpression: key conditions must compare an attribute to a value")
+			}
+			if string(path) == hashKey && t.op == "=" && kc.partitionValue == nil {
+				kc.partitionValue = value.av
+				continue
+			}
+			if string(path) != rangeKey || t.op == "<>" {
+				return nil, fmt.Errorf("query key condition not supported")
+			}
+		case betweenCondition:
+			if path, ok := t.target.(pathOperand); !ok || string(path) != rangeKey {
+				return nil, fmt.Errorf("query key condition not supported")
+			}
+		case functionCondition:
+			if path, ok := t.args[0].(pathOperand); t.name != "begins_with" || !ok || string(path) != rangeKey {
+				return nil, fmt.Errorf("query key condition not supported")
+			}
+		}
+	}
+	if kc.partitionValue == nil || len(terms) > 2 {
+		return nil, fmt.Errorf("query condition missed key schema element: %s", hashKey)
+	}
+	return kc, nil
+}
+
+// updateAction is a single action in an UpdateExpression
+type updateAction struct {
+	clause string
+	path   pathOperand
+	value  setValue
+}
+
+// setValue is the right hand side of a SET action or the value of an ADD or DELETE action
+type setValue interface {
+	compute(item Item) (types.AttributeValue, error)
+}
+
+type operandValue struct{ operand }
+
+func (v operandValue) compute(item Item) (types.AttributeValue, error) {
+	av, ok := v.resolve(item)
+	if !ok {
+		return nil, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+	}
+	return av, nil
+}
+
+type ifNotExistsValue struct {
+	path     pathOperand
+	fallback setValue
+}
+
+func (v ifNotExistsValue) compute(item Item) (types.AttributeValue, error) {
+	if av, ok := item[string(v.path)]; ok {
+		return av, nil
+	}
+	return v.fallback.compute(item)
+}
+
+type listAppendValue struct{ first, second setValue }
+
+func (v listAppendValue) compute(item Item) (types.AttributeValue, error) {
+	first, err := v.first.compute(item)
+	if err != nil {
+		return nil, err
+	}
+	second, err := v.second.compute(item)
+	if err != nil {
+		return nil, err
+	}
+	a, aok := first.(*types.AttributeValueMemberL)
+	b, bok := second.(*types.AttributeValueMemberL)
+	if !aok || !bok {
+		return nil, fmt.Errorf("incorrect operand type for operator or function; operator or function: list_append")
+	}
+	joined := append(append([]types.AttributeValue{}, a.Value...), b.Value...)
+	return &types.AttributeValueMemberL{Value: joined}, nil
+}
+
+type arithmeticValue struct {
+	op          string
+	left, right setValue
+}
+
+func (v arithmeticValue) compute(item Item) (types.AttributeValue, error) {
+	left, err := v.left.compute(item)
+	if err != nil {
+		return nil, err
+	}
+	right, err := v.right.compute(item)
+	if err != nil {
+		return nil, err
+	}
+	return addNumbers(left, right, v.op == "-")
+}
+
+// parseUpdate parses an UpdateExpression in to its actions
+func parseUpdate(expr string, names map[string]string, values map[string]types.AttributeValue) ([]updateAction, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	var actions []updateAction
+	seen := make(map[string]bool)
+	for p.peek().kind != tokenEOF {
+		clause := strings.ToUpper(p.next().text)
+		switch clause {
+		case "SET", "REMOVE", "ADD", "DELETE":
+		default:
+			return nil, fmt.Errorf("invalid UpdateExpression: syntax error; token: %q", clause)
+		}
+		if seen[clause] {
+			return nil, fmt.Errorf("the %q section can only be used once in an update expression", clause)
+		}
+		seen[clause] = true
+		for {
+			action := updateAction{clause: clause}
+			if action.path, err = p.path(); err != nil {
+				return nil, err
+			}
+			switch clause {
+			case "SET":
+				if err = p.expect("="); err != nil {
+					return nil, err
+				}
+				action.value, err = p.setValue()
+			case "ADD", "DELETE":
+				var v valueOperand
+				v, err = p.value()
+				action.value = operandValue{v}
+			}
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, action)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("invalid UpdateExpression: the expression can not be empty")
+	}
+	return actions, nil
+}
+
+func (p *parser) setValue() (setValue, error) {
+	left, err := p.setTerm()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"+", "-"} {
+		if p.accept(op) {
+			right, err := p.setTerm()
+			if err != nil {
+				return nil, err
+			}
+			return arithmeticValue{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) setTerm() (setValue, error) {
+	t := p.peek()
+	if t.kind == tokenIdent && p.tokens[p.pos+1].text == "(" {
+		switch strings.ToLower(t.text) {
+		case "if_not_exists":
+			p.pos += 2
+			path, err := p.path()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(","); err != nil {
+				return nil, err
+			}
+			fallback, err := p.setTerm()
+			if err != nil {
+				return nil, err
+			}
+			return ifNotExistsValue{path: path, fallback: fallback}, p.expect(")")
+		case "list_append":
+			p.pos += 2
+			first, err := p.setTerm()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(","); err != nil {
+				return nil, err
+			}
+			second, err := p.setTerm()
+			if err != nil {
+				return nil, err
+			}
+			return listAppendValue{first: first, second: second}, p.expect(")")
+		}
+	}
+	o, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return operandValue{o}, nil
+}
+
+// parseProjection parses a ProjectionExpression in to the attribute names to return
+func parseProjection(expr string, names map[string]string) ([]string, error) {
+	p, err := newParser(expr, names, nil)
+	if err != nil {
+		return nil, err
+	}
+	var attributes []string
+	for {
+		path, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, string(path))
+		if !p.accept(",") {
+			break
+		}
+	}
+	return attributes, p.expectEOF()
+}
+
+// isReservedWord reports whether a literal attribute name clashes with the keywords this fake understands.  DynamoDB
+// reserves several hundred words; the ones checked here are those that would otherwise be ambiguous to the parser.
+func isReservedWord(word string) bool {
+	switch strings.ToUpper(word) {
+	case "AND", "OR", "NOT", "BETWEEN", "IN", "SET", "REMOVE", "ADD", "DELETE", "OWNER", "TIMESTAMP", "SIZE":
+		return true
+	}
+	return false
+}
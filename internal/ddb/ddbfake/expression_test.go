@@ -0,0 +1,93 @@
+package ddbfake
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	item := Item{
+		"owner":   &types.AttributeValueMemberS{Value: "test-owner"},
+		"version": &types.AttributeValueMemberN{Value: "3"},
+		"tags":    &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+	}
+	names := map[string]string{"#o": "owner", "#v": "version", "#t": "tags", "#m": "missing"}
+	values := map[string]types.AttributeValue{
+		":o":   &types.AttributeValueMemberS{Value: "test-owner"},
+		":p":   &types.AttributeValueMemberS{Value: "test"},
+		":one": &types.AttributeValueMemberN{Value: "1"},
+		":two": &types.AttributeValueMemberN{Value: "2.0"},
+		":ten": &types.AttributeValueMemberN{Value: "1e1"},
+		":a":   &types.AttributeValueMemberS{Value: "a"},
+	}
+	cases := map[string]struct {
+		expr      string
+		expected  bool
+		expectErr bool
+	}{
+		"equality":                   {expr: "#o = :o", expected: true},
+		"numbers compare by value":   {expr: "#v > :two AND #v < :ten", expected: true},
+		"between":                    {expr: "#v BETWEEN :one AND :two", expected: false},
+		"in":                         {expr: "#v IN (:one, :two)", expected: false},
+		"precedence of and over or":  {expr: "#o = :p OR #o = :o AND #v = :one", expected: false},
+		"parentheses and not":        {expr: "NOT (#o = :p) AND (attribute_not_exists (#m))", expected: true},
+		"begins_with":                {expr: "begins_with (#o, :p)", expected: true},
+		"contains on a set":          {expr: "contains(#t, :a)", expected: true},
+		"size":                       {expr: "size (#t) = :two", expected: true},
+		"missing attribute is false": {expr: "#m <> :o", expected: false},
+		"undefined name":             {expr: "#x = :o", expectErr: true},
+		"trailing tokens":            {expr: "#o = :o :o", expectErr: true},
+		"nested path":                {expr: "#o.inner = :o", expectErr: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, err := parseCondition(tt.expr, names, values)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected an error parsing %q", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got, err := c.eval(item)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q to be %t", tt.expr, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseKeyCondition(t *testing.T) {
+	names := map[string]string{"#o": "owner", "#t": "title", "#m": "message"}
+	values := map[string]types.AttributeValue{
+		":o": &types.AttributeValueMemberS{Value: "test-owner"},
+		":t": &types.AttributeValueMemberS{Value: "test"},
+	}
+	cases := map[string]struct {
+		expr      string
+		expectErr bool
+	}{
+		"partition key only":       {expr: "#o = :o"},
+		"sort key prefix":          {expr: "(#o = :o) AND (begins_with (#t, :t))"},
+		"sort key range":           {expr: "#o = :o AND #t BETWEEN :t AND :t"},
+		"missing partition key":    {expr: "#t = :t", expectErr: true},
+		"or is not allowed":        {expr: "#o = :o OR #t = :t", expectErr: true},
+		"non key attribute":        {expr: "#o = :o AND #m = :t", expectErr: true},
+		"partition key inequality": {expr: "#o > :o", expectErr: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseKeyCondition(tt.expr, names, values, "owner", "title")
+			if (err != nil) != tt.expectErr {
+				t.Errorf("expected error %t but got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package ddbfake
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"sort"
+)
+
+// index is a global secondary index.  It is maintained on read: the items of the table that have every key attribute of
+// the index are projected and sorted when the index is queried or scanned, which is always consistent.
+type index struct {
+	description types.GlobalSecondaryIndexDescription
+	hashKey     string
+	rangeKey    string
+	projection  types.Projection
+}
+
+// newIndex validates a global secondary index of the CreateTableInput against the attribute definitions of the table
+func newIndex(t *table, gsi types.GlobalSecondaryIndex) (*index, error) {
+	name := aws.ToString(gsi.IndexName)
+	if name == "" {
+		return nil, validationError("index name must be provided")
+	}
+	idx := &index{projection: types.Projection{ProjectionType: types.ProjectionTypeAll}}
+	if gsi.Projection != nil && gsi.Projection.ProjectionType != "" {
+		idx.projection = *gsi.Projection
+	}
+	for _, element := range gsi.KeySchema {
+		attribute := aws.ToString(element.AttributeName)
+		if _, ok := t.attributeTypes[attribute]; !ok {
+			return nil, validationError("no attribute definition for key attribute %s of index %s", attribute, name)
+		}
+		if element.KeyType == types.KeyTypeHash {
+			idx.hashKey = attribute
+		} else {
+			idx.rangeKey = attribute
+		}
+	}
+	if idx.hashKey == "" {
+		return nil, validationError("the key schema of index %s must contain a HASH key", name)
+	}
+	idx.description = types.GlobalSecondaryIndexDescription{
+		IndexName:             gsi.IndexName,
+		KeySchema:             gsi.KeySchema,
+		Projection:            &idx.projection,
+		ProvisionedThroughput: throughputDescription(gsi.ProvisionedThroughput),
+		IndexStatus:           types.IndexStatusActive,
+	}
+	return idx, nil
+}
+
+func (idx *index) keyAttributes() []string {
+	if idx.rangeKey == "" {
+		return []string{idx.hashKey}
+	}
+	return []string{idx.hashKey, idx.rangeKey}
+}
+
+// order is the order of the index: its own keys followed by the primary key of the table, which is also the key returned
+// as the LastEvaluatedKey
+func (idx *index) order(t *table) keyOrder {
+	order := keyOrder(idx.keyAttributes())
+	for _, attribute := range t.keyAttributes() {
+		if !order.contains(attribute) {
+			order = append(order, attribute)
+		}
+	}
+	return order
+}
+
+// items returns the projected items of the index in index order
+func (idx *index) items(t *table) []Item {
+	order := idx.order(t)
+	var items []Item
+	for _, item := range t.items {
+		if idx.contains(t, item) {
+			items = append(items, idx.project(order, item))
+		}
+	}
+	order.sort(items)
+	return items
+}
+
+// contains reports whether the item has every key attribute of the index with the type given in its definition
+func (idx *index) contains(t *table, item Item) bool {
+	for _, attribute := range idx.keyAttributes() {
+		av, ok := item[attribute]
+		if !ok || typeName(av) != string(t.attributeTypes[attribute]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *index) project(order keyOrder, item Item) Item {
+	if idx.projection.ProjectionType == types.ProjectionTypeAll {
+		return item
+	}
+	projected := order.key(item)
+	if idx.projection.ProjectionType == types.ProjectionTypeInclude {
+		for _, attribute := range idx.projection.NonKeyAttributes {
+			if av, ok := item[attribute]; ok {
+				projected[attribute] = av
+			}
+		}
+	}
+	return projected
+}
+
+// keyOrder lists the attributes items are sorted by when they are read, which are also the attributes of the
+// LastEvaluatedKey
+type keyOrder []string
+
+func (o keyOrder) contains(attribute string) bool {
+	for _, a := range o {
+		if a == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// compare orders two items by each attribute in turn
+func (o keyOrder) compare(a, b Item) int {
+	for _, attribute := range o {
+		if cmp, _ := compare(a[attribute], b[attribute]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// after reports whether item comes after the ExclusiveStartKey in the direction of the read
+func (o keyOrder) after(item, startKey Item, forward bool) bool {
+	cmp := o.compare(item, startKey)
+	if forward {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func (o keyOrder) key(item Item) Item {
+	key := make(Item)
+	for _, attribute := range o {
+		key[attribute] = item[attribute]
+	}
+	return key
+}
+
+func (o keyOrder) sort(items []Item) {
+	sort.Slice(items, func(i, j int) bool {
+		return o.compare(items[i], items[j]) < 0
+	})
+}
+
+func throughputDescription(throughput *types.ProvisionedThroughput) *types.ProvisionedThroughputDescription {
+	if throughput == nil {
+		return nil
+	}
+	return &types.ProvisionedThroughputDescription{
+		ReadCapacityUnits:  throughput.ReadCapacityUnits,
+		WriteCapacityUnits: throughput.WriteCapacityUnits,
+	}
+}
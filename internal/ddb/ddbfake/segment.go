@@ -0,0 +1,63 @@
+package ddbfake
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"hash/fnv"
+)
+
+// maxTotalSegments is the largest TotalSegments DynamoDB accepts for a parallel scan
+const maxTotalSegments = 1000000
+
+// segment returns the items that belong to the Segment of a parallel scan, or every item when the scan is not parallel.
+// Items are assigned to a segment by a hash of their partition key.
+func segment(items []Item, hashKey string, segment, totalSegments *int32) ([]Item, error) {
+	if segment == nil && totalSegments == nil {
+		return items, nil
+	}
+	if totalSegments == nil {
+		return nil, validationError("the TotalSegments parameter is required but was not present in the request when Segment parameter is present")
+	}
+	if segment == nil {
+		return nil, validationError("the Segment parameter is required but was not present in the request when parameter TotalSegments is present")
+	}
+	if *totalSegments < 1 || *totalSegments > maxTotalSegments {
+		return nil, validationError("1 validation error detected: value at 'totalSegments' failed to satisfy constraint: member must have value between 1 and %d", maxTotalSegments)
+	}
+	if *segment < 0 || *segment >= *totalSegments {
+		return nil, validationError("the Segment parameter is zero-based and must be less than parameter TotalSegments")
+	}
+	var matches []Item
+	for _, item := range items {
+		if segmentOf(item[hashKey], *totalSegments) == *segment {
+			matches = append(matches, item)
+		}
+	}
+	return matches, nil
+}
+
+func segmentOf(partitionKey types.AttributeValue, totalSegments int32) int32 {
+	h := fnv.New32a()
+	switch v := partitionKey.(type) {
+	case *types.AttributeValueMemberS:
+		h.Write([]byte(v.Value))
+	case *types.AttributeValueMemberN:
+		if r, err := parseNumber(v.Value); err == nil {
+			h.Write([]byte(formatNumber(r)))
+		}
+	case *types.AttributeValueMemberB:
+		h.Write(v.Value)
+	}
+	return int32(h.Sum32() % uint32(totalSegments))
+}
+
+// consumedCapacity reports the read capacity of the scanned items when it was asked for
+func consumedCapacity(tableName *string, returnCapacity types.ReturnConsumedCapacity, scanned int32) *types.ConsumedCapacity {
+	if returnCapacity == "" || returnCapacity == types.ReturnConsumedCapacityNone {
+		return nil
+	}
+	return &types.ConsumedCapacity{
+		TableName:     tableName,
+		CapacityUnits: aws.Float64(float64(scanned) / 2),
+	}
+}
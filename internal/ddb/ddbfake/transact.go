@@ -0,0 +1,161 @@
+package ddbfake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strings"
+)
+
+// maxTransactItems is the largest number of actions DynamoDB accepts in a single TransactWriteItems call
+const maxTransactItems = 100
+
+// transactAction is a single validated action of a TransactWriteItems call
+type transactAction struct {
+	table *table
+	key   string
+	// result is the item once the action is applied, nil when the item is deleted or only checked
+	result Item
+	// write is false for a ConditionCheck
+	write bool
+	// condition is evaluated against the current item before any action is applied
+	condition      *string
+	names          map[string]string
+	values         map[string]types.AttributeValue
+	returnOnFailed types.ReturnValuesOnConditionCheckFailure
+}
+
+// TransactWriteItems applies every action or none of them.  When a condition fails the call returns a
+// TransactionCanceledException with a CancellationReason for every action, in request order.
+func (c *Client) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(input.TransactItems) == 0 || len(input.TransactItems) > maxTransactItems {
+		return nil, validationError("1 validation error detected: value at 'transactItems' failed to satisfy constraint: member must have length between 1 and %d", maxTransactItems)
+	}
+	actions := make([]*transactAction, 0, len(input.TransactItems))
+	seen := make(map[string]bool, len(input.TransactItems))
+	for _, item := range input.TransactItems {
+		action, err := c.transactAction(item)
+		if err != nil {
+			return nil, err
+		}
+		id := aws.ToString(action.table.description.TableName) + "\x00" + action.key
+		if seen[id] {
+			return nil, validationError("transaction request cannot include multiple operations on one item")
+		}
+		seen[id] = true
+		actions = append(actions, action)
+	}
+
+	reasons := make([]types.CancellationReason, len(actions))
+	var codes []string
+	canceled := false
+	for i, action := range actions {
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+		old := action.table.items[action.key]
+		err := checkCondition(action.condition, action.names, action.values, old)
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			canceled = true
+			reasons[i] = types.CancellationReason{Code: aws.String("ConditionalCheckFailed"), Message: ccf.Message}
+			if action.returnOnFailed == types.ReturnValuesOnConditionCheckFailureAllOld {
+				reasons[i].Item = copyItem(old)
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		codes = append(codes, aws.ToString(reasons[i].Code))
+	}
+	if canceled {
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, action := range actions {
+		if !action.write {
+			continue
+		}
+		if action.result == nil {
+			delete(action.table.items, action.key)
+		} else {
+			action.table.items[action.key] = action.result
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// transactAction validates a single action and works out the item it writes
+func (c *Client) transactAction(item types.TransactWriteItem) (*transactAction, error) {
+	set := 0
+	for _, present := range []bool{item.ConditionCheck != nil, item.Put != nil, item.Delete != nil, item.Update != nil} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, validationError("a TransactWriteItem must contain exactly one of ConditionCheck, Put, Delete and Update")
+	}
+	switch {
+	case item.ConditionCheck != nil:
+		in := item.ConditionCheck
+		t, err := c.keyedTable(in.TableName, in.Key)
+		if err != nil {
+			return nil, err
+		}
+		if in.ConditionExpression == nil {
+			return nil, validationError("the ConditionExpression of a ConditionCheck must be provided")
+		}
+		return &transactAction{table: t, key: t.keyString(in.Key), condition: in.ConditionExpression, names: in.ExpressionAttributeNames,
+			values: in.ExpressionAttributeValues, returnOnFailed: in.ReturnValuesOnConditionCheckFailure}, nil
+	case item.Put != nil:
+		in := item.Put
+		t, err := c.table(in.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if err = t.validateItem(in.Item); err != nil {
+			return nil, err
+		}
+		return &transactAction{table: t, key: t.keyString(in.Item), result: copyItem(in.Item), write: true, condition: in.ConditionExpression,
+			names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues, returnOnFailed: in.ReturnValuesOnConditionCheckFailure}, nil
+	case item.Delete != nil:
+		in := item.Delete
+		t, err := c.keyedTable(in.TableName, in.Key)
+		if err != nil {
+			return nil, err
+		}
+		return &transactAction{table: t, key: t.keyString(in.Key), write: true, condition: in.ConditionExpression,
+			names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues, returnOnFailed: in.ReturnValuesOnConditionCheckFailure}, nil
+	default:
+		in := item.Update
+		t, err := c.keyedTable(in.TableName, in.Key)
+		if err != nil {
+			return nil, err
+		}
+		key := t.keyString(in.Key)
+		updated, _, err := t.update(t.items[key], in.Key, in.UpdateExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		return &transactAction{table: t, key: key, result: updated, write: true, condition: in.ConditionExpression,
+			names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues, returnOnFailed: in.ReturnValuesOnConditionCheckFailure}, nil
+	}
+}
+
+// keyedTable returns the named table after checking that key is a valid primary key for it
+func (c *Client) keyedTable(name *string, key Item) (*table, error) {
+	t, err := c.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.validateKey(key); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,169 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"log"
+)
+
+// DynamoMigrateAPI is the set of DynamoDB Client functions needed to migrate stored Notes
+type DynamoMigrateAPI interface {
+	DynamoScanAPI
+	DynamoUpdateItemAPI
+}
+
+// MigrateTimestamps rewrites every Note whose timestamp is still recorded in epoch seconds to epoch millis, and gives
+// every Note without one the expires_at read by the table's TTL, returning the number of Notes that were rewritten.
+//
+// Each Note is only rewritten while its timestamp still holds the value that was scanned, so a Note written during the
+// migration keeps its new timestamp.  Running the migration again is safe.
+func MigrateTimestamps(ctx context.Context, api DynamoMigrateAPI, tableName string) (int, error) {
+	if tableName == "" {
+		return 0, errors.New("tableName must be provided")
+	}
+	timestamp := expression.Name("timestamp")
+	expr, err := expression.NewBuilder().
+		WithFilter(timestamp.LessThan(expression.Value(schema.SecondTimestampLimit)).
+			Or(expression.AttributeNotExists(expression.Name("expires_at")))).
+		WithProjection(expression.NamesList(expression.Name("owner"), expression.Name("title"), timestamp)).
+		Build()
+	if err != nil {
+		return 0, err
+	}
+
+	migrated, err := migrateEach(ctx, api, tableName, expr, migrateTimestamp)
+	log.Printf("migrated %d timestamps in %s\n", migrated, tableName)
+	return migrated, err
+}
+
+// migrateTimestamp rewrites the timestamp and expires_at of a single Note, reporting false when the Note changed since it
+// was scanned
+func migrateTimestamp(ctx context.Context, api DynamoUpdateItemAPI, tableName string, note schema.Note) (bool, error) {
+	keys, err := noteKey(note.Owner, note.Title)
+	if err != nil {
+		return false, err
+	}
+	timestamp := expression.Name("timestamp")
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.
+			Set(timestamp, expression.Value(schema.NormalizeTimestamp(note.Timestamp))).
+			Set(expression.Name("expires_at"), expression.Value(schema.ExpiresAtFromTimestamp(note.Timestamp)))).
+		WithCondition(timestamp.Equal(expression.Value(note.Timestamp))).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	_, err = api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       keys,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		log.Printf("note %q for owner %q changed during the migration, skipping\n", note.Title, note.Owner)
+		return false, nil
+	} else if err != nil {
+		return false, wrapClientError(err)
+	}
+	return true, nil
+}
+
+// BackfillRecentNotesIndex adds every Note written before the schema.RecentNotesIndexName index existed to the index,
+// returning the number of Notes that were updated.  Notes without an updated_at take it from their timestamp.
+//
+// Running the backfill again is safe, Notes already in the index are skipped.
+func BackfillRecentNotesIndex(ctx context.Context, api DynamoMigrateAPI, tableName string) (int, error) {
+	if tableName == "" {
+		return 0, errors.New("tableName must be provided")
+	}
+	partition := expression.Name(schema.RecentNotesPartitionAttribute)
+	updatedAt := expression.Name("updated_at")
+	expr, err := expression.NewBuilder().
+		WithFilter(expression.AttributeNotExists(partition).Or(expression.AttributeNotExists(updatedAt))).
+		WithProjection(expression.NamesList(expression.Name("owner"), expression.Name("title"), expression.Name("timestamp"))).
+		Build()
+	if err != nil {
+		return 0, err
+	}
+
+	backfilled, err := migrateEach(ctx, api, tableName, expr, backfillRecentNote)
+	log.Printf("added %d notes to %s in %s\n", backfilled, schema.RecentNotesIndexName, tableName)
+	return backfilled, err
+}
+
+// backfillRecentNote adds a single Note to the index, reporting false when the Note was deleted since it was scanned
+func backfillRecentNote(ctx context.Context, api DynamoUpdateItemAPI, tableName string, note schema.Note) (bool, error) {
+	keys, err := noteKey(note.Owner, note.Title)
+	if err != nil {
+		return false, err
+	}
+	updatedAt := expression.Name("updated_at")
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.
+			Set(expression.Name(schema.RecentNotesPartitionAttribute), expression.Value(schema.RecentNotesPartition)).
+			Set(updatedAt, updatedAt.IfNotExists(expression.Value(schema.NormalizeTimestamp(note.Timestamp))))).
+		WithCondition(expression.AttributeExists(expression.Name("owner"))).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	_, err = api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       keys,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		log.Printf("note %q for owner %q was deleted during the backfill, skipping\n", note.Title, note.Owner)
+		return false, nil
+	} else if err != nil {
+		return false, wrapClientError(err)
+	}
+	return true, nil
+}
+
+// migrateEach scans the table with the filter and projection of expr and calls migrate with every Note found, returning
+// the number of Notes that migrate reported as changed
+func migrateEach(ctx context.Context, api DynamoMigrateAPI, tableName string, expr expression.Expression,
+	migrate func(ctx context.Context, api DynamoUpdateItemAPI, tableName string, note schema.Note) (bool, error)) (int, error) {
+	changed := 0
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+	for {
+		output, err := api.Scan(ctx, input)
+		if err != nil {
+			return changed, wrapClientError(err)
+		}
+		var notes []schema.Note
+		if err = attributevalue.UnmarshalListOfMaps(output.Items, &notes); err != nil {
+			return changed, err
+		}
+		for _, note := range notes {
+			ok, err := migrate(ctx, api, tableName, note)
+			if err != nil {
+				return changed, err
+			}
+			if ok {
+				changed++
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			return changed, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,90 @@
+package ddb
+
+import (
+	"context"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"testing"
+)
+
+func TestMigrateTimestamps(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable("notes")
+	stored := []schema.Note{
+		{Owner: "a", Title: "seconds", Timestamp: 1638999997},
+		{Owner: "a", Title: "millis", Timestamp: 1638999997123, ExpiresAt: 1638999997},
+		{Owner: "a", Title: "millis without ttl", Timestamp: 1638999998123},
+		{Owner: "b", Title: "seconds", Timestamp: 1639000000},
+	}
+	for _, note := range stored {
+		item, err := attributevalue.MarshalMap(note)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err = api.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("notes"), Item: item}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	migrated, err := MigrateTimestamps(ctx, api, "notes")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if migrated != 3 {
+		t.Errorf("expected 3 notes to be migrated but got %d", migrated)
+	}
+	expected := map[string]int64{"a/seconds": 1638999997000, "a/millis": 1638999997123, "a/millis without ttl": 1638999998123, "b/seconds": 1639000000000}
+	var notes []schema.Note
+	if err = attributevalue.UnmarshalListOfMaps(api.Items("notes"), &notes); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, note := range notes {
+		if ts := expected[note.Owner+"/"+note.Title]; note.Timestamp != ts {
+			t.Errorf("expected %s/%s to have timestamp %d but got %d", note.Owner, note.Title, ts, note.Timestamp)
+		}
+		if expiresAt := expected[note.Owner+"/"+note.Title] / 1000; note.ExpiresAt != expiresAt {
+			t.Errorf("expected %s/%s to expire at %d but got %d", note.Owner, note.Title, expiresAt, note.ExpiresAt)
+		}
+	}
+
+	if migrated, err = MigrateTimestamps(ctx, api, "notes"); err != nil || migrated != 0 {
+		t.Errorf("expected a second run to migrate nothing but got %d, %v", migrated, err)
+	}
+}
+
+func TestBackfillRecentNotesIndex(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable("notes")
+	for _, item := range []map[string]interface{}{
+		{"owner": "a", "title": "old", "timestamp": 1638999997},
+		{"owner": "a", "title": "indexed", "timestamp": 1639000000000, "updated_at": 1639000000000, "feed": "notes"},
+	} {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err = api.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("notes"), Item: av}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	backfilled, err := BackfillRecentNotesIndex(ctx, api, "notes")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if backfilled != 1 {
+		t.Errorf("expected 1 note to be backfilled but got %d", backfilled)
+	}
+	page, err := FindRecentNotesPage(ctx, api, "notes", 0, PageRequest{SigningKey: []byte("secret")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(page.Notes) != 2 || page.Notes[1].Title != "old" || page.Notes[1].UpdatedAt != 1638999997000 {
+		t.Errorf("expected the old note to be indexed by its timestamp but got %+v", page.Notes)
+	}
+}
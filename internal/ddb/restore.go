@@ -0,0 +1,62 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"log"
+	"time"
+)
+
+// DynamoPutItemAPI is a stand-in for the PutItem function that exists on the AWS DynamoDB Client
+type DynamoPutItemAPI interface {
+	PutItem(ctx context.Context, input *dynamodb.PutItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// RestoreNote writes a Note read from a backup as a new Note at version 1.  Unlike CreateNote it keeps the created_at and
+// updated_at of the Note, so restored Notes are listed in the same order as the originals; a zero UpdatedAt is set to
+// the current time.
+//
+// The restored schema.Note is returned.  A NoteExistsError is returned when a Note with the same owner and title already
+// exists.
+func RestoreNote(ctx context.Context, api DynamoPutItemAPI, tableName string, note *schema.Note) (*schema.Note, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	restored := *note
+	restored.Version = 1
+	if restored.UpdatedAt == 0 {
+		restored.UpdatedAt = time.Now().UnixMilli()
+	}
+	restored.Timestamp = restored.UpdatedAt
+	restored.ExpiresAt = schema.ExpiresAtFromTimestamp(restored.Timestamp)
+	item, err := attributevalue.MarshalMap(restored)
+	if err != nil {
+		return nil, err
+	}
+	item[schema.RecentNotesPartitionAttribute] = &types.AttributeValueMemberS{Value: schema.RecentNotesPartition}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("owner"))).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("restoring note %q for owner %q to %s\n", note.Title, note.Owner, tableName)
+	_, err = api.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(tableName),
+		Item:                      item,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if isConditionalCheckFailed(err) {
+		return nil, &NoteExistsError{Owner: note.Owner, Title: note.Title}
+	} else if err != nil {
+		return nil, wrapClientError(err)
+	}
+	return &restored, nil
+}
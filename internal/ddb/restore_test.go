@@ -0,0 +1,77 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"testing"
+	"time"
+)
+
+func TestRestoreNote(t *testing.T) {
+	cases := map[string]struct {
+		note          schema.Note
+		existing      bool
+		expectedError func(err error) bool
+		checkNote     func(t *testing.T, note *schema.Note)
+	}{
+		"keeps the archived times": {
+			note: schema.Note{Owner: "a", Title: "1", Message: "m", Version: 7, CreatedAt: 1638999997000, UpdatedAt: 1639999997000},
+			checkNote: func(t *testing.T, note *schema.Note) {
+				if note.Version != 1 || note.CreatedAt != 1638999997000 || note.UpdatedAt != 1639999997000 || note.Timestamp != note.UpdatedAt || note.ExpiresAt != 1639999997 {
+					t.Errorf("unexpected restored note: %+v", note)
+				}
+			},
+		},
+		"sets a missing updated_at": {
+			note: schema.Note{Owner: "a", Title: "1", Message: "m"},
+			checkNote: func(t *testing.T, note *schema.Note) {
+				if note.CreatedAt != 0 || time.Since(time.UnixMilli(note.UpdatedAt)) > time.Minute {
+					t.Errorf("unexpected restored note: %+v", note)
+				}
+			},
+		},
+		"existing note": {
+			note:          schema.Note{Owner: "a", Title: "1", Message: "m"},
+			existing:      true,
+			expectedError: func(err error) bool { var e *NoteExistsError; return errors.As(err, &e) },
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable("notes")
+			if tt.existing {
+				if _, err := CreateNote(ctx, api, "notes", &schema.Note{Owner: "a", Title: "1", Message: "existing"}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			_, err := RestoreNote(ctx, api, "notes", &tt.note)
+
+			if tt.expectedError != nil {
+				if !tt.expectedError(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			stored, err := GetNote(ctx, api, "notes", tt.note.Owner, tt.note.Title)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			tt.checkNote(t, stored)
+			recent, err := FindRecentNotesPage(ctx, api, "notes", 0, PageRequest{SigningKey: []byte("secret")})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(recent.Notes) != 1 {
+				t.Errorf("expected the restored note in the recent notes index but got %+v", recent.Notes)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"log"
+	"sync"
+)
+
+const (
+	// DefaultScanSegments is the number of segments ScanAll reads at the same time when none are requested
+	DefaultScanSegments = int32(4)
+	// MaxScanSegments is the largest number of segments ScanAll reads at the same time.  Every segment has its own
+	// goroutine and connection, and a table rarely has enough partitions for more segments to read any faster.
+	MaxScanSegments = int32(64)
+)
+
+// ScanAllRequest describes a parallel scan of every Note in a table.
+//
+// A zero TotalSegments uses DefaultScanSegments and a zero PageLimit lets DynamoDB fill each 1MB page.
+type ScanAllRequest struct {
+	TotalSegments int32
+	PageLimit     int32
+}
+
+// ScanSummary reports what a ScanAll read.
+//
+// ConsumedCapacity is the total read capacity units consumed by every segment.
+type ScanSummary struct {
+	Count            int64
+	ScannedCount     int64
+	ConsumedCapacity float64
+}
+
+// ScanAll reads every Note in the table with a parallel scan of TotalSegments segments, sending each Note on notes.
+//
+// Every segment waits for its Notes to be received before reading its next page, so a slow receiver slows the scan
+// rather than buffering the table in memory.  notes is closed when ScanAll returns, which is once every segment is read,
+// one of them fails, or ctx is done.  The ScanSummary covers the pages that were read either way.
+func ScanAll(ctx context.Context, api DynamoScanAPI, tableName string, request ScanAllRequest, notes chan<- schema.Note) (*ScanSummary, error) {
+	defer close(notes)
+	if tableName == "" {
+		return &ScanSummary{}, errors.New("tableName must be provided")
+	}
+	segments := request.TotalSegments
+	if segments == 0 {
+		segments = DefaultScanSegments
+	}
+	if segments < 1 || segments > MaxScanSegments {
+		return &ScanSummary{}, fmt.Errorf("TotalSegments must be between 1 and %d", MaxScanSegments)
+	}
+	if request.PageLimit < 0 {
+		return &ScanSummary{}, errors.New("PageLimit must not be negative")
+	}
+	log.Printf("scanning table %s in %d segments\n", tableName, segments)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		summary  ScanSummary
+		firstErr error
+	)
+	for segment := int32(0); segment < segments; segment++ {
+		wg.Add(1)
+		go func(segment int32) {
+			defer wg.Done()
+			s := &segmentScan{api: api, tableName: tableName, segment: segment, totalSegments: segments, pageLimit: request.PageLimit}
+			err := s.run(ctx, notes)
+			mu.Lock()
+			defer mu.Unlock()
+			summary.Count += s.summary.Count
+			summary.ScannedCount += s.summary.ScannedCount
+			summary.ConsumedCapacity += s.summary.ConsumedCapacity
+			if err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}(segment)
+	}
+	wg.Wait()
+	log.Printf("scanned %d items in %s, consuming %.1f read capacity units\n", summary.ScannedCount, tableName, summary.ConsumedCapacity)
+	return &summary, firstErr
+}
+
+// segmentScan reads a single segment of a ScanAll
+type segmentScan struct {
+	api           DynamoScanAPI
+	tableName     string
+	segment       int32
+	totalSegments int32
+	pageLimit     int32
+	summary       ScanSummary
+}
+
+func (s *segmentScan) run(ctx context.Context, notes chan<- schema.Note) error {
+	input := &dynamodb.ScanInput{
+		TableName:              aws.String(s.tableName),
+		Segment:                aws.Int32(s.segment),
+		TotalSegments:          aws.Int32(s.totalSegments),
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	}
+	if s.pageLimit > 0 {
+		input.Limit = aws.Int32(s.pageLimit)
+	}
+	for {
+		output, err := s.api.Scan(ctx, input)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return wrapClientError(err)
+		}
+		s.summary.ScannedCount += int64(output.ScannedCount)
+		if output.ConsumedCapacity != nil {
+			s.summary.ConsumedCapacity += aws.ToFloat64(output.ConsumedCapacity.CapacityUnits)
+		}
+		var page []schema.Note
+		if err = attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return err
+		}
+		for _, note := range page {
+			select {
+			case notes <- note:
+				s.summary.Count++
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
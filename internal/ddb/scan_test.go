@@ -0,0 +1,121 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"testing"
+)
+
+func TestScanAll(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.NewNotesTable("notes")
+	for i := 0; i < 30; i++ {
+		note := &schema.Note{Owner: fmt.Sprintf("owner-%d", i%7), Title: fmt.Sprintf("title-%d", i)}
+		if _, err := CreateNote(ctx, api, "notes", note); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	cases := map[string]struct {
+		request ScanAllRequest
+	}{
+		"default segments":              {},
+		"one segment":                   {request: ScanAllRequest{TotalSegments: 1}},
+		"small pages":                   {request: ScanAllRequest{TotalSegments: 3, PageLimit: 2}},
+		"more segments than partitions": {request: ScanAllRequest{TotalSegments: 16}},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			notes := make(chan schema.Note)
+			seen := make(map[string]bool)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for note := range notes {
+					seen[note.Owner+"/"+note.Title] = true
+				}
+			}()
+
+			summary, err := ScanAll(ctx, api, "notes", tt.request, notes)
+			<-done
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(seen) != 30 || summary.Count != 30 || summary.ScannedCount != 30 {
+				t.Errorf("expected 30 notes but received %d with summary %+v", len(seen), summary)
+			}
+			if summary.ConsumedCapacity != 15 {
+				t.Errorf("expected 15 consumed capacity units but got %v", summary.ConsumedCapacity)
+			}
+		})
+	}
+}
+
+func TestScanAll_Cancel(t *testing.T) {
+	api := ddbfake.NewNotesTable("notes")
+	for i := 0; i < 10; i++ {
+		if _, err := CreateNote(context.Background(), api, "notes", &schema.Note{Owner: "a", Title: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	notes := make(chan schema.Note)
+	result := make(chan error)
+	go func() {
+		_, err := ScanAll(ctx, api, "notes", ScanAllRequest{TotalSegments: 2}, notes)
+		result <- err
+	}()
+
+	<-notes
+	cancel()
+
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the scan to be canceled but got %v", err)
+	}
+	if _, open := <-notes; open {
+		t.Errorf("expected notes to be closed")
+	}
+}
+
+func TestScanAll_Errors(t *testing.T) {
+	failing := mockDynamoScanAPI(func(ctx context.Context, input *dynamodb.ScanInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+		return nil, errors.New("boom")
+	})
+
+	cases := map[string]struct {
+		api       DynamoScanAPI
+		tableName string
+		request   ScanAllRequest
+		isDynamo  bool
+	}{
+		"missing table name":  {api: failing},
+		"too many segments":   {api: failing, tableName: "notes", request: ScanAllRequest{TotalSegments: MaxScanSegments + 1}},
+		"negative page limit": {api: failing, tableName: "notes", request: ScanAllRequest{PageLimit: -1}},
+		"client error":        {api: failing, tableName: "notes", isDynamo: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			notes := make(chan schema.Note)
+
+			_, err := ScanAll(context.Background(), tt.api, tt.tableName, tt.request, notes)
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			var derr *DynamoDBError
+			if errors.As(err, &derr) != tt.isDynamo {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if _, open := <-notes; open {
+				t.Errorf("expected notes to be closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"log"
+	"time"
+)
+
+// tableWaitDelay is the shortest wait between the DescribeTable calls of WaitForTable and WaitForTableDeleted
+var tableWaitDelay = time.Second
+
+// DynamoCreateTableAPI is a stand-in for the CreateTable function that exists on the AWS DynamoDB Client
+type DynamoCreateTableAPI interface {
+	CreateTable(ctx context.Context, input *dynamodb.CreateTableInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+}
+
+// DynamoDescribeTableAPI is a stand-in for the DescribeTable function that exists on the AWS DynamoDB Client
+type DynamoDescribeTableAPI interface {
+	DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+}
+
+// DynamoDeleteTableAPI is a stand-in for the DeleteTable function that exists on the AWS DynamoDB Client
+type DynamoDeleteTableAPI interface {
+	DeleteTable(ctx context.Context, input *dynamodb.DeleteTableInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.DeleteTableOutput, error)
+}
+
+// DynamoTableAPI is the set of DynamoDB Client functions needed to manage the Notes table
+type DynamoTableAPI interface {
+	DynamoCreateTableAPI
+	DynamoDescribeTableAPI
+	DynamoDeleteTableAPI
+}
+
+// CreateNotesTable creates a table described by schema.NotesKeySchema and schema.NotesGlobalSecondaryIndexes, with
+// on-demand billing.  The table is usually CREATING when this returns, see WaitForTable.
+func CreateNotesTable(ctx context.Context, api DynamoCreateTableAPI, tableName string) (*types.TableDescription, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	log.Printf("creating table %s\n", tableName)
+	output, err := api.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:              aws.String(tableName),
+		KeySchema:              schema.NotesKeySchema,
+		AttributeDefinitions:   schema.NotesAttributeDefinitions,
+		GlobalSecondaryIndexes: schema.NotesGlobalSecondaryIndexes,
+		BillingMode:            types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	return output.TableDescription, nil
+}
+
+// DescribeTable returns the current description of the table
+func DescribeTable(ctx context.Context, api DynamoDescribeTableAPI, tableName string) (*types.TableDescription, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	output, err := api.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	return output.Table, nil
+}
+
+// DeleteTable deletes the table and every Note in it.  The table is usually DELETING when this returns, see
+// WaitForTableDeleted.
+func DeleteTable(ctx context.Context, api DynamoDeleteTableAPI, tableName string) (*types.TableDescription, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	log.Printf("deleting table %s\n", tableName)
+	output, err := api.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return nil, wrapClientError(err)
+	}
+	return output.TableDescription, nil
+}
+
+// WaitForTable waits up to maxWait for the table to exist and be ACTIVE
+func WaitForTable(ctx context.Context, api DynamoDescribeTableAPI, tableName string, maxWait time.Duration) error {
+	log.Printf("waiting for %s to become ACTIVE\n", tableName)
+	waiter := dynamodb.NewTableExistsWaiter(api, func(options *dynamodb.TableExistsWaiterOptions) {
+		options.MinDelay = tableWaitDelay
+	})
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, maxWait)
+}
+
+// WaitForTableDeleted waits up to maxWait for the table to no longer exist
+func WaitForTableDeleted(ctx context.Context, api DynamoDescribeTableAPI, tableName string, maxWait time.Duration) error {
+	log.Printf("waiting for %s to be deleted\n", tableName)
+	waiter := dynamodb.NewTableNotExistsWaiter(api, func(options *dynamodb.TableNotExistsWaiterOptions) {
+		options.MinDelay = tableWaitDelay
+	})
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, maxWait)
+}
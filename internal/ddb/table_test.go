@@ -0,0 +1,84 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotesTableLifecycle(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.New()
+
+	if _, err := DescribeTable(ctx, api, "notes"); !isResourceNotFound(err) {
+		t.Fatalf("expected a ResourceNotFoundException before the table is created but got %v", err)
+	}
+	if err := WaitForTable(ctx, api, "notes", 10*time.Millisecond); err == nil {
+		t.Fatal("expected waiting for a missing table to time out")
+	}
+
+	created, err := CreateNotesTable(ctx, api, "notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(created.KeySchema, schema.NotesKeySchema) {
+		t.Errorf("expected key schema %v but got %v", schema.NotesKeySchema, created.KeySchema)
+	}
+	var inUse *types.ResourceInUseException
+	if _, err = CreateNotesTable(ctx, api, "notes"); !errors.As(err, &inUse) {
+		t.Errorf("expected creating the table again to fail with a ResourceInUseException but got %v", err)
+	}
+	if err = WaitForTable(ctx, api, "notes", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	described, err := DescribeTable(ctx, api, "notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if described.TableStatus != types.TableStatusActive {
+		t.Errorf("expected the table to be ACTIVE but got %s", described.TableStatus)
+	}
+	if len(described.GlobalSecondaryIndexes) != 1 || aws.ToString(described.GlobalSecondaryIndexes[0].IndexName) != schema.RecentNotesIndexName {
+		t.Errorf("expected the %s index but got %+v", schema.RecentNotesIndexName, described.GlobalSecondaryIndexes)
+	}
+
+	deleted, err := DeleteTable(ctx, api, "notes")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if deleted.TableStatus != types.TableStatusDeleting {
+		t.Errorf("expected the table to be DELETING but got %s", deleted.TableStatus)
+	}
+	if err = WaitForTableDeleted(ctx, api, "notes", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err = DeleteTable(ctx, api, "notes"); !isResourceNotFound(err) {
+		t.Errorf("expected deleting a deleted table to fail with a ResourceNotFoundException but got %v", err)
+	}
+}
+
+func TestNotesTable_TableNameRequired(t *testing.T) {
+	ctx := context.Background()
+	api := ddbfake.New()
+	if _, err := CreateNotesTable(ctx, api, ""); err == nil {
+		t.Error("expected an error creating a table without a name")
+	}
+	if _, err := DescribeTable(ctx, api, ""); err == nil {
+		t.Error("expected an error describing a table without a name")
+	}
+	if _, err := DeleteTable(ctx, api, ""); err == nil {
+		t.Error("expected an error deleting a table without a name")
+	}
+}
+
+func isResourceNotFound(err error) bool {
+	var rnf *types.ResourceNotFoundException
+	return errors.As(err, &rnf)
+}
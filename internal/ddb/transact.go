@@ -0,0 +1,181 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// SourceAction names the action of a move that deletes the Note from its current key
+	SourceAction = "source"
+	// TargetAction names the action of a move that writes the Note to its new key
+	TargetAction = "target"
+)
+
+// DynamoTransactWriteItemsAPI is a stand-in for the TransactWriteItems function that exists on the AWS DynamoDB Client
+type DynamoTransactWriteItemsAPI interface {
+	TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// DynamoMoveNoteAPI is the set of DynamoDB Client functions needed to move a Note to a new key
+type DynamoMoveNoteAPI interface {
+	DynamoGetItemAPI
+	DynamoTransactWriteItemsAPI
+}
+
+// CancellationReason is why DynamoDB canceled a single action of a transaction.  Code is None for the actions that did
+// not cause the cancellation.
+type CancellationReason struct {
+	Action  string
+	Code    string
+	Message string
+}
+
+// TransactionCanceledError is returned when DynamoDB cancels a transaction, with a CancellationReason for every action.
+//
+// It wraps the Note error the reasons describe, e.g. a NoteExistsError when the target of a move already exists, so
+// errors.As finds it.  Otherwise, e.g. when the transaction conflicted with another write, it wraps a DynamoDBError.
+type TransactionCanceledError struct {
+	Reasons []CancellationReason
+	err     error
+}
+
+func (e *TransactionCanceledError) Error() string {
+	var reasons []string
+	for _, r := range e.Reasons {
+		reasons = append(reasons, fmt.Sprintf("%s %s", r.Action, r.Code))
+	}
+	return fmt.Sprintf("transaction canceled (%s): %s", strings.Join(reasons, ", "), e.err)
+}
+
+func (e *TransactionCanceledError) Unwrap() error { return e.err }
+
+// RenameNote gives the Note a new title, see MoveNote
+func RenameNote(ctx context.Context, api DynamoMoveNoteAPI, tableName, owner, title, newTitle string, expectedVersion int64) (*schema.Note, error) {
+	return MoveNote(ctx, api, tableName, owner, title, owner, newTitle, expectedVersion)
+}
+
+// MoveNote moves the Note to a new owner and title, returning the moved Note.  Both are part of the primary key, so the
+// Note is deleted and written again with TransactWriteItems: either both happen or neither does.
+//
+// The moved Note keeps its message and created_at, and is written as a new version.  A NoteNotFoundError is returned
+// when the Note does not exist, a PreconditionFailedError when it does not match expectedVersion (AnyVersion skips the
+// check) or changed while it was being moved, and a NoteExistsError when a Note already exists at the new key.  When
+// DynamoDB cancels the transaction these are wrapped in a TransactionCanceledError.
+func MoveNote(ctx context.Context, api DynamoMoveNoteAPI, tableName, owner, title, newOwner, newTitle string, expectedVersion int64) (*schema.Note, error) {
+	if tableName == "" {
+		return nil, errors.New("tableName must be provided")
+	}
+	if newOwner == "" || newTitle == "" {
+		return nil, errors.New("the new owner and title must be provided")
+	}
+	if owner == newOwner && title == newTitle {
+		return nil, &NoteExistsError{Owner: newOwner, Title: newTitle}
+	}
+	note, err := GetNote(ctx, api, tableName, owner, title)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != AnyVersion && note.Version != expectedVersion {
+		return nil, &PreconditionFailedError{Owner: owner, Title: title}
+	}
+
+	moved := *note
+	moved.Owner, moved.Title = newOwner, newTitle
+	moved.Version++
+	moved.Timestamp = time.Now().UnixMilli()
+	moved.UpdatedAt = moved.Timestamp
+	moved.ExpiresAt = schema.ExpiresAtFromTimestamp(moved.Timestamp)
+	item, err := attributevalue.MarshalMap(moved)
+	if err != nil {
+		return nil, err
+	}
+	item[schema.RecentNotesPartitionAttribute] = &types.AttributeValueMemberS{Value: schema.RecentNotesPartition}
+	sourceKey, err := noteKey(owner, title)
+	if err != nil {
+		return nil, err
+	}
+	source, err := expression.NewBuilder().WithCondition(versionCondition(note.Version)).Build()
+	if err != nil {
+		return nil, err
+	}
+	target, err := expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("owner"))).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("moving note %q for owner %q to %q for owner %q in %s", title, owner, newTitle, newOwner, tableName)
+	_, err = api.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName:                           aws.String(tableName),
+				Key:                                 sourceKey,
+				ConditionExpression:                 source.Condition(),
+				ExpressionAttributeNames:            source.Names(),
+				ExpressionAttributeValues:           source.Values(),
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			}},
+			{Put: &types.Put{
+				TableName:                 aws.String(tableName),
+				Item:                      item,
+				ConditionExpression:       target.Condition(),
+				ExpressionAttributeNames:  target.Names(),
+				ExpressionAttributeValues: target.Values(),
+			}},
+		},
+	})
+	var tce *types.TransactionCanceledException
+	if errors.As(err, &tce) {
+		return nil, moveCanceled(tce, owner, title, newOwner, newTitle)
+	} else if err != nil {
+		return nil, wrapClientError(err)
+	}
+	return &moved, nil
+}
+
+// moveCanceled converts the cancellation reasons of a move into a TransactionCanceledError wrapping the Note error they
+// describe
+func moveCanceled(tce *types.TransactionCanceledException, owner, title, newOwner, newTitle string) error {
+	canceled := &TransactionCanceledError{}
+	for i, reason := range tce.CancellationReasons {
+		r := CancellationReason{Action: TargetAction, Code: aws.ToString(reason.Code), Message: aws.ToString(reason.Message)}
+		if i == 0 {
+			r.Action = SourceAction
+		}
+		canceled.Reasons = append(canceled.Reasons, r)
+		if r.Code != "ConditionalCheckFailed" || canceled.err != nil {
+			continue
+		}
+		switch {
+		case r.Action == SourceAction && len(reason.Item) == 0:
+			canceled.err = &NoteNotFoundError{Owner: owner, Title: title}
+		case r.Action == SourceAction:
+			canceled.err = &PreconditionFailedError{Owner: owner, Title: title}
+		default:
+			canceled.err = &NoteExistsError{Owner: newOwner, Title: newTitle}
+		}
+	}
+	if canceled.err == nil {
+		canceled.err = wrapClientError(tce)
+	}
+	return canceled
+}
+
+// versionCondition matches a Note whose version is the given version, where version 0 is a Note written before versions
+// were recorded
+func versionCondition(version int64) expression.ConditionBuilder {
+	if version == 0 {
+		return expression.AttributeNotExists(expression.Name("version"))
+	}
+	return expression.Name("version").Equal(expression.Value(version))
+}
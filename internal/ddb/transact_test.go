@@ -0,0 +1,145 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"reflect"
+	"testing"
+)
+
+// moveAPI is the fake table with a TransactWriteItems that runs before first, e.g. to change the Note being moved
+type moveAPI struct {
+	*ddbfake.Client
+	before func(ctx context.Context, api *ddbfake.Client) error
+}
+
+func (m moveAPI) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if m.before != nil {
+		if err := m.before(ctx, m.Client); err != nil {
+			return nil, err
+		}
+	}
+	return m.Client.TransactWriteItems(ctx, input, optFns...)
+}
+
+func TestMoveNote(t *testing.T) {
+	cases := map[string]struct {
+		newOwner, newTitle string
+		expectedVersion    int64
+		before             func(ctx context.Context, api *ddbfake.Client) error
+		expectedError      func(err error) bool
+		expectedReasons    []string
+		expectedKeys       []string
+	}{
+		"rename": {
+			newOwner: "a", newTitle: "renamed", expectedVersion: 1,
+			expectedKeys: []string{"a/renamed", "b/1"},
+		},
+		"move to another owner": {
+			newOwner: "c", newTitle: "1", expectedVersion: AnyVersion,
+			expectedKeys: []string{"b/1", "c/1"},
+		},
+		"target exists": {
+			newOwner: "b", newTitle: "1", expectedVersion: AnyVersion,
+			expectedError:   func(err error) bool { var e *NoteExistsError; return errors.As(err, &e) && e.Owner == "b" },
+			expectedReasons: []string{"source None", "target ConditionalCheckFailed"},
+			expectedKeys:    []string{"a/1", "b/1"},
+		},
+		"same key": {
+			newOwner: "a", newTitle: "1", expectedVersion: AnyVersion,
+			expectedError: func(err error) bool { var e *NoteExistsError; return errors.As(err, &e) },
+			expectedKeys:  []string{"a/1", "b/1"},
+		},
+		"missing note": {
+			newOwner: "a", newTitle: "renamed", expectedVersion: AnyVersion,
+			before:          func(ctx context.Context, api *ddbfake.Client) error { return DeleteNote(ctx, api, "notes", "a", "1") },
+			expectedError:   func(err error) bool { var e *NoteNotFoundError; return errors.As(err, &e) },
+			expectedReasons: []string{"source ConditionalCheckFailed", "target None"},
+			expectedKeys:    []string{"b/1"},
+		},
+		"stale version": {
+			newOwner: "a", newTitle: "renamed", expectedVersion: 5,
+			expectedError: func(err error) bool { var e *PreconditionFailedError; return errors.As(err, &e) },
+			expectedKeys:  []string{"a/1", "b/1"},
+		},
+		"changed while moving": {
+			newOwner: "a", newTitle: "renamed", expectedVersion: 1,
+			before: func(ctx context.Context, api *ddbfake.Client) error {
+				_, err := AddNote(ctx, api, "notes", &schema.Note{Owner: "a", Title: "1", Message: "changed"})
+				return err
+			},
+			expectedError:   func(err error) bool { var e *PreconditionFailedError; return errors.As(err, &e) },
+			expectedReasons: []string{"source ConditionalCheckFailed", "target None"},
+			expectedKeys:    []string{"a/1", "b/1"},
+		},
+		"conflicting transaction": {
+			newOwner: "a", newTitle: "renamed", expectedVersion: AnyVersion,
+			before: func(ctx context.Context, api *ddbfake.Client) error {
+				return &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("TransactionConflict")}, {Code: aws.String("None")},
+				}}
+			},
+			expectedError:   func(err error) bool { var e *DynamoDBError; return errors.As(err, &e) },
+			expectedReasons: []string{"source TransactionConflict", "target None"},
+			expectedKeys:    []string{"a/1", "b/1"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := ddbfake.NewNotesTable("notes")
+			for _, n := range []schema.Note{{Owner: "a", Title: "1", Message: "m"}, {Owner: "b", Title: "1", Message: "m"}} {
+				if _, err := CreateNote(ctx, fake, "notes", &n); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			original, err := GetNote(ctx, fake, "notes", "a", "1")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			moved, err := MoveNote(ctx, moveAPI{Client: fake, before: tt.before}, "notes", "a", "1", tt.newOwner, tt.newTitle, tt.expectedVersion)
+
+			if tt.expectedError == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				stored, err := GetNote(ctx, fake, "notes", tt.newOwner, tt.newTitle)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !reflect.DeepEqual(moved, stored) {
+					t.Errorf("expected the moved note %+v to be stored but got %+v", moved, stored)
+				}
+				if stored.Message != original.Message || stored.CreatedAt != original.CreatedAt || stored.Version != original.Version+1 {
+					t.Errorf("expected %+v to keep the message and created_at of %+v", stored, original)
+				}
+			} else if err == nil || !tt.expectedError(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			var reasons []string
+			var tce *TransactionCanceledError
+			if errors.As(err, &tce) {
+				for _, r := range tce.Reasons {
+					reasons = append(reasons, r.Action+" "+r.Code)
+				}
+			}
+			if !reflect.DeepEqual(tt.expectedReasons, reasons) {
+				t.Errorf("expected cancellation reasons %v but got %v", tt.expectedReasons, reasons)
+			}
+			var keys []string
+			for _, item := range fake.Items("notes") {
+				keys = append(keys, item["owner"].(*types.AttributeValueMemberS).Value+"/"+item["title"].(*types.AttributeValueMemberS).Value)
+			}
+			if !reflect.DeepEqual(tt.expectedKeys, keys) {
+				t.Errorf("expected keys %v but got %v", tt.expectedKeys, keys)
+			}
+		})
+	}
+}
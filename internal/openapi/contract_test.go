@@ -0,0 +1,285 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/admin"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/reader"
+	"github.com/akijowski/tweek-2021-sam/internal/writer"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const specPath = "../../reference/openapi.yml"
+
+// knownDrift lists the responses that are known not to match the OpenAPI document, keyed by method, path and status.
+// The contract test fails when one of them starts matching, so fixing the drift means deleting its entry here.
+var knownDrift = map[string]string{}
+
+type contractHandler func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// contractStep is a request sent to the handler of an operation.  Steps run in order against the same table, so later
+// steps can depend on the Notes written by earlier ones.
+type contractStep struct {
+	name    string
+	method  string
+	path    string
+	query   map[string]string
+	headers map[string]string
+	// body is sent as is, when nil and the operation takes a body an example generated from its schema is sent instead
+	body           *string
+	expectedStatus int
+}
+
+// contractAuthenticator lets requests without an Authorization header do anything, as when authentication is disabled,
+// authenticates "Bearer other" as the owner "other" and rejects any other token
+var contractAuthenticator = auth.AuthenticatorFunc(func(_ context.Context, request events.APIGatewayProxyRequest) (*auth.Principal, error) {
+	switch apigw.Header(request, "Authorization") {
+	case "":
+		return nil, nil
+	case "Bearer other":
+		return &auth.Principal{Owner: "other"}, nil
+	default:
+		return nil, &apigw.RequestError{StatusCode: http.StatusUnauthorized, Detail: "the bearer token is not valid"}
+	}
+})
+
+// TestContract drives the reader, writer and admin handlers through every operation in the OpenAPI document and validates
+// each response against the documented status codes and schemas.
+func TestContract(t *testing.T) {
+	doc, err := Load(specPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	api := ddbfake.NewNotesTable("notes")
+	functions := map[string]contractHandler{
+		"NotesWriterFunction": (&writer.Handler{API: api, TableName: "notes", Authenticator: contractAuthenticator}).Handle,
+		"NotesReaderFunction": (&reader.Handler{API: api, TableName: "notes", CursorSigningKey: []byte("contract"), Authenticator: contractAuthenticator}).Handle,
+		"NotesAdminFunction":  (&admin.Handler{API: api, TableName: "notes", Authenticator: contractAuthenticator}).Handle,
+	}
+
+	create, _ := doc.Operation(http.MethodPost, "/notes")
+	example, err := exampleBody(doc, create)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var note struct{ Owner, Title string }
+	if err = json.Unmarshal([]byte(example), &note); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ownerPath := "/notes/" + url.PathEscape(note.Owner)
+	notePath := ownerPath + "/" + url.PathEscape(note.Title)
+	invalid := "{}"
+	emptyBatch := `{"notes": []}`
+	move := `{"title": "moved"}`
+	moveAgain := `{"title": "moved again"}`
+	movedPath := ownerPath + "/moved"
+	rename := `{"title": "renamed"}`
+	renameBack := fmt.Sprintf(`{"title": %q}`, note.Title)
+	renamedPath := ownerPath + "/renamed"
+	archived := fmt.Sprintf("{\"owner\": %q, \"title\": \"renamed\", \"message\": \"imported\"}\n", note.Owner)
+	unreadable := "not json\n"
+
+	steps := []contractStep{
+		{name: "create a note", method: http.MethodPost, path: "/notes", expectedStatus: http.StatusCreated},
+		{name: "create a duplicate note", method: http.MethodPost, path: "/notes", expectedStatus: http.StatusConflict},
+		{name: "create an invalid note", method: http.MethodPost, path: "/notes", body: &invalid, expectedStatus: http.StatusBadRequest},
+		{name: "create a batch of notes", method: http.MethodPost, path: "/notes:batch", expectedStatus: http.StatusOK},
+		{name: "create an empty batch of notes", method: http.MethodPost, path: "/notes:batch", body: &emptyBatch, expectedStatus: http.StatusBadRequest},
+		{name: "list notes", method: http.MethodGet, path: "/notes", expectedStatus: http.StatusOK},
+		{name: "list one page of notes", method: http.MethodGet, path: "/notes", query: map[string]string{"limit": "1"}, expectedStatus: http.StatusOK},
+		{name: "list notes updated since a time", method: http.MethodGet, path: "/notes", query: map[string]string{"since": "2021-12-08T21:46:37Z"}, expectedStatus: http.StatusOK},
+		{name: "list notes with an invalid since", method: http.MethodGet, path: "/notes", query: map[string]string{"since": "yesterday"}, expectedStatus: http.StatusBadRequest},
+		{name: "list notes with an invalid limit", method: http.MethodGet, path: "/notes", query: map[string]string{"limit": "0"}, expectedStatus: http.StatusBadRequest},
+		{name: "list notes for an owner", method: http.MethodGet, path: ownerPath, expectedStatus: http.StatusOK},
+		{name: "list notes for an owner by recency", method: http.MethodGet, path: ownerPath, query: map[string]string{"sort": "updated_at", "order": "desc"}, expectedStatus: http.StatusOK},
+		{name: "list notes with an invalid sort", method: http.MethodGet, path: "/notes", query: map[string]string{"sort": "message"}, expectedStatus: http.StatusBadRequest},
+		{name: "list notes for an owner as another owner", method: http.MethodGet, path: ownerPath, headers: map[string]string{"Authorization": "Bearer other"}, expectedStatus: http.StatusForbidden},
+		{name: "list notes with an invalid token", method: http.MethodGet, path: "/notes", headers: map[string]string{"Authorization": "Bearer invalid"}, expectedStatus: http.StatusUnauthorized},
+		{name: "list notes as csv", method: http.MethodGet, path: "/notes", headers: map[string]string{"Accept": "text/csv"}, expectedStatus: http.StatusOK},
+		{name: "list one page of notes as json lines", method: http.MethodGet, path: "/notes", query: map[string]string{"limit": "1"}, headers: map[string]string{"Accept": "application/x-ndjson"}, expectedStatus: http.StatusOK},
+		{name: "list notes for an owner as markdown", method: http.MethodGet, path: ownerPath, headers: map[string]string{"Accept": "text/markdown"}, expectedStatus: http.StatusOK},
+		{name: "list notes for an owner as xml", method: http.MethodGet, path: ownerPath, headers: map[string]string{"Accept": "application/xml"}, expectedStatus: http.StatusNotAcceptable},
+		{name: "list notes for an owner with a forged cursor", method: http.MethodGet, path: ownerPath, query: map[string]string{"cursor": "e30.c2ln"}, expectedStatus: http.StatusBadRequest},
+		{name: "get a note", method: http.MethodGet, path: notePath, expectedStatus: http.StatusOK},
+		{name: "create a note for another owner", method: http.MethodPost, path: "/notes", headers: map[string]string{"Authorization": "Bearer other"}, expectedStatus: http.StatusForbidden},
+		{name: "replace a note without If-Match", method: http.MethodPut, path: notePath, expectedStatus: http.StatusPreconditionRequired},
+		{name: "replace a note", method: http.MethodPut, path: notePath, headers: map[string]string{"If-Match": `"1"`}, expectedStatus: http.StatusOK},
+		{name: "replace a note with an invalid body", method: http.MethodPut, path: notePath, headers: map[string]string{"If-Match": `"2"`}, body: &invalid, expectedStatus: http.StatusBadRequest},
+		{name: "update a stale note", method: http.MethodPatch, path: notePath, headers: map[string]string{"If-Match": `"1"`}, expectedStatus: http.StatusPreconditionFailed},
+		{name: "update a note", method: http.MethodPatch, path: notePath, headers: map[string]string{"If-Match": `"2"`}, expectedStatus: http.StatusOK},
+		{name: "move a note", method: http.MethodPost, path: notePath + ":move", headers: map[string]string{"If-Match": `"3"`}, body: &move, expectedStatus: http.StatusCreated},
+		{name: "move a moved note", method: http.MethodPost, path: notePath + ":move", body: &move, expectedStatus: http.StatusNotFound},
+		{name: "create the moved note again", method: http.MethodPost, path: "/notes", expectedStatus: http.StatusCreated},
+		{name: "move a note onto an existing note", method: http.MethodPost, path: notePath + ":move", body: &move, expectedStatus: http.StatusConflict},
+		{name: "move a stale note", method: http.MethodPost, path: movedPath + ":move", headers: map[string]string{"If-Match": `"1"`}, body: &moveAgain, expectedStatus: http.StatusPreconditionFailed},
+		{name: "rename a moved note", method: http.MethodPost, path: movedPath + ":rename", headers: map[string]string{"If-Match": `"4"`}, body: &rename, expectedStatus: http.StatusCreated},
+		{name: "rename a note to an existing title", method: http.MethodPost, path: renamedPath + ":rename", body: &renameBack, expectedStatus: http.StatusConflict},
+		{name: "rename a missing note", method: http.MethodPost, path: movedPath + ":rename", body: &rename, expectedStatus: http.StatusNotFound},
+		{name: "rename a note without a title", method: http.MethodPost, path: renamedPath + ":rename", body: &invalid, expectedStatus: http.StatusBadRequest},
+		{name: "move a note without a new owner or title", method: http.MethodPost, path: notePath + ":move", body: &invalid, expectedStatus: http.StatusBadRequest},
+		{name: "export notes", method: http.MethodGet, path: "/admin/notes:export", expectedStatus: http.StatusOK},
+		{name: "export notes as markdown", method: http.MethodGet, path: "/admin/notes:export", query: map[string]string{"format": "markdown"}, expectedStatus: http.StatusOK},
+		{name: "export notes in an unknown format", method: http.MethodGet, path: "/admin/notes:export", query: map[string]string{"format": "xml"}, expectedStatus: http.StatusBadRequest},
+		{name: "import notes", method: http.MethodPost, path: "/admin/notes:import", query: map[string]string{"conflict": "rename"}, body: &archived, expectedStatus: http.StatusOK},
+		{name: "import an unreadable archive", method: http.MethodPost, path: "/admin/notes:import", body: &unreadable, expectedStatus: http.StatusBadRequest},
+		{name: "delete a note", method: http.MethodDelete, path: notePath, expectedStatus: http.StatusNoContent},
+		{name: "get a deleted note", method: http.MethodGet, path: notePath, expectedStatus: http.StatusNotFound},
+		{name: "delete a deleted note", method: http.MethodDelete, path: notePath, expectedStatus: http.StatusNotFound},
+	}
+
+	exercised := make(map[*Operation]bool)
+	drifted := make(map[string]bool)
+	for _, step := range steps {
+		op, request := buildRequest(t, doc, step)
+		exercised[op] = true
+		handle, ok := functions[op.Function()]
+		if !ok {
+			t.Fatalf("%s: no handler for function %q", step.name, op.Function())
+		}
+
+		response, err := handle(context.Background(), request)
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", step.name, err)
+		}
+		if response.StatusCode != step.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d: %s", step.name, step.expectedStatus, response.StatusCode, response.Body)
+		}
+		violations, err := doc.ValidateResponse(op, response.StatusCode, response.Headers, response.Body)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", step.name, err)
+		}
+		key := fmt.Sprintf("%s %s %d", op.Method, op.Path, response.StatusCode)
+		if len(violations) == 0 {
+			continue
+		}
+		if reason, ok := knownDrift[key]; ok {
+			drifted[key] = true
+			t.Logf("%s: known drift (%s): %s", step.name, reason, violations)
+			continue
+		}
+		for _, v := range violations {
+			t.Errorf("%s: %s response does not match the OpenAPI document: %s", step.name, key, v)
+		}
+	}
+
+	for key := range knownDrift {
+		if !drifted[key] {
+			t.Errorf("%s now matches the OpenAPI document, remove it from knownDrift", key)
+		}
+	}
+	for _, op := range doc.Operations() {
+		if !exercised[op] {
+			t.Errorf("%s %s is not exercised by the contract test", op.Method, op.Path)
+		}
+	}
+}
+
+// TestExamples checks that the examples in the OpenAPI document match the schemas they illustrate
+func TestExamples(t *testing.T) {
+	doc, err := Load(specPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, s := range doc.Components.Schemas {
+		for example, value := range s.Examples {
+			b, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			violations, err := doc.ValidateJSON(s, b)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, v := range violations {
+				t.Errorf("%s example %q does not match its schema: %s", name, example, v)
+			}
+		}
+	}
+}
+
+// buildRequest finds the operation for the step and builds the API Gateway proxy request the handler would receive
+func buildRequest(t *testing.T, doc *Document, step contractStep) (*Operation, events.APIGatewayProxyRequest) {
+	t.Helper()
+	segments := strings.Split(strings.TrimPrefix(step.path, "/"), "/")
+	for _, op := range doc.Operations() {
+		if op.Method != step.method {
+			continue
+		}
+		params, ok := matchPath(op.Path, segments)
+		if !ok {
+			continue
+		}
+		request := events.APIGatewayProxyRequest{
+			Resource:              op.Path,
+			Path:                  step.path,
+			HTTPMethod:            step.method,
+			Headers:               step.headers,
+			PathParameters:        params,
+			QueryStringParameters: step.query,
+		}
+		if step.body != nil {
+			request.Body = *step.body
+		} else {
+			body, err := exampleBody(doc, op)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", step.name, err)
+			}
+			request.Body = body
+		}
+		return op, request
+	}
+	t.Fatalf("%s: %s %s is not in the OpenAPI document", step.name, step.method, step.path)
+	return nil, events.APIGatewayProxyRequest{}
+}
+
+// matchPath matches the escaped path segments against a path template, returning the unescaped path parameters.  A
+// template segment such as {title}:move matches a parameter followed by the literal suffix.
+func matchPath(template string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.TrimPrefix(template, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range parts {
+		end := strings.Index(part, "}")
+		if !strings.HasPrefix(part, "{") || end < 0 {
+			if part != segments[i] {
+				return nil, false
+			}
+			continue
+		}
+		suffix := part[end+1:]
+		if len(segments[i]) <= len(suffix) || !strings.HasSuffix(segments[i], suffix) {
+			return nil, false
+		}
+		value, err := url.PathUnescape(strings.TrimSuffix(segments[i], suffix))
+		if err != nil {
+			return nil, false
+		}
+		params[part[1:end]] = value
+	}
+	return params, true
+}
+
+// exampleBody generates a JSON request body for the operation from its schema, or an empty body when it takes none
+func exampleBody(doc *Document, op *Operation) (string, error) {
+	s, err := doc.RequestSchema(op)
+	if err != nil || s == nil {
+		return "", err
+	}
+	example, err := doc.Example(s)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(example)
+	return string(b), err
+}
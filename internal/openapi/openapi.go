@@ -0,0 +1,268 @@
+// Package openapi loads the parts of reference/openapi.yml needed to check the handlers against the documented API.
+//
+// It understands just enough of OpenAPI 3.0 for this project: operations, responses, and the JSON schema keywords used in
+// the document.  Only local references (#/components/...) are resolved.
+package openapi
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// functionPattern finds the SAM function behind an integration uri
+var functionPattern = regexp.MustCompile(`\$\{(\w+)\.Arn\}`)
+
+var methods = map[string]string{
+	"get":     http.MethodGet,
+	"put":     http.MethodPut,
+	"post":    http.MethodPost,
+	"delete":  http.MethodDelete,
+	"options": http.MethodOptions,
+	"head":    http.MethodHead,
+	"patch":   http.MethodPatch,
+}
+
+// Document is a parsed OpenAPI document
+type Document struct {
+	Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+	Components Components                      `yaml:"components"`
+
+	operations map[string]*Operation
+}
+
+// Components holds the reusable objects that can be referenced with $ref
+type Components struct {
+	Responses     map[string]*Response    `yaml:"responses"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+}
+
+// Operation is a single method on a path
+type Operation struct {
+	Method      string
+	Path        string
+	OperationID string                 `yaml:"operationId"`
+	RequestBody *RequestBody           `yaml:"requestBody"`
+	Responses   map[string]*Response   `yaml:"responses"`
+	Integration map[string]interface{} `yaml:"x-amazon-apigateway-integration"`
+}
+
+// Function returns the logical ID of the SAM function that handles the operation, or an empty string when it has no
+// Lambda integration
+func (o *Operation) Function() string {
+	uri := o.Integration["uri"]
+	if sub, ok := uri.(map[string]interface{}); ok {
+		uri = sub["Fn::Sub"]
+	}
+	s, _ := uri.(string)
+	if m := functionPattern.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// RequestBody describes the body an operation accepts
+type RequestBody struct {
+	Ref      string               `yaml:"$ref"`
+	Required bool                 `yaml:"required"`
+	Content  map[string]MediaType `yaml:"content"`
+}
+
+// Response describes a response an operation may return
+type Response struct {
+	Ref     string               `yaml:"$ref"`
+	Headers map[string]Header    `yaml:"headers"`
+	Content map[string]MediaType `yaml:"content"`
+}
+
+// Header describes a response header
+type Header struct {
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+// MediaType is the schema of a body in a given content type
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// Load reads and parses the OpenAPI document at path
+func Load(path string) (*Document, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses an OpenAPI document
+func Parse(b []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse OpenAPI document: %w", err)
+	}
+	doc.operations = make(map[string]*Operation)
+	for path, item := range doc.Paths {
+		for key, node := range item {
+			method, ok := methods[key]
+			if !ok {
+				continue
+			}
+			op := &Operation{Method: method, Path: path}
+			if err := node.Decode(op); err != nil {
+				return nil, fmt.Errorf("unable to parse %s %s: %w", method, path, err)
+			}
+			doc.operations[method+" "+path] = op
+		}
+	}
+	return &doc, nil
+}
+
+// Operation returns the operation for the method and path template, e.g. GET /notes/{owner}
+func (d *Document) Operation(method, path string) (*Operation, bool) {
+	op, ok := d.operations[method+" "+path]
+	return op, ok
+}
+
+// Operations returns every operation in the document, ordered by path and method
+func (d *Document) Operations() []*Operation {
+	ops := make([]*Operation, 0, len(d.operations))
+	for _, op := range d.operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// Response returns the response documented for the status code, falling back to the default response
+func (d *Document) Response(op *Operation, status int) (*Response, error) {
+	r, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if r, ok = op.Responses["default"]; !ok {
+			return nil, fmt.Errorf("%s %s does not document status %d", op.Method, op.Path, status)
+		}
+	}
+	if r.Ref != "" {
+		name, err := refName(r.Ref, "#/components/responses/")
+		if err != nil {
+			return nil, err
+		}
+		if r, ok = d.Components.Responses[name]; !ok {
+			return nil, fmt.Errorf("unknown response %q", r.Ref)
+		}
+	}
+	return r, nil
+}
+
+// ValidateResponse checks that the status code is documented for the operation, that any required headers are set, and
+// that the body matches the schema for its content type.  A response without a Content-Type is treated as
+// application/json, which is what API Gateway sends for proxy integrations that do not set one.  Only JSON bodies are
+// checked against their schema, a body of any other documented content type is accepted as is.
+func (d *Document) ValidateResponse(op *Operation, status int, headers map[string]string, body string) ([]Violation, error) {
+	r, err := d.Response(op, status)
+	if err != nil {
+		return []Violation{{Message: err.Error()}}, nil
+	}
+	var violations []Violation
+	for name, h := range r.Headers {
+		if _, ok := header(headers, name); h.Required && !ok {
+			violations = append(violations, Violation{Message: fmt.Sprintf("missing required header %s", name)})
+		}
+	}
+
+	if len(r.Content) == 0 {
+		if body != "" {
+			violations = append(violations, Violation{Message: fmt.Sprintf("expected no content but got %q", body)})
+		}
+		return violations, nil
+	}
+	contentType, ok := header(headers, "Content-Type")
+	if !ok {
+		contentType = "application/json"
+	}
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+	media, ok := r.Content[contentType]
+	if !ok {
+		return append(violations, Violation{Message: fmt.Sprintf("undocumented content type %s", contentType)}), nil
+	}
+	if !isJSON(contentType) {
+		return violations, nil
+	}
+	bodyViolations, err := d.ValidateJSON(media.Schema, []byte(body))
+	if err != nil {
+		return append(violations, Violation{Message: err.Error()}), nil
+	}
+	return append(violations, bodyViolations...), nil
+}
+
+// RequestSchema returns the schema of the JSON request body of the operation, or nil when it takes no body
+func (d *Document) RequestSchema(op *Operation) (*Schema, error) {
+	body := op.RequestBody
+	if body == nil {
+		return nil, nil
+	}
+	if body.Ref != "" {
+		name, err := refName(body.Ref, "#/components/requestBodies/")
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if body, ok = d.Components.RequestBodies[name]; !ok {
+			return nil, fmt.Errorf("unknown request body %q", op.RequestBody.Ref)
+		}
+	}
+	return d.resolve(body.Content["application/json"].Schema)
+}
+
+// resolve follows the $ref of a schema
+func (d *Document) resolve(s *Schema) (*Schema, error) {
+	for s != nil && s.Ref != "" {
+		name, err := refName(s.Ref, "#/components/schemas/")
+		if err != nil {
+			return nil, err
+		}
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %q", s.Ref)
+		}
+		s = resolved
+	}
+	return s, nil
+}
+
+// isJSON reports whether the media type is application/json or a structured syntax suffix of it, e.g.
+// application/problem+json
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// header looks up a response header case-insensitively
+func header(headers map[string]string, name string) (string, bool) {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func refName(ref, prefix string) (string, error) {
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported reference %q", ref)
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
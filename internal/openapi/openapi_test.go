@@ -0,0 +1,177 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const testSpec = `
+paths:
+  /things/{id}:
+    get:
+      x-amazon-apigateway-integration:
+        uri:
+          Fn::Sub: arn:aws:apigateway:${AWS::Region}:lambda:path/2015-03-31/functions/${ThingsFunction.Arn}:live/invocations
+      responses:
+        '200':
+          $ref: '#/components/responses/Thing'
+        '204':
+          description: No content
+        default:
+          description: A problem
+          content:
+            application/problem+json:
+              schema:
+                type: object
+components:
+  responses:
+    Thing:
+      description: A thing
+      headers:
+        ETag:
+          required: true
+          schema:
+            type: string
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/Thing'
+        text/csv:
+          schema:
+            type: string
+  schemas:
+    Thing:
+      type: object
+      properties:
+        name:
+          type: string
+          minLength: 1
+          maxLength: 3
+        count:
+          type: integer
+          minimum: 0
+        seen:
+          type: string
+          format: date-time
+        tags:
+          type: array
+          maxItems: 2
+          items:
+            type: string
+        kind:
+          type: string
+          enum:
+            - big
+            - small
+      required:
+        - name
+        - count
+`
+
+func TestDocument_ValidateResponse(t *testing.T) {
+	doc, err := Parse([]byte(testSpec))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	op, ok := doc.Operation(http.MethodGet, "/things/{id}")
+	if !ok {
+		t.Fatal("expected the operation to be found")
+	}
+	if f := op.Function(); f != "ThingsFunction" {
+		t.Errorf("expected function ThingsFunction but got %q", f)
+	}
+	etag := map[string]string{"etag": `"1"`}
+
+	cases := map[string]struct {
+		status             int
+		headers            map[string]string
+		body               string
+		expectedViolations []Violation
+	}{
+		"valid": {
+			status:  http.StatusOK,
+			headers: etag,
+			body:    `{"name":"abc","count":2,"seen":"2021-12-08T21:46:37.123Z","tags":["a"]}`,
+		},
+		"csv is not validated as json": {
+			status:  http.StatusOK,
+			headers: map[string]string{"ETag": `"1"`, "Content-Type": "text/csv; charset=utf-8"},
+			body:    "name,count\nabc,2\n",
+		},
+		"missing required properties and header": {
+			status: http.StatusOK,
+			body:   `{"Name":"abc"}`,
+			expectedViolations: []Violation{
+				{Message: "missing required header ETag"},
+				{Message: `missing required property "name"`},
+				{Message: `missing required property "count"`},
+			},
+		},
+		"invalid properties": {
+			status:  http.StatusOK,
+			headers: etag,
+			body:    `{"name":"abcd","count":-1.5,"seen":"yesterday","tags":[1,"b","c"],"kind":"medium"}`,
+			expectedViolations: []Violation{
+				{Pointer: "/count", Message: "expected an integer but got -1.5"},
+				{Pointer: "/count", Message: "expected at least 0 but got -1.5"},
+				{Pointer: "/kind", Message: `expected one of [big small] but got "medium"`},
+				{Pointer: "/name", Message: "expected at most 3 characters but got 4"},
+				{Pointer: "/seen", Message: `expected an RFC 3339 date-time but got "yesterday"`},
+				{Pointer: "/tags", Message: "expected at most 2 items but got 3"},
+				{Pointer: "/tags/0", Message: "expected a string but got a number"},
+			},
+		},
+		"no content": {
+			status: http.StatusNoContent,
+		},
+		"unexpected content": {
+			status:             http.StatusNoContent,
+			body:               "{}",
+			expectedViolations: []Violation{{Message: `expected no content but got "{}"`}},
+		},
+		"default response": {
+			status:  http.StatusInternalServerError,
+			headers: map[string]string{"Content-Type": "application/problem+json"},
+			body:    "{}",
+		},
+		"undocumented content type": {
+			status:             http.StatusInternalServerError,
+			body:               "{}",
+			expectedViolations: []Violation{{Message: "undocumented content type application/json"}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			violations, err := doc.ValidateResponse(op, tt.status, tt.headers, tt.body)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(violations) == 0 && len(tt.expectedViolations) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(violations, tt.expectedViolations) {
+				t.Errorf("expected violations %v but got %v", tt.expectedViolations, violations)
+			}
+		})
+	}
+}
+
+func TestDocument_Example(t *testing.T) {
+	doc, err := Parse([]byte(testSpec))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	thing := &Schema{Ref: "#/components/schemas/Thing"}
+
+	example, err := doc.Example(thing)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if violations, _ := doc.Validate(thing, example); len(violations) > 0 {
+		t.Errorf("expected the example %v to be valid but got %v", example, violations)
+	}
+}
@@ -0,0 +1,243 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is the subset of the OpenAPI schema object used by the Notes API
+type Schema struct {
+	Ref        string                 `yaml:"$ref"`
+	Type       string                 `yaml:"type"`
+	Format     string                 `yaml:"format"`
+	Properties map[string]*Schema     `yaml:"properties"`
+	Required   []string               `yaml:"required"`
+	Items      *Schema                `yaml:"items"`
+	MinItems   *int                   `yaml:"minItems"`
+	MaxItems   *int                   `yaml:"maxItems"`
+	Enum       []string               `yaml:"enum"`
+	MinLength  *int                   `yaml:"minLength"`
+	MaxLength  *int                   `yaml:"maxLength"`
+	Minimum    *float64               `yaml:"minimum"`
+	Maximum    *float64               `yaml:"maximum"`
+	Examples   map[string]interface{} `yaml:"x-examples"`
+}
+
+// Violation is a single place where a value does not match its schema
+type Violation struct {
+	// Pointer is the JSON pointer to the offending value, empty for the document itself
+	Pointer string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Pointer == "" {
+		return v.Message
+	}
+	return fmt.Sprintf("%s: %s", v.Pointer, v.Message)
+}
+
+// ValidateJSON decodes body and validates it against the schema
+func (d *Document) ValidateJSON(s *Schema, body []byte) ([]Violation, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("body is not JSON: %w", err)
+	}
+	return d.Validate(s, value)
+}
+
+// Validate checks a decoded JSON value against the schema, returning every Violation ordered by pointer
+func (d *Document) Validate(s *Schema, value interface{}) ([]Violation, error) {
+	var violations []Violation
+	if err := d.validate(s, value, "", &violations); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Pointer < violations[j].Pointer })
+	return violations, nil
+}
+
+func (d *Document) validate(s *Schema, value interface{}, pointer string, violations *[]Violation) error {
+	s, err := d.resolve(s)
+	if err != nil || s == nil {
+		return err
+	}
+	report := func(format string, a ...interface{}) {
+		*violations = append(*violations, Violation{Pointer: pointer, Message: fmt.Sprintf(format, a...)})
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			report("expected an object but got %s", jsonType(value))
+			return nil
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+		for name, property := range s.Properties {
+			if v, ok := object[name]; ok {
+				if err = d.validate(property, v, pointer+"/"+name, violations); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			report("expected an array but got %s", jsonType(value))
+			return nil
+		}
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			report("expected at least %d items but got %d", *s.MinItems, len(array))
+		}
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			report("expected at most %d items but got %d", *s.MaxItems, len(array))
+		}
+		for i, v := range array {
+			if err = d.validate(s.Items, v, fmt.Sprintf("%s/%d", pointer, i), violations); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			report("expected a string but got %s", jsonType(value))
+			return nil
+		}
+		length := utf8.RuneCountInString(str)
+		if s.MinLength != nil && length < *s.MinLength {
+			report("expected at least %d characters but got %d", *s.MinLength, length)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			report("expected at most %d characters but got %d", *s.MaxLength, length)
+		}
+		if _, err := time.Parse(time.RFC3339, str); s.Format == "date-time" && err != nil {
+			report("expected an RFC 3339 date-time but got %q", str)
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			report("expected one of %v but got %q", s.Enum, str)
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			report("expected %s but got %s", article(s.Type), jsonType(value))
+			return nil
+		}
+		if s.Type == "integer" && number != math.Trunc(number) {
+			report("expected an integer but got %v", number)
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			report("expected at least %v but got %v", *s.Minimum, number)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			report("expected at most %v but got %v", *s.Maximum, number)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("expected a boolean but got %s", jsonType(value))
+		}
+	}
+	return nil
+}
+
+// Example returns a value that satisfies the schema.  The first of its x-examples is used when it has any, otherwise the
+// value is built from the required properties.
+func (d *Document) Example(s *Schema) (interface{}, error) {
+	s, err := d.resolve(s)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	if len(s.Examples) > 0 {
+		names := make([]string, 0, len(s.Examples))
+		for name := range s.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return s.Examples[names[0]], nil
+	}
+
+	switch s.Type {
+	case "object":
+		object := make(map[string]interface{})
+		for _, name := range s.Required {
+			if object[name], err = d.Example(s.Properties[name]); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	case "array":
+		array := []interface{}{}
+		for s.MinItems != nil && len(array) < *s.MinItems {
+			item, err := d.Example(s.Items)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+	case "string":
+		if len(s.Enum) > 0 {
+			return s.Enum[0], nil
+		}
+		example := "example"
+		for s.MinLength != nil && len(example) < *s.MinLength {
+			example += " example"
+		}
+		if s.Format == "date-time" {
+			return time.Unix(0, 0).UTC().Format(time.RFC3339), nil
+		}
+		if s.MaxLength != nil && len(example) > *s.MaxLength {
+			example = example[:*s.MaxLength]
+		}
+		return example, nil
+	case "integer", "number":
+		if s.Minimum != nil {
+			return math.Ceil(*s.Minimum), nil
+		}
+		return float64(1), nil
+	case "boolean":
+		return true, nil
+	}
+	return nil, nil
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func article(schemaType string) string {
+	if schemaType == "integer" {
+		return "an integer"
+	}
+	return "a " + schemaType
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+// Package reader handles the API Gateway requests that read Notes.
+package reader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API is the set of DynamoDB Client functions needed by the reader
+type API interface {
+	ddb.DynamoGetItemAPI
+	ddb.DynamoQueryAPI
+	ddb.DynamoScanAPI
+}
+
+// Handler reads Notes from a DynamoDB table
+type Handler struct {
+	API       API
+	TableName string
+	// CursorSigningKey signs the continuation tokens handed out for paginated responses, listings fail without one
+	CursorSigningKey []byte
+	// Authenticator identifies the caller, who can only read their own Notes unless they hold auth.AdminScope.  When nil
+	// every request is allowed.
+	Authenticator auth.Authenticator
+	// ScanAllNotes lists all Notes with a Scan instead of the schema.RecentNotesIndexName index, which is missing the
+	// Notes that migrate-notes has not backfilled yet.  Scanned listings are in no particular order.
+	ScanAllNotes bool
+}
+
+// Handle is the API Gateway proxy handler for the reader
+func (h *Handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	requestID := apigw.RequestID(ctx, request)
+	if err := h.authorize(ctx, request); err != nil {
+		return apigw.ErrorResponse(err, requestID, request.Path), nil
+	}
+	mediaType := jsonMediaType
+	if !isSingleNote(request) {
+		var ok bool
+		if mediaType, ok = apigw.Negotiate(request, listMediaTypes...); !ok {
+			err := &apigw.RequestError{
+				StatusCode: http.StatusNotAcceptable,
+				Detail:     fmt.Sprintf("Accept must allow one of %s", strings.Join(listMediaTypes, ", ")),
+			}
+			return apigw.ErrorResponse(err, requestID, request.Path), nil
+		}
+	}
+	response, err := h.handleRequest(ctx, request)
+	if err != nil {
+		return apigw.ErrorResponse(err, requestID, request.Path), nil
+	}
+
+	var headers map[string]string
+	switch r := response.(type) {
+	case *schema.Note:
+		headers = map[string]string{"ETag": r.ETag()}
+		response = schema.NewNoteResponse(r)
+	case *schema.GetAllNotesResponse:
+		headers = map[string]string{"Vary": "Accept"}
+		if mediaType != jsonMediaType {
+			return renderResponse(request, requestID, mediaType, r, headers), nil
+		}
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("error marshalling response: %s\n", err)
+		return apigw.ErrorResponse(err, requestID, request.Path), nil
+	}
+	return events.APIGatewayProxyResponse{
+		Headers:    headers,
+		StatusCode: http.StatusOK,
+		Body:       string(body),
+	}, nil
+}
+
+// renderResponse returns the page of Notes in a representation other than JSON, with the next page in a Link header
+func renderResponse(request events.APIGatewayProxyRequest, requestID, mediaType string, page *schema.GetAllNotesResponse,
+	headers map[string]string) events.APIGatewayProxyResponse {
+	body, err := renderNotes(mediaType, page.Notes)
+	if err != nil {
+		log.Printf("error rendering response: %s\n", err)
+		return apigw.ErrorResponse(err, requestID, request.Path)
+	}
+	headers["Content-Type"] = contentTypes[mediaType]
+	if page.NextCursor != "" {
+		headers["Link"] = nextLink(request.Path, request.QueryStringParameters, page.NextCursor)
+	}
+	return events.APIGatewayProxyResponse{
+		Headers:    headers,
+		StatusCode: http.StatusOK,
+		Body:       body,
+	}
+}
+
+// authorize allows the caller to read the Notes of an owner when they are that owner, and every Note only when they hold
+// auth.AdminScope
+func (h *Handler) authorize(ctx context.Context, request events.APIGatewayProxyRequest) error {
+	principal, err := auth.Authenticate(ctx, h.Authenticator, request)
+	if err != nil {
+		return err
+	}
+	if owner, ok := request.PathParameters["owner"]; ok {
+		return principal.RequireReader(owner)
+	}
+	return principal.RequireAdmin()
+}
+
+// isSingleNote reports whether the request is for a single Note rather than a page of them
+func isSingleNote(request events.APIGatewayProxyRequest) bool {
+	_, hasOwner := request.PathParameters["owner"]
+	_, hasTitle := request.PathParameters["title"]
+	return hasOwner && hasTitle
+}
+
+// handleRequest returns the value to be marshalled as the response body: a *schema.Note, converted to its wire model by
+// Handle, when both owner and title are given, otherwise a *schema.GetAllNotesResponse.
+func (h *Handler) handleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (interface{}, error) {
+	owner, hasOwner := request.PathParameters["owner"]
+	if title, ok := request.PathParameters["title"]; ok && hasOwner {
+		log.Printf("getting note %q for owner: %q\n", title, owner)
+		return ddb.GetNote(ctx, h.API, h.TableName, owner, title)
+	}
+	page, err := h.parsePageRequest(request.QueryStringParameters)
+	if err != nil {
+		return nil, err
+	}
+	less, err := parseSort(request.QueryStringParameters)
+	if err != nil {
+		return nil, err
+	}
+	since, err := parseSince(request.QueryStringParameters)
+	if err != nil {
+		return nil, err
+	}
+	if hasOwner && since != 0 {
+		return nil, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "since is only supported when listing all notes"}
+	}
+	list := func(page ddb.PageRequest) (*ddb.NotesPage, error) {
+		if hasOwner {
+			log.Printf("querying for owner: %q\n", owner)
+			return ddb.FindNotesByOwnerPage(ctx, h.API, h.TableName, owner, page)
+		}
+		if h.ScanAllNotes {
+			log.Println("scanning for notes")
+			return ddb.ScanNotesSincePage(ctx, h.API, h.TableName, since, page)
+		}
+		log.Println("querying for recent notes")
+		return ddb.FindRecentNotesPage(ctx, h.API, h.TableName, since, page)
+	}
+	if less == nil {
+		notes, err := list(page)
+		if err != nil {
+			return nil, err
+		}
+		return &schema.GetAllNotesResponse{Notes: schema.NewNoteResponses(notes.Notes), NextCursor: notes.NextCursor}, nil
+	}
+
+	// no index orders the Notes by every field, so sorted listings are read whole and sorted in memory
+	if page.Cursor != "" || page.Limit != 0 {
+		return nil, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "sort cannot be combined with limit or cursor"}
+	}
+	page.Limit = ddb.MaxPageLimit
+	var all []schema.Note
+	for {
+		notes, err := list(page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, notes.Notes...)
+		if len(all) > maxSortedNotes {
+			detail := fmt.Sprintf("sort is only supported for listings of at most %d notes", maxSortedNotes)
+			return nil, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: detail}
+		}
+		if notes.NextCursor == "" {
+			break
+		}
+		page.Cursor = notes.NextCursor
+	}
+	responses := schema.NewNoteResponses(all)
+	sort.SliceStable(responses, func(i, j int) bool { return less(&responses[i], &responses[j]) })
+	return &schema.GetAllNotesResponse{Notes: responses}, nil
+}
+
+// maxSortedNotes is the longest listing that is read whole to be sorted
+const maxSortedNotes = 500
+
+// noteOrderings are the values accepted by the sort query parameter, each ordering Notes ascending
+var noteOrderings = map[string]func(a, b *schema.NoteResponse) bool{
+	"title": func(a, b *schema.NoteResponse) bool { return a.Title < b.Title },
+	"created_at": func(a, b *schema.NoteResponse) bool {
+		// Notes that did not record when they were created sort first
+		return b.CreatedAt != nil && (a.CreatedAt == nil || a.CreatedAt.Before(*b.CreatedAt))
+	},
+	"updated_at": func(a, b *schema.NoteResponse) bool { return a.UpdatedAt.Before(b.UpdatedAt) },
+}
+
+// parseSort returns the ordering requested by the sort and order query parameters, or nil to keep the order of the table.
+// The ordering applies to the whole listing, which is returned as a single page.
+func parseSort(query map[string]string) (func(a, b *schema.NoteResponse) bool, error) {
+	field, order := query["sort"], query["order"]
+	if field == "" {
+		if order != "" {
+			return nil, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "order requires sort"}
+		}
+		return nil, nil
+	}
+	less, ok := noteOrderings[field]
+	if !ok {
+		return nil, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "sort must be one of title, created_at or updated_at"}
+	}
+	switch order {
+	case "", "asc":
+		return less, nil
+	case "desc":
+		return func(a, b *schema.NoteResponse) bool { return less(b, a) }, nil
+	default:
+		return nil, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "order must be asc or desc"}
+	}
+}
+
+// parseSince returns the since query parameter in epoch millis, or zero when it is not given
+func parseSince(query map[string]string) (int64, error) {
+	rawSince, ok := query["since"]
+	if !ok {
+		return 0, nil
+	}
+	since, err := time.Parse(time.RFC3339, rawSince)
+	if err != nil {
+		return 0, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "since must be an RFC 3339 date-time"}
+	}
+	return since.UnixMilli(), nil
+}
+
+func (h *Handler) parsePageRequest(query map[string]string) (ddb.PageRequest, error) {
+	page := ddb.PageRequest{
+		Cursor:     query["cursor"],
+		SigningKey: h.CursorSigningKey,
+	}
+	if rawLimit, ok := query["limit"]; ok {
+		limit, err := strconv.ParseInt(rawLimit, 10, 32)
+		if err != nil || limit < 1 || int32(limit) > ddb.MaxPageLimit {
+			return page, &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: fmt.Sprintf("limit must be a number between 1 and %d", ddb.MaxPageLimit)}
+		}
+		page.Limit = int32(limit)
+	}
+	return page, nil
+}
@@ -0,0 +1,429 @@
+package reader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testTableName = "notes"
+
+func TestHandler_Handle(t *testing.T) {
+	cases := map[string]struct {
+		request            events.APIGatewayProxyRequest
+		expectedStatusCode int
+		expectedHeaders    map[string]string
+		expectedNotes      int
+		expectedTitles     []string
+	}{
+		"get a single note": {
+			request: events.APIGatewayProxyRequest{
+				PathParameters: map[string]string{"owner": "a", "title": "1"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"ETag": `"1"`},
+		},
+		"get a missing note": {
+			request: events.APIGatewayProxyRequest{
+				PathParameters: map[string]string{"owner": "a", "title": "missing"},
+			},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		"list notes for an owner": {
+			request: events.APIGatewayProxyRequest{
+				PathParameters: map[string]string{"owner": "a"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedNotes:      2,
+		},
+		"list all notes one page at a time": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"limit": "1"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedNotes:      1,
+		},
+		"list the most recent notes": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"limit": "2"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedNotes:      2,
+			expectedTitles:     []string{"1", "2"},
+		},
+		"list notes updated since a time": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"since": "2021-12-08T21:46:37Z"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedNotes:      3,
+		},
+		"invalid since": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"since": "1638999997"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"since for an owner": {
+			request: events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"owner": "a"},
+				QueryStringParameters: map[string]string{"since": "2021-12-08T21:46:37Z"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"invalid limit": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"limit": "0"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"list notes for an owner sorted by title descending": {
+			request: events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"owner": "a"},
+				QueryStringParameters: map[string]string{"sort": "title", "order": "desc"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedNotes:      2,
+			expectedTitles:     []string{"2", "1"},
+		},
+		"sort with a limit": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"sort": "title", "limit": "1"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"sort with a cursor": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"sort": "title", "cursor": "e30.c2ln"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"invalid sort": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"sort": "message"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"invalid order": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"sort": "updated_at", "order": "up"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"list notes as csv": {
+			request: events.APIGatewayProxyRequest{
+				Headers: map[string]string{"accept": "text/csv"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"Content-Type": "text/csv; charset=utf-8", "Vary": "Accept"},
+		},
+		"list notes as the preferred of several types": {
+			request: events.APIGatewayProxyRequest{
+				Headers: map[string]string{"Accept": "application/json;q=0.5, text/*;q=0.8, text/markdown"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"Content-Type": "text/markdown; charset=utf-8"},
+		},
+		"list notes with a link to the next page": {
+			request: events.APIGatewayProxyRequest{
+				Path:                  "/notes",
+				Headers:               map[string]string{"Accept": "application/x-ndjson"},
+				QueryStringParameters: map[string]string{"limit": "1"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"Content-Type": "application/x-ndjson"},
+		},
+		"list notes as an unsupported type": {
+			request: events.APIGatewayProxyRequest{
+				Headers: map[string]string{"Accept": "application/xml"},
+			},
+			expectedStatusCode: http.StatusNotAcceptable,
+		},
+		"get a single note ignores accept": {
+			request: events.APIGatewayProxyRequest{
+				Headers:        map[string]string{"Accept": "text/csv"},
+				PathParameters: map[string]string{"owner": "a", "title": "1"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"ETag": `"1"`},
+		},
+		"forged cursor": {
+			request: events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"cursor": "e30.c2ln"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable(testTableName)
+			for _, n := range []schema.Note{{Owner: "a", Title: "1"}, {Owner: "a", Title: "2"}, {Owner: "b", Title: "1"}} {
+				if _, err := ddb.CreateNote(ctx, api, testTableName, &n); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			h := &Handler{API: api, TableName: testTableName, CursorSigningKey: []byte("test-signing-key")}
+
+			response, err := h.Handle(ctx, tt.request)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("expected status %d but got %d: %s", tt.expectedStatusCode, response.StatusCode, response.Body)
+			}
+			for name, value := range tt.expectedHeaders {
+				if got := response.Headers[name]; got != value {
+					t.Errorf("expected header %s to be %q but got %q", name, value, got)
+				}
+			}
+			if tt.expectedNotes > 0 {
+				var body schema.GetAllNotesResponse
+				if err = json.Unmarshal([]byte(response.Body), &body); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if len(body.Notes) != tt.expectedNotes {
+					t.Errorf("expected %d notes but got %d", tt.expectedNotes, len(body.Notes))
+				}
+				for i, title := range tt.expectedTitles {
+					if i < len(body.Notes) && body.Notes[i].Title != title {
+						t.Errorf("expected note %d to be %q but got %q", i, title, body.Notes[i].Title)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_HandleAuthenticated(t *testing.T) {
+	owner := &auth.Principal{Owner: "a"}
+	admin := &auth.Principal{Owner: "b", Scopes: []string{auth.AdminScope}}
+	cases := map[string]struct {
+		principal          *auth.Principal
+		request            events.APIGatewayProxyRequest
+		expectedStatusCode int
+	}{
+		"owner reads their note": {
+			principal:          owner,
+			request:            events.APIGatewayProxyRequest{PathParameters: map[string]string{"owner": "a", "title": "1"}},
+			expectedStatusCode: http.StatusOK,
+		},
+		"owner lists their notes": {
+			principal:          owner,
+			request:            events.APIGatewayProxyRequest{PathParameters: map[string]string{"owner": "a"}},
+			expectedStatusCode: http.StatusOK,
+		},
+		"owner lists the notes of another owner": {
+			principal:          owner,
+			request:            events.APIGatewayProxyRequest{PathParameters: map[string]string{"owner": "b"}},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		"owner lists all notes": {
+			principal:          owner,
+			expectedStatusCode: http.StatusForbidden,
+		},
+		"admin lists the notes of another owner": {
+			principal:          admin,
+			request:            events.APIGatewayProxyRequest{PathParameters: map[string]string{"owner": "a"}},
+			expectedStatusCode: http.StatusOK,
+		},
+		"admin lists all notes": {
+			principal:          admin,
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable(testTableName)
+			if _, err := ddb.CreateNote(ctx, api, testTableName, &schema.Note{Owner: "a", Title: "1"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			authenticator := auth.AuthenticatorFunc(func(context.Context, events.APIGatewayProxyRequest) (*auth.Principal, error) {
+				return tt.principal, nil
+			})
+			h := &Handler{API: api, TableName: testTableName, CursorSigningKey: []byte("test-signing-key"), Authenticator: authenticator}
+
+			response, err := h.Handle(ctx, tt.request)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Errorf("expected status %d but got %d: %s", tt.expectedStatusCode, response.StatusCode, response.Body)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleSortedListing(t *testing.T) {
+	cases := map[string]struct {
+		notes              int
+		expectedStatusCode int
+	}{
+		"sorts across pages":     {notes: int(ddb.MaxPageLimit) + 20, expectedStatusCode: http.StatusOK},
+		"too many notes to sort": {notes: maxSortedNotes + 1, expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable(testTableName)
+			var notes []schema.Note
+			for i := 0; i < tt.notes; i++ {
+				notes = append(notes, schema.Note{Owner: "a", Title: fmt.Sprintf("%04d", i), Message: "m"})
+			}
+			if _, err := ddb.BatchAddNotes(ctx, api, testTableName, notes); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			h := &Handler{API: api, TableName: testTableName, CursorSigningKey: []byte("test-signing-key")}
+
+			response, err := h.Handle(ctx, events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"owner": "a"},
+				QueryStringParameters: map[string]string{"sort": "title", "order": "desc"},
+			})
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("expected status %d but got %d: %s", tt.expectedStatusCode, response.StatusCode, response.Body)
+			}
+			if tt.expectedStatusCode != http.StatusOK {
+				return
+			}
+			var page schema.GetAllNotesResponse
+			if err = json.Unmarshal([]byte(response.Body), &page); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(page.Notes) != tt.notes || page.NextCursor != "" {
+				t.Fatalf("expected all %d notes on a single page but got %d and cursor %q", tt.notes, len(page.Notes), page.NextCursor)
+			}
+			if first, last := page.Notes[0].Title, page.Notes[tt.notes-1].Title; first != notes[tt.notes-1].Title || last != "0000" {
+				t.Errorf("expected the notes in descending title order but got %s first and %s last", first, last)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleUnmigratedNotes(t *testing.T) {
+	cases := map[string]struct {
+		scanAllNotes  bool
+		expectedNotes int
+	}{
+		"the index is missing unmigrated notes": {expectedNotes: 1},
+		"scanning finds unmigrated notes":       {scanAllNotes: true, expectedNotes: 2},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable(testTableName)
+			if _, err := ddb.CreateNote(ctx, api, testTableName, &schema.Note{Owner: "a", Title: "new"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// written before migrate-notes backfilled the index, with a timestamp in epoch seconds
+			item, err := attributevalue.MarshalMap(schema.Note{Owner: "a", Title: "old", Version: 1, Timestamp: 1638999997})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err = api.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(testTableName), Item: item}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			h := &Handler{API: api, TableName: testTableName, CursorSigningKey: []byte("test-signing-key"), ScanAllNotes: tt.scanAllNotes}
+
+			response, err := h.Handle(ctx, events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"since": "2021-12-01T00:00:00Z"},
+			})
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("expected status %d but got %d: %s", http.StatusOK, response.StatusCode, response.Body)
+			}
+			var page schema.GetAllNotesResponse
+			if err = json.Unmarshal([]byte(response.Body), &page); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(page.Notes) != tt.expectedNotes {
+				t.Errorf("expected %d notes but got %+v", tt.expectedNotes, page.Notes)
+			}
+		})
+	}
+}
+
+func TestRenderNotes(t *testing.T) {
+	updatedAt := time.Date(2021, 12, 8, 21, 46, 37, 0, time.UTC)
+	notes := []schema.NoteResponse{
+		{Owner: "a", Title: "1", Message: "first", Version: 1, CreatedAt: &updatedAt, UpdatedAt: updatedAt},
+		{Owner: "a", Title: "2", Message: "second", Version: 3, CreatedAt: &updatedAt, UpdatedAt: updatedAt},
+	}
+	cases := map[string]struct {
+		mediaType string
+		// notes replaces the default Notes when set
+		notes        []schema.NoteResponse
+		expectedBody string
+	}{
+		"csv": {
+			mediaType: csvMediaType,
+			expectedBody: "owner,title,message,version,created_at,updated_at\n" +
+				"a,1,first,1,2021-12-08T21:46:37Z,2021-12-08T21:46:37Z\n" +
+				"a,2,second,3,2021-12-08T21:46:37Z,2021-12-08T21:46:37Z\n",
+		},
+		"markdown": {
+			mediaType: markdownMediaType,
+			expectedBody: "# Notes\n" +
+				"\n## 1\n\n_a, version 1, updated 2021-12-08T21:46:37Z_\n\n> first\n" +
+				"\n## 2\n\n_a, version 3, updated 2021-12-08T21:46:37Z_\n\n> second\n",
+		},
+		"markdown syntax and line breaks": {
+			mediaType: markdownMediaType,
+			notes: []schema.NoteResponse{
+				{Owner: "a_b", Title: "# [todo](x)\n* _soon_", Message: "## not a section\r\n\nlast\n", Version: 1, UpdatedAt: updatedAt},
+			},
+			expectedBody: "# Notes\n" +
+				"\n## \\# \\[todo\\]\\(x\\) \\* \\_soon\\_\n\n_a\\_b, version 1, updated 2021-12-08T21:46:37Z_\n\n" +
+				"> ## not a section\n>\n> last\n",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			page := notes
+			if tt.notes != nil {
+				page = tt.notes
+			}
+			body, err := renderNotes(tt.mediaType, page)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if body != tt.expectedBody {
+				t.Errorf("expected %q but got %q", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	link := nextLink("/notes/a", map[string]string{"limit": "1", "cursor": "old"}, "new")
+
+	if expected := `</notes/a?cursor=new&limit=1>; rel="next"`; link != expected {
+		t.Errorf("expected %q but got %q", expected, link)
+	}
+}
@@ -0,0 +1,100 @@
+package reader
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/archive"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	jsonMediaType     = "application/json"
+	ndjsonMediaType   = "application/x-ndjson"
+	csvMediaType      = "text/csv"
+	markdownMediaType = "text/markdown"
+)
+
+// listMediaTypes are the representations of a page of Notes, in order of preference when the Accept header allows several
+var listMediaTypes = []string{jsonMediaType, ndjsonMediaType, csvMediaType, markdownMediaType}
+
+// contentTypes are the Content-Type headers of the representations other than JSON
+var contentTypes = map[string]string{
+	ndjsonMediaType:   ndjsonMediaType,
+	csvMediaType:      csvMediaType + "; charset=utf-8",
+	markdownMediaType: markdownMediaType + "; charset=utf-8",
+}
+
+// renderNotes renders a page of Notes as JSON Lines, CSV or Markdown.  JSON Lines and CSV use the same rows as
+// archive.Export, so a listing can be imported like an archive.
+func renderNotes(mediaType string, notes []schema.NoteResponse) (string, error) {
+	if mediaType == markdownMediaType {
+		return renderMarkdown(notes), nil
+	}
+	format := archive.JSONLines
+	if mediaType == csvMediaType {
+		format = archive.CSV
+	}
+	var buf bytes.Buffer
+	encoder, err := archive.NewEncoder(format, &buf)
+	if err != nil {
+		return "", err
+	}
+	for i := range notes {
+		if err = encoder.Encode(schema.NoteFromResponse(&notes[i])); err != nil {
+			return "", err
+		}
+	}
+	if err = encoder.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderMarkdown renders a section per Note, headed by its title, with the message as the body
+func renderMarkdown(notes []schema.NoteResponse) string {
+	var b strings.Builder
+	b.WriteString("# Notes\n")
+	for _, note := range notes {
+		fmt.Fprintf(&b, "\n## %s\n\n_%s, version %d, updated %s_\n\n%s\n", markdownInline(note.Title),
+			markdownInline(note.Owner), note.Version, note.UpdatedAt.Format(time.RFC3339), markdownQuote(note.Message))
+	}
+	return b.String()
+}
+
+// markdownEscaper backslash escapes the punctuation that Markdown may read as syntax, and folds line breaks into spaces
+var markdownEscaper = func() *strings.Replacer {
+	oldnew := []string{"\r\n", " ", "\n", " ", "\r", " "}
+	for _, c := range "\\`*_{}[]<>()#+-.!|~" {
+		oldnew = append(oldnew, string(c), "\\"+string(c))
+	}
+	return strings.NewReplacer(oldnew...)
+}()
+
+// markdownInline escapes text placed in a heading or emphasis, so it reads as the literal text on a single line
+func markdownInline(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// markdownQuote renders a message as a block quote.  The message keeps its own Markdown, but its headings cannot be
+// mistaken for the sections of the listing.
+func markdownQuote(message string) string {
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(message, "\r\n", "\n"), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// nextLink is the Link header pointing at the next page, which the representations other than JSON have no room for in
+// their body
+func nextLink(path string, query map[string]string, cursor string) string {
+	values := url.Values{}
+	for k, v := range query {
+		values.Set(k, v)
+	}
+	values.Set("cursor", cursor)
+	return fmt.Sprintf("<%s?%s>; rel=\"next\"", path, values.Encode())
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"time"
+)
+
+var APIKeysKeySchema = []types.KeySchemaElement{
+	{KeyType: types.KeyTypeHash, AttributeName: aws.String("key_hash")},
+}
+
+var APIKeysAttributeDefinitions = []types.AttributeDefinition{
+	{AttributeName: aws.String("key_hash"), AttributeType: types.ScalarAttributeTypeS},
+}
+
+// APIKey is the storage model of an API key, as written to DynamoDB.
+//
+// The key itself is never stored, only its HashAPIKey, so a leaked table does not leak the keys.
+type APIKey struct {
+	KeyHash string `dynamodbav:"key_hash"`
+	// Owner is the owner of the Notes the key may write
+	Owner  string   `dynamodbav:"owner"`
+	Scopes []string `dynamodbav:"scopes,stringset,omitempty"`
+	// CreatedAt is the time the key was issued in epoch millis
+	CreatedAt int64 `dynamodbav:"created_at"`
+	// ExpiresAt is in epoch seconds so the table can delete expired keys with TTL, zero for a key that does not expire
+	ExpiresAt int64 `dynamodbav:"expires_at,omitempty"`
+}
+
+// HashAPIKey is the hex encoded SHA-256 of the key, which identifies it in the table
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Expired reports whether the key has expired at now.  TTL deletes expired items lazily, so they must still be checked.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != 0 && now.Unix() >= k.ExpiresAt
+}
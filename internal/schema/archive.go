@@ -0,0 +1,43 @@
+package schema
+
+// ImportStatus is the outcome of a single Note of an imported archive
+type ImportStatus string
+
+const (
+	// ImportCreated means the Note did not exist and was written
+	ImportCreated ImportStatus = "created"
+	// ImportUnchanged means a Note with the same owner, title and message already exists, so importing an archive again
+	// does not write anything
+	ImportUnchanged ImportStatus = "unchanged"
+	// ImportSkipped means a different Note with the same owner and title exists and was kept
+	ImportSkipped ImportStatus = "skipped"
+	// ImportOverwritten means a different Note with the same owner and title exists and its message was replaced
+	ImportOverwritten ImportStatus = "overwritten"
+	// ImportRenamed means a different Note with the same owner and title exists and the Note was written under a new title
+	ImportRenamed ImportStatus = "renamed"
+	// ImportRejected means the Note is not valid and was not written
+	ImportRejected ImportStatus = "rejected"
+	// ImportFailed means the Note was valid but could not be written, the archive can be imported again
+	ImportFailed ImportStatus = "failed"
+)
+
+// ImportResult is the outcome of the Note at Index in an archive.
+//
+// NewTitle is set for a renamed Note, or an unchanged Note already imported under a new title, Errors for a rejected
+// Note and Detail for a failed Note.
+type ImportResult struct {
+	Index    int          `json:"index"`
+	Owner    string       `json:"owner"`
+	Title    string       `json:"title"`
+	Status   ImportStatus `json:"status"`
+	NewTitle string       `json:"new_title,omitempty"`
+	Detail   string       `json:"detail,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// ImportResponse is the wire model of the outcome of an import, counting the Notes of each ImportStatus and with a
+// result for every Note in archive order
+type ImportResponse struct {
+	Counts  map[ImportStatus]int `json:"counts"`
+	Results []ImportResult       `json:"results"`
+}
@@ -0,0 +1,56 @@
+package schema
+
+import "fmt"
+
+// MaxBatchNotes is the largest number of Notes accepted by a single batch request
+const MaxBatchNotes = 100
+
+// BatchNoteStatus is the outcome of a single Note in a batch request
+type BatchNoteStatus string
+
+const (
+	// BatchNoteCreated means the Note was written
+	BatchNoteCreated BatchNoteStatus = "created"
+	// BatchNoteRejected means the Note failed validation and was not written, the request must be corrected
+	BatchNoteRejected BatchNoteStatus = "rejected"
+	// BatchNoteConflict means a Note with the same owner and title already exists and was left as it is
+	BatchNoteConflict BatchNoteStatus = "conflict"
+	// BatchNoteFailed means the Note was valid but could not be written, the request can be retried
+	BatchNoteFailed BatchNoteStatus = "failed"
+)
+
+// BatchNoteRequest is the body of a request to create many Notes at once
+type BatchNoteRequest struct {
+	Notes []NoteRequest `json:"notes"`
+}
+
+// Validate checks the size of the batch against the BatchNoteRequest schema, returning a *ValidationError.  The Notes
+// are validated one at a time by the caller, so a single invalid Note does not reject the batch.
+func (r *BatchNoteRequest) Validate() error {
+	v := &validator{}
+	if len(r.Notes) == 0 {
+		v.add("notes", "is required")
+	} else if len(r.Notes) > MaxBatchNotes {
+		v.add("notes", fmt.Sprintf("must contain at most %d notes", MaxBatchNotes))
+	}
+	return v.err()
+}
+
+// BatchNoteResult is the outcome of the Note at Index in a BatchNoteRequest.
+//
+// Location is set for a created or conflicting Note, Errors for a rejected Note and Detail for a conflicting or failed
+// Note.
+type BatchNoteResult struct {
+	Index    int             `json:"index"`
+	Owner    string          `json:"owner"`
+	Title    string          `json:"title"`
+	Status   BatchNoteStatus `json:"status"`
+	Location string          `json:"location,omitempty"`
+	Detail   string          `json:"detail,omitempty"`
+	Errors   []FieldError    `json:"errors,omitempty"`
+}
+
+// BatchNoteResponse is the wire model of the results of a batch request, with a result for every Note in request order
+type BatchNoteResponse struct {
+	Results []BatchNoteResult `json:"results"`
+}
@@ -13,6 +13,31 @@ var NotesKeySchema = []types.KeySchemaElement{
 var NotesAttributeDefinitions = []types.AttributeDefinition{
 	{AttributeName: aws.String("owner"), AttributeType: types.ScalarAttributeTypeS},
 	{AttributeName: aws.String("title"), AttributeType: types.ScalarAttributeTypeS},
+	{AttributeName: aws.String(RecentNotesPartitionAttribute), AttributeType: types.ScalarAttributeTypeS},
+	{AttributeName: aws.String("updated_at"), AttributeType: types.ScalarAttributeTypeN},
 }
 
-var NotesProvisionedThroughput = &types.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(10), WriteCapacityUnits: aws.Int64(5)}
+const (
+	// RecentNotesIndexName is the global secondary index ordering every Note by updated_at
+	RecentNotesIndexName = "recent-notes"
+	// RecentNotesPartitionAttribute is the partition key of the RecentNotesIndexName index.  Every Note is written with
+	// the same RecentNotesPartition value, so a single Query reads Notes across all owners.  That one partition caps the
+	// table at about 1,000 writes per second, see the README.
+	RecentNotesPartitionAttribute = "feed"
+	// RecentNotesPartition is the value of RecentNotesPartitionAttribute on every Note
+	RecentNotesPartition = "notes"
+)
+
+var RecentNotesKeySchema = []types.KeySchemaElement{
+	{KeyType: types.KeyTypeHash, AttributeName: aws.String(RecentNotesPartitionAttribute)},
+	{KeyType: types.KeyTypeRange, AttributeName: aws.String("updated_at")},
+}
+
+// NotesGlobalSecondaryIndexes are created along with the table, which uses on-demand billing
+var NotesGlobalSecondaryIndexes = []types.GlobalSecondaryIndex{
+	{
+		IndexName:  aws.String(RecentNotesIndexName),
+		KeySchema:  RecentNotesKeySchema,
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	},
+}
@@ -1,12 +1,141 @@
 package schema
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecondTimestampLimit separates the two units found in the timestamp attribute.  Notes written before timestamps were
+// recorded in epoch millis hold epoch seconds, which are always below this value; a millisecond timestamp only drops below
+// it for times before September 2001.
+const SecondTimestampLimit = int64(1e12)
+
+// Note is the storage model of a Note, as written to DynamoDB.
+//
+// It is never returned to callers directly, the handlers convert it with NewNoteResponse.
 type Note struct {
-	Owner     string `dynamodbav:"owner"`
-	Title     string `dynamodbav:"title"`
-	Message   string `dynamodbav:"message"`
-	Timestamp int64  `dynamodbav:"timestamp",json:"omitempty"`
+	Owner   string `dynamodbav:"owner"`
+	Title   string `dynamodbav:"title"`
+	Message string `dynamodbav:"message"`
+	// Timestamp is the time of the last write in epoch millis, see NormalizeTimestamp for Notes written in epoch seconds
+	Timestamp int64 `dynamodbav:"timestamp"`
+	Version   int64 `dynamodbav:"version"`
+	// CreatedAt is the time of the first write in epoch millis, zero for Notes written before it was recorded
+	CreatedAt int64 `dynamodbav:"created_at,omitempty"`
+	// UpdatedAt is the time of the last write in epoch millis, zero for Notes written before it was recorded
+	UpdatedAt int64 `dynamodbav:"updated_at,omitempty"`
+	// ExpiresAt is the time of the last write in epoch seconds, read by the table's TTL, see ExpiresAtFromTimestamp
+	ExpiresAt int64 `dynamodbav:"expires_at,omitempty"`
+}
+
+// NoteResponse is the wire model of a Note, matching the NoteResponse schema in the OpenAPI specification
+type NoteResponse struct {
+	Owner   string `json:"owner"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	// Timestamp is the time of the last write in epoch millis
+	Timestamp int64 `json:"timestamp"`
+	Version   int64 `json:"version"`
+	// CreatedAt is absent for Notes that do not record when they were created
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// NewNoteResponse converts the stored Note to its wire model
+func NewNoteResponse(note *Note) *NoteResponse {
+	timestamp := NormalizeTimestamp(note.Timestamp)
+	response := &NoteResponse{
+		Owner:     note.Owner,
+		Title:     note.Title,
+		Message:   note.Message,
+		Timestamp: timestamp,
+		Version:   note.Version,
+		UpdatedAt: time.UnixMilli(timestamp).UTC(),
+	}
+	if note.UpdatedAt != 0 {
+		response.UpdatedAt = time.UnixMilli(note.UpdatedAt).UTC()
+	}
+	if note.CreatedAt != 0 {
+		createdAt := time.UnixMilli(note.CreatedAt).UTC()
+		response.CreatedAt = &createdAt
+	}
+	return response
+}
+
+// NewNoteResponses converts every stored Note to its wire model.  The result is never nil, so an empty list is
+// serialized as [] rather than null.
+func NewNoteResponses(notes []Note) []NoteResponse {
+	responses := make([]NoteResponse, 0, len(notes))
+	for i := range notes {
+		responses = append(responses, *NewNoteResponse(&notes[i]))
+	}
+	return responses
+}
+
+// NoteFromResponse converts the wire model back to a Note, e.g. to compute its ETag
+func NoteFromResponse(response *NoteResponse) *Note {
+	return &Note{
+		Owner:     response.Owner,
+		Title:     response.Title,
+		Message:   response.Message,
+		Timestamp: response.Timestamp,
+		Version:   response.Version,
+		CreatedAt: unixMilli(response.CreatedAt),
+		UpdatedAt: response.UpdatedAt.UnixMilli(),
+	}
+}
+
+// unixMilli returns t in epoch millis, or zero when t is nil
+func unixMilli(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// ExpiresAtFromTimestamp returns the expires_at of a Note last written at timestamp.  DynamoDB reads TTL values as epoch
+// seconds, so the TTL is kept apart from the millisecond timestamp and holds what timestamp held before it moved to
+// epoch millis.
+func ExpiresAtFromTimestamp(timestamp int64) int64 {
+	return NormalizeTimestamp(timestamp) / 1000
+}
+
+// NormalizeTimestamp returns the timestamp in epoch millis, converting timestamps below SecondTimestampLimit from epoch
+// seconds.
+func NormalizeTimestamp(timestamp int64) int64 {
+	if timestamp < SecondTimestampLimit {
+		return timestamp * 1000
+	}
+	return timestamp
+}
+
+// NoteUpdateRequest is the body of a PUT or PATCH request for a single Note
+type NoteUpdateRequest struct {
+	Message *string `json:"message"`
+}
+
+// ETag returns the strong entity tag for the current Version of the Note
+func (n *Note) ETag() string {
+	return strconv.Quote(strconv.FormatInt(n.Version, 10))
+}
+
+// ParseETag returns the Note Version from an entity tag created by Note.ETag
+func ParseETag(etag string) (int64, error) {
+	unquoted, err := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(etag, "W/")))
+	if err != nil {
+		return 0, errors.New("entity tag must be a quoted string")
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 0 {
+		return 0, errors.New("entity tag is not a Note version")
+	}
+	return version, nil
 }
 
+// GetAllNotesResponse is the wire model of a page of Notes, matching the MultipleNoteResponse schema
 type GetAllNotesResponse struct {
-	Notes []Note
+	Notes      []NoteResponse `json:"notes"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
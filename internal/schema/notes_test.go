@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewNoteResponse(t *testing.T) {
+	cases := map[string]struct {
+		timestamp         int64
+		createdAt         int64
+		updatedAt         int64
+		expectedTimestamp int64
+		expectedCreatedAt string
+		expectedUpdatedAt string
+	}{
+		"recorded times are used": {
+			timestamp:         1639000000000,
+			createdAt:         1638999997123,
+			updatedAt:         1639000000000,
+			expectedTimestamp: 1639000000000,
+			expectedCreatedAt: "2021-12-08T21:46:37.123Z",
+			expectedUpdatedAt: "2021-12-08T21:46:40Z",
+		},
+		"millisecond timestamps are kept": {
+			timestamp:         1638999997123,
+			expectedTimestamp: 1638999997123,
+			expectedUpdatedAt: "2021-12-08T21:46:37.123Z",
+		},
+		"second timestamps are converted": {
+			timestamp:         1638999997,
+			expectedTimestamp: 1638999997000,
+			expectedUpdatedAt: "2021-12-08T21:46:37Z",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			note := &Note{Owner: "adam", Title: "tweek week", Message: "message", Timestamp: tt.timestamp, Version: 2, CreatedAt: tt.createdAt, UpdatedAt: tt.updatedAt}
+
+			b, err := json.Marshal(NewNoteResponse(note))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var body map[string]interface{}
+			if err = json.Unmarshal(b, &body); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			expected := map[string]interface{}{
+				"owner":      "adam",
+				"title":      "tweek week",
+				"message":    "message",
+				"timestamp":  float64(tt.expectedTimestamp),
+				"version":    float64(2),
+				"updated_at": tt.expectedUpdatedAt,
+			}
+			if tt.expectedCreatedAt != "" {
+				expected["created_at"] = tt.expectedCreatedAt
+			}
+			if len(body) != len(expected) {
+				t.Errorf("expected %v but got %v", expected, body)
+			}
+			for k, v := range expected {
+				if body[k] != v {
+					t.Errorf("expected %s to be %v but got %v", k, v, body[k])
+				}
+			}
+		})
+	}
+}
+
+func TestNewNoteResponses(t *testing.T) {
+	b, err := json.Marshal(GetAllNotesResponse{Notes: NewNoteResponses(nil)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(b) != `{"notes":[]}` {
+		t.Errorf("expected an empty list of notes but got %s", b)
+	}
+}
@@ -0,0 +1,40 @@
+package schema
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// ProblemContentType is the media type of every error response
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object.
+//
+// Errors is an extension member listing the fields that failed validation, and CancellationReasons lists why each action
+// of a canceled transaction failed.
+type Problem struct {
+	Type                string               `json:"type"`
+	Title               string               `json:"title"`
+	Status              int                  `json:"status"`
+	Detail              string               `json:"detail,omitempty"`
+	Instance            string               `json:"instance,omitempty"`
+	AwsRequestID        string               `json:"aws_request_id,omitempty"`
+	Errors              []FieldError         `json:"errors,omitempty"`
+	CancellationReasons []CancellationReason `json:"cancellation_reasons,omitempty"`
+}
+
+// CancellationReason describes a single action of a canceled transaction
+type CancellationReason struct {
+	Action  string `json:"action"`
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (p *Problem) String() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("error marshalling problem: %s\n", err)
+		return "error building response"
+	}
+	return string(b)
+}
@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxOwnerBytes is the DynamoDB limit for a partition key value
+	MaxOwnerBytes = 2048
+	// MaxTitleBytes is the DynamoDB limit for a sort key value
+	MaxTitleBytes = 1024
+	// MaxMessageBytes keeps a Note under the 400KB DynamoDB item limit, leaving room for the keys and the other attributes
+	MaxMessageBytes = 400*1024 - MaxOwnerBytes - MaxTitleBytes - 4*1024
+)
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request does not satisfy the constraints in the OpenAPI specification
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var messages []string
+	for _, f := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s %s", f.Field, f.Message))
+	}
+	return "invalid request: " + strings.Join(messages, ", ")
+}
+
+// NoteRequest is the body of a request to create a Note
+type NoteRequest struct {
+	Owner   string `json:"owner"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// Validate checks the NoteRequest against the NoteRequest schema, returning a *ValidationError listing every invalid field.
+func (r *NoteRequest) Validate() error {
+	v := &validator{}
+	v.requireString("owner", r.Owner, MaxOwnerBytes)
+	v.requireString("title", r.Title, MaxTitleBytes)
+	v.requireString("message", r.Message, MaxMessageBytes)
+	return v.err()
+}
+
+// Validate checks the NoteUpdateRequest against the NoteUpdateRequest schema, returning a *ValidationError listing every
+// invalid field.
+func (r *NoteUpdateRequest) Validate() error {
+	v := &validator{}
+	if r.Message == nil {
+		v.add("message", "is required")
+	} else {
+		v.requireString("message", *r.Message, MaxMessageBytes)
+	}
+	return v.err()
+}
+
+// NoteMoveRequest is the body of a request to move a Note to another owner, title, or both.  An empty field keeps the
+// current value.
+type NoteMoveRequest struct {
+	Owner string `json:"owner"`
+	Title string `json:"title"`
+}
+
+// Validate checks the NoteMoveRequest against the NoteMoveRequest schema, returning a *ValidationError listing every
+// invalid field.
+func (r *NoteMoveRequest) Validate() error {
+	v := &validator{}
+	if r.Owner == "" && r.Title == "" {
+		v.add("owner", "or title is required")
+	}
+	v.limitString("owner", r.Owner, MaxOwnerBytes)
+	v.limitString("title", r.Title, MaxTitleBytes)
+	return v.err()
+}
+
+// NoteRenameRequest is the body of a request to give a Note a new title
+type NoteRenameRequest struct {
+	Title string `json:"title"`
+}
+
+// Validate checks the NoteRenameRequest against the NoteRenameRequest schema, returning a *ValidationError listing every
+// invalid field.
+func (r *NoteRenameRequest) Validate() error {
+	v := &validator{}
+	v.requireString("title", r.Title, MaxTitleBytes)
+	return v.err()
+}
+
+type validator struct {
+	fields []FieldError
+}
+
+func (v *validator) add(field, message string) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: message})
+}
+
+func (v *validator) requireString(field, value string, maxBytes int) {
+	if len(value) == 0 {
+		v.add(field, "is required")
+	} else if len(value) > maxBytes {
+		v.add(field, fmt.Sprintf("must be at most %d bytes", maxBytes))
+	}
+}
+
+func (v *validator) limitString(field, value string, maxBytes int) {
+	if len(value) > maxBytes {
+		v.add(field, fmt.Sprintf("must be at most %d bytes", maxBytes))
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
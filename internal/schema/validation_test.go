@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNoteRequest_Validate(t *testing.T) {
+	cases := map[string]struct {
+		request        NoteRequest
+		expectedFields []FieldError
+	}{
+		"valid request returns no error": {
+			request: NoteRequest{Owner: "owner", Title: "title", Message: "message"},
+		},
+		"empty request returns every field": {
+			request: NoteRequest{},
+			expectedFields: []FieldError{
+				{Field: "owner", Message: "is required"},
+				{Field: "title", Message: "is required"},
+				{Field: "message", Message: "is required"},
+			},
+		},
+		"oversized values return errors": {
+			request: NoteRequest{
+				Owner:   strings.Repeat("o", MaxOwnerBytes+1),
+				Title:   strings.Repeat("t", MaxTitleBytes+1),
+				Message: strings.Repeat("m", MaxMessageBytes+1),
+			},
+			expectedFields: []FieldError{
+				{Field: "owner", Message: "must be at most 2048 bytes"},
+				{Field: "title", Message: "must be at most 1024 bytes"},
+				{Field: "message", Message: "must be at most 402432 bytes"},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tt.request.Validate()
+			assertFieldErrors(t, err, tt.expectedFields)
+		})
+	}
+}
+
+func TestNoteUpdateRequest_Validate(t *testing.T) {
+	empty, valid := "", "message"
+	cases := map[string]struct {
+		request        NoteUpdateRequest
+		expectedFields []FieldError
+	}{
+		"valid request returns no error": {
+			request: NoteUpdateRequest{Message: &valid},
+		},
+		"missing message returns error": {
+			request:        NoteUpdateRequest{},
+			expectedFields: []FieldError{{Field: "message", Message: "is required"}},
+		},
+		"empty message returns error": {
+			request:        NoteUpdateRequest{Message: &empty},
+			expectedFields: []FieldError{{Field: "message", Message: "is required"}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tt.request.Validate()
+			assertFieldErrors(t, err, tt.expectedFields)
+		})
+	}
+}
+
+func TestNoteMoveRequest_Validate(t *testing.T) {
+	cases := map[string]struct {
+		request        NoteMoveRequest
+		expectedFields []FieldError
+	}{
+		"new title returns no error": {
+			request: NoteMoveRequest{Title: "title"},
+		},
+		"new owner returns no error": {
+			request: NoteMoveRequest{Owner: "owner"},
+		},
+		"missing owner and title returns error": {
+			request:        NoteMoveRequest{},
+			expectedFields: []FieldError{{Field: "owner", Message: "or title is required"}},
+		},
+		"long title returns error": {
+			request:        NoteMoveRequest{Title: strings.Repeat("t", MaxTitleBytes+1)},
+			expectedFields: []FieldError{{Field: "title", Message: fmt.Sprintf("must be at most %d bytes", MaxTitleBytes)}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tt.request.Validate()
+			assertFieldErrors(t, err, tt.expectedFields)
+		})
+	}
+}
+
+func TestNoteRenameRequest_Validate(t *testing.T) {
+	cases := map[string]struct {
+		request        NoteRenameRequest
+		expectedFields []FieldError
+	}{
+		"valid request returns no error": {
+			request: NoteRenameRequest{Title: "title"},
+		},
+		"missing title returns error": {
+			request:        NoteRenameRequest{},
+			expectedFields: []FieldError{{Field: "title", Message: "is required"}},
+		},
+		"long title returns error": {
+			request:        NoteRenameRequest{Title: strings.Repeat("t", MaxTitleBytes+1)},
+			expectedFields: []FieldError{{Field: "title", Message: fmt.Sprintf("must be at most %d bytes", MaxTitleBytes)}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tt.request.Validate()
+			assertFieldErrors(t, err, tt.expectedFields)
+		})
+	}
+}
+
+func assertFieldErrors(t *testing.T, err error, expected []FieldError) {
+	t.Helper()
+	if expected == nil {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("unexpected error: wanted ValidationError got %v", err)
+	}
+	if !reflect.DeepEqual(verr.Fields, expected) {
+		t.Fatalf("unexpected fields: wanted %+v got %+v", expected, verr.Fields)
+	}
+}
@@ -0,0 +1,369 @@
+// Package writer handles the API Gateway requests that create, update, move and delete Notes, one at a time or in
+// batches.
+package writer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// batchResource is the API Gateway resource that creates many Notes in one request
+	batchResource = "/notes:batch"
+	// moveResource is the API Gateway resource that moves a Note to a new owner or title
+	moveResource = "/notes/{owner}/{title}:move"
+	// renameResource is the API Gateway resource that gives a Note a new title
+	renameResource = "/notes/{owner}/{title}:rename"
+)
+
+// API is the set of DynamoDB Client functions needed by the writer
+type API interface {
+	ddb.DynamoUpdateItemAPI
+	ddb.DynamoDeleteItemAPI
+	ddb.DynamoBatchAPI
+	ddb.DynamoMoveNoteAPI
+}
+
+// Handler writes Notes to a DynamoDB table
+type Handler struct {
+	API       API
+	TableName string
+	// Authenticator identifies the caller, who can only write their own Notes.  When nil every request is allowed.
+	Authenticator auth.Authenticator
+}
+
+// Handle is the API Gateway proxy handler for the writer
+func (h *Handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	requestID := apigw.RequestID(ctx, request)
+	log.Printf("request %s: %s %s", requestID, request.HTTPMethod, request.Path)
+	principal, err := auth.Authenticate(ctx, h.Authenticator, request)
+	if err != nil {
+		return handleError(requestID, request, err), nil
+	}
+	if owner, ok := request.PathParameters["owner"]; ok {
+		if err = principal.RequireOwner(owner); err != nil {
+			return handleError(requestID, request, err), nil
+		}
+	}
+
+	switch {
+	case request.HTTPMethod == http.MethodPost && request.Resource == batchResource:
+		return h.handleBatch(ctx, requestID, principal, request), nil
+	case request.HTTPMethod == http.MethodPost && request.Resource == moveResource:
+		return h.handleMove(ctx, requestID, principal, request, h.moveNote), nil
+	case request.HTTPMethod == http.MethodPost && request.Resource == renameResource:
+		return h.handleMove(ctx, requestID, principal, request, h.renameNote), nil
+	case request.HTTPMethod == http.MethodPost:
+		return h.handleCreate(ctx, requestID, principal, request), nil
+	case request.HTTPMethod == http.MethodPut, request.HTTPMethod == http.MethodPatch:
+		return h.handleUpdate(ctx, requestID, request), nil
+	case request.HTTPMethod == http.MethodDelete:
+		return h.handleDelete(ctx, requestID, request), nil
+	default:
+		err := &apigw.RequestError{StatusCode: http.StatusMethodNotAllowed, Detail: fmt.Sprintf("method %q is not supported", request.HTTPMethod)}
+		return apigw.ErrorResponse(err, requestID, request.Path), nil
+	}
+}
+
+func (h *Handler) handleCreate(ctx context.Context, requestID string, principal *auth.Principal, request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	note, err := h.createNote(ctx, principal, request)
+	if err != nil {
+		log.Printf("error adding note: %s", err)
+		return handleError(requestID, request, err)
+	}
+
+	return events.APIGatewayProxyResponse{
+		Headers: map[string]string{
+			"Location": noteLocation(note.Owner, note.Title),
+		},
+		StatusCode: http.StatusCreated,
+	}
+}
+
+func (h *Handler) handleBatch(ctx context.Context, requestID string, principal *auth.Principal, request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	response, err := h.batchCreateNotes(ctx, principal, request)
+	if err != nil {
+		log.Printf("error adding notes: %s", err)
+		return handleError(requestID, request, err)
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("error marshalling response: %s\n", err)
+		return handleError(requestID, request, err)
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       string(body),
+	}
+}
+
+// batchCreateNotes validates every Note of a batch request on its own and creates the valid ones with
+// ddb.BatchAddNotes, returning a result for every Note.  Only a request that is not a valid batch returns an error.  Notes
+// without an owner belong to the caller, and Notes of other owners are rejected.
+func (h *Handler) batchCreateNotes(ctx context.Context, principal *auth.Principal, request events.APIGatewayProxyRequest) (*schema.BatchNoteResponse, error) {
+	var batchRequest schema.BatchNoteRequest
+	if err := decodeBody(request, &batchRequest); err != nil {
+		return nil, err
+	}
+	if err := batchRequest.Validate(); err != nil {
+		return nil, err
+	}
+	results := make([]schema.BatchNoteResult, len(batchRequest.Notes))
+	var notes []schema.Note
+	var indexes []int
+	seen := make(map[[2]string]int)
+	for i, n := range batchRequest.Notes {
+		n.Owner = callerOwner(principal, n.Owner)
+		results[i] = schema.BatchNoteResult{Index: i, Owner: n.Owner, Title: n.Title, Status: schema.BatchNoteRejected}
+		if err := n.Validate(); err != nil {
+			var verr *schema.ValidationError
+			if !errors.As(err, &verr) {
+				return nil, err
+			}
+			results[i].Errors = verr.Fields
+			continue
+		}
+		if err := principal.RequireOwner(n.Owner); err != nil {
+			results[i].Errors = []schema.FieldError{{Field: "owner", Message: err.Error()}}
+			continue
+		}
+		key := [2]string{n.Owner, n.Title}
+		if first, ok := seen[key]; ok {
+			results[i].Errors = []schema.FieldError{{Field: "title", Message: fmt.Sprintf("duplicates the note at index %d", first)}}
+			continue
+		}
+		seen[key] = i
+		notes = append(notes, schema.Note{Owner: n.Owner, Title: n.Title, Message: n.Message})
+		indexes = append(indexes, i)
+	}
+	if len(notes) > 0 {
+		written, err := ddb.BatchAddNotes(ctx, h.API, h.TableName, notes)
+		if written == nil {
+			return nil, err
+		}
+		for j, werr := range written {
+			result := &results[indexes[j]]
+			var eerr *ddb.NoteExistsError
+			if errors.As(werr, &eerr) {
+				result.Status, result.Location, result.Detail = schema.BatchNoteConflict, noteLocation(result.Owner, result.Title), werr.Error()
+				continue
+			}
+			if werr != nil {
+				log.Printf("error adding note %d: %s", result.Index, werr)
+				result.Status, result.Detail = schema.BatchNoteFailed, werr.Error()
+				continue
+			}
+			result.Status, result.Location = schema.BatchNoteCreated, noteLocation(result.Owner, result.Title)
+		}
+	}
+	log.Printf("batch of %d notes: %d valid, %d rejected", len(results), len(notes), len(results)-len(notes))
+	return &schema.BatchNoteResponse{Results: results}, nil
+}
+
+func (h *Handler) handleUpdate(ctx context.Context, requestID string, request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	note, err := h.updateNote(ctx, request)
+	if err != nil {
+		log.Printf("error updating note: %s", err)
+		return handleError(requestID, request, err)
+	}
+	body, err := json.Marshal(schema.NewNoteResponse(note))
+	if err != nil {
+		log.Printf("error marshalling response: %s\n", err)
+		return handleError(requestID, request, err)
+	}
+	return events.APIGatewayProxyResponse{
+		Headers: map[string]string{
+			"ETag": note.ETag(),
+		},
+		StatusCode: http.StatusOK,
+		Body:       string(body),
+	}
+}
+
+// updateNote applies a PUT or PATCH request to the Note identified by the path, but only when the If-Match header matches
+// the stored version of the Note.
+func (h *Handler) updateNote(ctx context.Context, request events.APIGatewayProxyRequest) (*schema.Note, error) {
+	ifMatch := apigw.Header(request, "If-Match")
+	if ifMatch == "" {
+		return nil, &apigw.RequestError{StatusCode: http.StatusPreconditionRequired, Detail: "the If-Match header is required"}
+	}
+	expectedVersion, err := ifMatchVersion(request)
+	if err != nil {
+		return nil, err
+	}
+	var updateRequest schema.NoteUpdateRequest
+	if err := decodeBody(request, &updateRequest); err != nil {
+		return nil, err
+	}
+	if err := updateRequest.Validate(); err != nil {
+		return nil, err
+	}
+	note := &schema.Note{
+		Owner:   request.PathParameters["owner"],
+		Title:   request.PathParameters["title"],
+		Message: *updateRequest.Message,
+	}
+	return ddb.UpdateNote(ctx, h.API, h.TableName, note, expectedVersion)
+}
+
+// moveFunc moves the Note identified by the path of a request to a new key, returning the moved Note
+type moveFunc func(ctx context.Context, principal *auth.Principal, request events.APIGatewayProxyRequest) (*schema.Note, error)
+
+// handleMove responds to a request that moves a Note to a new key with move, pointing at the moved Note
+func (h *Handler) handleMove(ctx context.Context, requestID string, principal *auth.Principal, request events.APIGatewayProxyRequest, move moveFunc) events.APIGatewayProxyResponse {
+	note, err := move(ctx, principal, request)
+	if err != nil {
+		log.Printf("error moving note: %s", err)
+		return handleError(requestID, request, err)
+	}
+	body, err := json.Marshal(schema.NewNoteResponse(note))
+	if err != nil {
+		log.Printf("error marshalling response: %s\n", err)
+		return handleError(requestID, request, err)
+	}
+	return events.APIGatewayProxyResponse{
+		Headers: map[string]string{
+			"ETag":     note.ETag(),
+			"Location": noteLocation(note.Owner, note.Title),
+		},
+		StatusCode: http.StatusCreated,
+		Body:       string(body),
+	}
+}
+
+// moveNote moves the Note identified by the path to the owner and title of the request body.  The If-Match header is
+// optional, without it the Note is moved whatever its version.  The caller can only move a Note to themselves.
+func (h *Handler) moveNote(ctx context.Context, principal *auth.Principal, request events.APIGatewayProxyRequest) (*schema.Note, error) {
+	expectedVersion, err := ifMatchVersion(request)
+	if err != nil {
+		return nil, err
+	}
+	var moveRequest schema.NoteMoveRequest
+	if err := decodeBody(request, &moveRequest); err != nil {
+		return nil, err
+	}
+	if err := moveRequest.Validate(); err != nil {
+		return nil, err
+	}
+	owner, title := request.PathParameters["owner"], request.PathParameters["title"]
+	newOwner, newTitle := moveRequest.Owner, moveRequest.Title
+	if newOwner == "" {
+		newOwner = owner
+	}
+	if newTitle == "" {
+		newTitle = title
+	}
+	if err := principal.RequireOwner(newOwner); err != nil {
+		return nil, err
+	}
+	return ddb.MoveNote(ctx, h.API, h.TableName, owner, title, newOwner, newTitle, expectedVersion)
+}
+
+// renameNote gives the Note identified by the path the title of the request body.  Like a move, the If-Match header is
+// optional.
+func (h *Handler) renameNote(ctx context.Context, _ *auth.Principal, request events.APIGatewayProxyRequest) (*schema.Note, error) {
+	expectedVersion, err := ifMatchVersion(request)
+	if err != nil {
+		return nil, err
+	}
+	var renameRequest schema.NoteRenameRequest
+	if err := decodeBody(request, &renameRequest); err != nil {
+		return nil, err
+	}
+	if err := renameRequest.Validate(); err != nil {
+		return nil, err
+	}
+	owner, title := request.PathParameters["owner"], request.PathParameters["title"]
+	return ddb.RenameNote(ctx, h.API, h.TableName, owner, title, renameRequest.Title, expectedVersion)
+}
+
+func (h *Handler) handleDelete(ctx context.Context, requestID string, request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	owner, title := request.PathParameters["owner"], request.PathParameters["title"]
+	if err := ddb.DeleteNote(ctx, h.API, h.TableName, owner, title); err != nil {
+		log.Printf("error deleting note: %s", err)
+		return handleError(requestID, request, err)
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusNoContent,
+	}
+}
+
+// createNote writes the Note of the request body for the caller, who is its owner when the body has none
+func (h *Handler) createNote(ctx context.Context, principal *auth.Principal, request events.APIGatewayProxyRequest) (*schema.Note, error) {
+	var creationRequest schema.NoteRequest
+	if err := decodeBody(request, &creationRequest); err != nil {
+		return nil, err
+	}
+	creationRequest.Owner = callerOwner(principal, creationRequest.Owner)
+	if err := creationRequest.Validate(); err != nil {
+		return nil, err
+	}
+	if err := principal.RequireOwner(creationRequest.Owner); err != nil {
+		return nil, err
+	}
+	note := &schema.Note{
+		Owner:   creationRequest.Owner,
+		Title:   creationRequest.Title,
+		Message: creationRequest.Message,
+	}
+	if _, err := ddb.CreateNote(ctx, h.API, h.TableName, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// handleError returns the problem response for err, pointing a conflicting request at the existing Note
+func handleError(requestID string, request events.APIGatewayProxyRequest, err error) events.APIGatewayProxyResponse {
+	response := apigw.ErrorResponse(err, requestID, request.Path)
+	var eerr *ddb.NoteExistsError
+	if errors.As(err, &eerr) {
+		response.Headers["Location"] = noteLocation(eerr.Owner, eerr.Title)
+	}
+	return response
+}
+
+// ifMatchVersion is the Note version required by the If-Match header, ddb.AnyVersion when the header is missing or "*"
+func ifMatchVersion(request events.APIGatewayProxyRequest) (int64, error) {
+	ifMatch := apigw.Header(request, "If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return ddb.AnyVersion, nil
+	}
+	version, err := schema.ParseETag(ifMatch)
+	if err != nil {
+		return 0, &apigw.RequestError{StatusCode: http.StatusPreconditionFailed, Detail: err.Error()}
+	}
+	return version, nil
+}
+
+// decodeBody unmarshals the JSON request body, returning an apigw.RequestError when it is not valid JSON
+func decodeBody(request events.APIGatewayProxyRequest, v interface{}) error {
+	if err := json.Unmarshal([]byte(request.Body), v); err != nil {
+		log.Printf("error unmarshalling request: %s\n", err)
+		return &apigw.RequestError{StatusCode: http.StatusBadRequest, Detail: "request body must be a valid JSON object"}
+	}
+	return nil
+}
+
+// callerOwner is the owner of a Note written by the caller: the owner given in the request, or the caller when it is
+// empty
+func callerOwner(principal *auth.Principal, owner string) string {
+	if owner == "" && principal != nil {
+		return principal.Owner
+	}
+	return owner
+}
+
+// noteLocation is the path of a single Note as served by the reader
+func noteLocation(owner, title string) string {
+	return fmt.Sprintf("/notes/%s/%s", url.PathEscape(owner), url.PathEscape(title))
+}
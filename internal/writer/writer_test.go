@@ -0,0 +1,521 @@
+package writer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/apigw"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb"
+	"github.com/akijowski/tweek-2021-sam/internal/ddb/ddbfake"
+	"github.com/akijowski/tweek-2021-sam/internal/schema"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTableName = "notes"
+
+func TestHandler_Handle(t *testing.T) {
+	existing := &schema.Note{Owner: "test-owner", Title: "existing", Message: "test-message"}
+	cases := map[string]struct {
+		request            events.APIGatewayProxyRequest
+		expectedStatusCode int
+		expectedHeaders    map[string]string
+	}{
+		"create returns the note location": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Path:       "/notes",
+				Body:       `{"owner": "test-owner", "title": "new", "message": "test-message"}`,
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedHeaders:    map[string]string{"Location": "/notes/test-owner/new"},
+		},
+		"create conflict points at the existing note": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Path:       "/notes",
+				Body:       `{"owner": "test-owner", "title": "existing", "message": "test-message"}`,
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedHeaders:    map[string]string{"Location": "/notes/test-owner/existing"},
+		},
+		"create with invalid json": {
+			request:            events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Path: "/notes", Body: "{"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"update requires if-match": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPut,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"message": "updated"}`,
+			},
+			expectedStatusCode: http.StatusPreconditionRequired,
+		},
+		"update with matching version": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPatch,
+				Headers:        map[string]string{"if-match": `"1"`},
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"message": "updated"}`,
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedHeaders:    map[string]string{"ETag": `"2"`},
+		},
+		"update with stale version": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPut,
+				Headers:        map[string]string{"If-Match": `"5"`},
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"message": "updated"}`,
+			},
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		"delete existing note": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodDelete,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+			},
+			expectedStatusCode: http.StatusNoContent,
+		},
+		"delete missing note": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodDelete,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "missing"},
+			},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		"move to a new title": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       moveResource,
+				Headers:        map[string]string{"If-Match": `"1"`},
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"title": "moved"}`,
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedHeaders:    map[string]string{"Location": "/notes/test-owner/moved", "ETag": `"2"`},
+		},
+		"move to a new owner keeps the title": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       moveResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"owner": "other owner"}`,
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedHeaders:    map[string]string{"Location": "/notes/other%20owner/existing"},
+		},
+		"move onto an existing note": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       moveResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"title": "existing"}`,
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedHeaders:    map[string]string{"Location": "/notes/test-owner/existing"},
+		},
+		"move with stale version": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       moveResource,
+				Headers:        map[string]string{"If-Match": `"5"`},
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"title": "moved"}`,
+			},
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		"move missing note": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       moveResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "missing"},
+				Body:           `{"title": "moved"}`,
+			},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		"move without a new owner or title": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       moveResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{}`,
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"rename to a new title": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       renameResource,
+				Headers:        map[string]string{"If-Match": `"1"`},
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"title": "renamed title"}`,
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedHeaders:    map[string]string{"Location": "/notes/test-owner/renamed%20title", "ETag": `"2"`},
+		},
+		"rename to the existing title": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       renameResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"title": "existing"}`,
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedHeaders:    map[string]string{"Location": "/notes/test-owner/existing"},
+		},
+		"rename missing note": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       renameResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "missing"},
+				Body:           `{"title": "renamed"}`,
+			},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		"rename without a title": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       renameResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"owner": "other owner"}`,
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"unsupported method": {
+			request:            events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet},
+			expectedStatusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable(testTableName)
+			if _, err := ddb.CreateNote(ctx, api, testTableName, existing); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			h := &Handler{API: api, TableName: testTableName}
+
+			response, err := h.Handle(ctx, tt.request)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Errorf("expected status %d but got %d: %s", tt.expectedStatusCode, response.StatusCode, response.Body)
+			}
+			for name, value := range tt.expectedHeaders {
+				if got := response.Headers[name]; got != value {
+					t.Errorf("expected header %s to be %q but got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_HandleAuthenticated(t *testing.T) {
+	cases := map[string]struct {
+		request            events.APIGatewayProxyRequest
+		expectedStatusCode int
+		expectedHeaders    map[string]string
+		checkBody          func(t *testing.T, body string)
+	}{
+		"create without an owner writes for the caller": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Path:       "/notes",
+				Body:       `{"title": "new", "message": "test-message"}`,
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedHeaders:    map[string]string{"Location": "/notes/test-owner/new"},
+		},
+		"create for another owner": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Path:       "/notes",
+				Body:       `{"owner": "other", "title": "new", "message": "test-message"}`,
+			},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		"update a note of another owner": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPatch,
+				PathParameters: map[string]string{"owner": "other", "title": "existing"},
+				Headers:        map[string]string{"If-Match": `"1"`},
+				Body:           `{"message": "updated"}`,
+			},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		"delete a note of another owner": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodDelete,
+				PathParameters: map[string]string{"owner": "other", "title": "existing"},
+			},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		"move a note to another owner": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodPost,
+				Resource:       moveResource,
+				PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+				Body:           `{"owner": "other"}`,
+			},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		"batch rejects the notes of another owner": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Resource:   batchResource,
+				Body:       `{"notes": [{"title": "mine", "message": "m"}, {"owner": "other", "title": "theirs", "message": "m"}]}`,
+			},
+			expectedStatusCode: http.StatusOK,
+			checkBody: func(t *testing.T, body string) {
+				var response schema.BatchNoteResponse
+				if err := json.Unmarshal([]byte(body), &response); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if r := response.Results[0]; r.Status != schema.BatchNoteCreated || r.Owner != "test-owner" {
+					t.Errorf("expected the first note to be created for the caller but got %+v", r)
+				}
+				if r := response.Results[1]; r.Status != schema.BatchNoteRejected || len(r.Errors) != 1 || r.Errors[0].Field != "owner" {
+					t.Errorf("expected the second note to be rejected for its owner but got %+v", r)
+				}
+			},
+		},
+		"missing token": {
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Path:       "/notes",
+				Headers:    map[string]string{"X-Test-Anonymous": "true"},
+				Body:       `{"title": "new", "message": "test-message"}`,
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedHeaders:    map[string]string{"WWW-Authenticate": "Bearer"},
+		},
+	}
+
+	authenticator := auth.AuthenticatorFunc(func(ctx context.Context, request events.APIGatewayProxyRequest) (*auth.Principal, error) {
+		if request.Headers["X-Test-Anonymous"] != "" {
+			return nil, &apigw.RequestError{StatusCode: http.StatusUnauthorized, Detail: "missing token"}
+		}
+		return &auth.Principal{Owner: "test-owner", Scopes: []string{auth.AdminScope}}, nil
+	})
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			api := ddbfake.NewNotesTable(testTableName)
+			for _, owner := range []string{"test-owner", "other"} {
+				if _, err := ddb.CreateNote(ctx, api, testTableName, &schema.Note{Owner: owner, Title: "existing", Message: "m"}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			h := &Handler{API: api, TableName: testTableName, Authenticator: authenticator}
+
+			response, err := h.Handle(ctx, tt.request)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Errorf("expected status %d but got %d: %s", tt.expectedStatusCode, response.StatusCode, response.Body)
+			}
+			for name, value := range tt.expectedHeaders {
+				if got := response.Headers[name]; got != value {
+					t.Errorf("expected header %s to be %q but got %q", name, value, got)
+				}
+			}
+			if tt.checkBody != nil {
+				tt.checkBody(t, response.Body)
+			}
+		})
+	}
+}
+
+// failingBatchAPI is the fake table with a BatchWriteItem that always fails
+type failingBatchAPI struct {
+	*ddbfake.Client
+}
+
+func (failingBatchAPI) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	return nil, errors.New("throttled")
+}
+
+func TestHandler_HandleBatch(t *testing.T) {
+	tooMany := make([]string, schema.MaxBatchNotes+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf(`{"owner": "a", "title": "%d", "message": "m"}`, i)
+	}
+	cases := map[string]struct {
+		body               string
+		existing           []schema.Note
+		failWrites         bool
+		expectedStatusCode int
+		expectedStatuses   []schema.BatchNoteStatus
+		expectedStored     int
+	}{
+		"valid notes are created and invalid ones rejected": {
+			body: `{"notes": [
+				{"owner": "a", "title": "1", "message": "m"},
+				{"owner": "a", "title": "", "message": "m"},
+				{"owner": "b", "title": "1", "message": "m"},
+				{"owner": "a", "title": "1", "message": "again"}
+			]}`,
+			expectedStatusCode: http.StatusOK,
+			expectedStatuses:   []schema.BatchNoteStatus{schema.BatchNoteCreated, schema.BatchNoteRejected, schema.BatchNoteCreated, schema.BatchNoteRejected},
+			expectedStored:     2,
+		},
+		"existing notes conflict and are kept": {
+			body:               `{"notes": [{"owner": "a", "title": "1", "message": "new"}, {"owner": "a", "title": "2", "message": "new"}]}`,
+			existing:           []schema.Note{{Owner: "a", Title: "1", Message: "old"}},
+			expectedStatusCode: http.StatusOK,
+			expectedStatuses:   []schema.BatchNoteStatus{schema.BatchNoteConflict, schema.BatchNoteCreated},
+			expectedStored:     2,
+		},
+		"write failures are reported per note": {
+			body:               `{"notes": [{"owner": "a", "title": "1", "message": "m"}, {"owner": "a", "message": "m"}]}`,
+			failWrites:         true,
+			expectedStatusCode: http.StatusOK,
+			expectedStatuses:   []schema.BatchNoteStatus{schema.BatchNoteFailed, schema.BatchNoteRejected},
+		},
+		"every note rejected": {
+			body:               `{"notes": [{"owner": "a"}]}`,
+			expectedStatusCode: http.StatusOK,
+			expectedStatuses:   []schema.BatchNoteStatus{schema.BatchNoteRejected},
+		},
+		"empty batch": {
+			body:               `{"notes": []}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"too many notes": {
+			body:               `{"notes": [` + strings.Join(tooMany, ",") + `]}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"invalid json": {
+			body:               `{"notes": {}}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := ddbfake.NewNotesTable(testTableName)
+			for _, n := range tt.existing {
+				if _, err := ddb.AddNote(ctx, fake, testTableName, &n); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			h := &Handler{API: fake, TableName: testTableName}
+			if tt.failWrites {
+				h.API = failingBatchAPI{fake}
+			}
+
+			response, err := h.Handle(ctx, events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodPost,
+				Resource:   "/notes:batch",
+				Path:       "/notes:batch",
+				Body:       tt.body,
+			})
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if response.StatusCode != tt.expectedStatusCode {
+				t.Fatalf("expected status %d but got %d: %s", tt.expectedStatusCode, response.StatusCode, response.Body)
+			}
+			if tt.expectedStatuses == nil {
+				return
+			}
+			var body schema.BatchNoteResponse
+			if err = json.Unmarshal([]byte(response.Body), &body); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var statuses []schema.BatchNoteStatus
+			for i, result := range body.Results {
+				statuses = append(statuses, result.Status)
+				if result.Index != i {
+					t.Errorf("expected result %d to have index %d but got %d", i, i, result.Index)
+				}
+				if result.Status == schema.BatchNoteRejected && len(result.Errors) == 0 {
+					t.Errorf("expected rejected result %d to list its errors", i)
+				}
+			}
+			if !reflect.DeepEqual(tt.expectedStatuses, statuses) {
+				t.Errorf("expected statuses %v but got %v", tt.expectedStatuses, statuses)
+			}
+			if stored := len(fake.Items(testTableName)); stored != tt.expectedStored {
+				t.Errorf("expected %d notes to be stored but got %d", tt.expectedStored, stored)
+			}
+			for _, n := range tt.existing {
+				if stored, err := ddb.GetNote(ctx, fake, testTableName, n.Owner, n.Title); err != nil || stored.Message != n.Message {
+					t.Errorf("expected the existing note %+v to be kept but got %+v %v", n, stored, err)
+				}
+			}
+		})
+	}
+}
+
+// conflictingTransactAPI is the fake table with a TransactWriteItems that is always canceled by a conflicting write
+type conflictingTransactAPI struct {
+	*ddbfake.Client
+}
+
+func (conflictingTransactAPI) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, optFns ...func(options *dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return nil, &types.TransactionCanceledException{
+		Message: aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [None, TransactionConflict]"),
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("TransactionConflict"), Message: aws.String("Transaction is ongoing for the item")},
+		},
+	}
+}
+
+func TestHandler_HandleMoveCanceled(t *testing.T) {
+	ctx := context.Background()
+	fake := ddbfake.NewNotesTable(testTableName)
+	if _, err := ddb.CreateNote(ctx, fake, testTableName, &schema.Note{Owner: "test-owner", Title: "existing", Message: "test-message"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	h := &Handler{API: conflictingTransactAPI{fake}, TableName: testTableName}
+
+	response, err := h.Handle(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod:     http.MethodPost,
+		Resource:       moveResource,
+		Path:           "/notes/test-owner/existing:move",
+		PathParameters: map[string]string{"owner": "test-owner", "title": "existing"},
+		Body:           `{"title": "moved"}`,
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if response.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status %d but got %d: %s", http.StatusConflict, response.StatusCode, response.Body)
+	}
+	var problem schema.Problem
+	if err = json.Unmarshal([]byte(response.Body), &problem); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []schema.CancellationReason{
+		{Action: ddb.SourceAction, Code: "None"},
+		{Action: ddb.TargetAction, Code: "TransactionConflict", Message: "Transaction is ongoing for the item"},
+	}
+	if !reflect.DeepEqual(expected, problem.CancellationReasons) {
+		t.Errorf("expected cancellation reasons %+v but got %+v", expected, problem.CancellationReasons)
+	}
+	if _, ok := response.Headers["Location"]; ok {
+		t.Errorf("expected no Location header but got %q", response.Headers["Location"])
+	}
+	if stored := len(fake.Items(testTableName)); stored != 1 {
+		t.Errorf("expected 1 note to be stored but got %d", stored)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/akijowski/tweek-2021-sam/internal/admin"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/bootstrap"
+	"github.com/aws/aws-lambda-go/lambda"
+	"os"
+)
+
+var handler *admin.Handler
+
+func main() {
+	lambda.Start(handler.Handle)
+}
+
+func init() {
+	handler = &admin.Handler{
+		API:           bootstrap.MustDynamoDBClient(),
+		TableName:     os.Getenv("ADMIN_TABLE_NAME"),
+		Authenticator: auth.MustAuthenticatorFromEnv(),
+	}
+}
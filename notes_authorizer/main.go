@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
+	"github.com/akijowski/tweek-2021-sam/internal/authorizer"
+	"github.com/akijowski/tweek-2021-sam/internal/bootstrap"
+	"github.com/aws/aws-lambda-go/lambda"
+	"os"
+)
+
+var handler *authorizer.Handler
+
+func main() {
+	lambda.Start(handler.Handle)
+}
+
+func init() {
+	verifier, err := auth.VerifierFromEnv(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	handler = &authorizer.Handler{
+		API:              bootstrap.MustDynamoDBClient(),
+		APIKeysTableName: os.Getenv("API_KEYS_TABLE_NAME"),
+		Verifier:         verifier,
+	}
+}
@@ -8,12 +8,14 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/akijowski/tweek-2021-sam/internal/auth"
 	"github.com/akijowski/tweek-2021-sam/internal/schema"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/testcontainers/testcontainers-go"
 	"log"
@@ -66,7 +68,7 @@ func TestHandler_AcceptanceTest(t *testing.T) {
 			expectedAPIResponse: events.APIGatewayProxyResponse{
 				StatusCode: http.StatusCreated,
 				Headers: map[string]string{
-					"Location": "/test-owner",
+					"Location": "/notes/test-owner/test-title",
 				},
 				Body: "",
 			},
@@ -211,10 +213,11 @@ func newLambdaConfig(ctx context.Context, defaultRegion, endpointURL string) (aw
 func createTable(ctx context.Context, dynamoClient *dynamodb.Client, tableName string) error {
 	log.Printf("creating table: %q", tableName)
 	_, err := dynamoClient.CreateTable(ctx, &dynamodb.CreateTableInput{
-		TableName:             aws.String(tableName),
-		KeySchema:             schema.NotesKeySchema,
-		AttributeDefinitions:  schema.NotesAttributeDefinitions,
-		ProvisionedThroughput: schema.NotesProvisionedThroughput,
+		TableName:              aws.String(tableName),
+		KeySchema:              schema.NotesKeySchema,
+		AttributeDefinitions:   schema.NotesAttributeDefinitions,
+		GlobalSecondaryIndexes: schema.NotesGlobalSecondaryIndexes,
+		BillingMode:            types.BillingModePayPerRequest,
 	})
 	if err != nil {
 		return err
@@ -238,6 +241,15 @@ func wrapNoteRequestWithAPIGateway(note *schema.Note) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	gatewayReq := &events.APIGatewayProxyRequest{Body: string(body)}
+	gatewayReq := &events.APIGatewayProxyRequest{
+		Resource:   "/notes",
+		Path:       "/notes",
+		HTTPMethod: http.MethodPost,
+		Body:       string(body),
+		// the function trusts the Principal passed on by the authorizer, which is not part of a direct invocation
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: (&auth.Principal{Owner: note.Owner}).Context(),
+		},
+	}
 	return json.Marshal(gatewayReq)
 }
@@ -1,3 +1,13 @@
+locals {
+  # every key attribute of the indexes, by name, so an attribute shared by two indexes is only defined once
+  index_attributes = merge({}, [
+    for index in var.dynamo_global_secondary_indexes : {
+      (index.hash_key)  = index.hash_key_type
+      (index.range_key) = index.range_key_type
+    }
+  ]...)
+}
+
 resource "aws_dynamodb_table" "this" {
   name         = var.dynamo_table_name
   billing_mode = "PAY_PER_REQUEST"
@@ -7,9 +17,28 @@ resource "aws_dynamodb_table" "this" {
     name = var.dynamo_hash_key
     type = "S"
   }
-  attribute {
-    name = var.dynamo_range_key
-    type = "S"
+  dynamic "attribute" {
+    for_each = var.dynamo_range_key == null ? [] : [var.dynamo_range_key]
+    content {
+      name = attribute.value
+      type = "S"
+    }
+  }
+  dynamic "attribute" {
+    for_each = local.index_attributes
+    content {
+      name = attribute.key
+      type = attribute.value
+    }
+  }
+  dynamic "global_secondary_index" {
+    for_each = var.dynamo_global_secondary_indexes
+    content {
+      name            = global_secondary_index.value.name
+      hash_key        = global_secondary_index.value.hash_key
+      range_key       = global_secondary_index.value.range_key
+      projection_type = global_secondary_index.value.projection_type
+    }
   }
   ttl {
     attribute_name = var.dynamo_ttl_attribute
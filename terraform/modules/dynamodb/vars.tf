@@ -11,7 +11,7 @@ variable "dynamo_hash_key" {
 
 variable "dynamo_range_key" {
   type        = string
-  description = "The attribute name to be used as the Range (Sort) key, must be present in the attributes"
+  description = "The attribute name to be used as the Range (Sort) key, null for a table with only a Hash key"
   default     = null
 }
 
@@ -22,6 +22,18 @@ variable "dynamo_table_name" {
 
 variable "dynamo_ttl_attribute" {
   type        = string
-  description = "The name of the item attribute to run against the TTL expression"
-  default     = "timestamp"
-}
\ No newline at end of file
+  description = "The name of the item attribute to run against the TTL expression, it must hold epoch seconds"
+  default     = "expires_at"
+}
+variable "dynamo_global_secondary_indexes" {
+  type = list(object({
+    name            = string
+    hash_key        = string
+    hash_key_type   = string
+    range_key       = string
+    range_key_type  = string
+    projection_type = string
+  }))
+  description = "The global secondary indexes of the table, their key attributes are added to the table attributes"
+  default     = []
+}
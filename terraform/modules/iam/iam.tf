@@ -25,7 +25,7 @@ resource "aws_iam_role_policy_attachment" "xray_write_access" {
 resource "aws_iam_policy" "dynamo_access" {
   count       = var.enable_dynamo_access ? 1 : 0
   name        = "dynamodb-access"
-  description = "Provides access to the ${var.dynamo_table_name} dynamodb table"
+  description = "Provides access to the ${var.dynamo_table_name} dynamodb table and the API keys table"
   policy      = data.aws_iam_policy_document.dynamo_access[count.index].json
 }
 
@@ -57,9 +57,19 @@ data "aws_iam_policy_document" "dynamo_access" {
       "dynamodb:PutItem"
     ]
     resources = [
-      "arn:aws:dynamodb:*:*:table/${var.dynamo_table_name}"
+      "arn:aws:dynamodb:*:*:table/${var.dynamo_table_name}",
+      "arn:aws:dynamodb:*:*:table/${var.dynamo_table_name}/index/*"
     ]
   }
+  # the authorizer only ever looks up a key by its hash
+  dynamic "statement" {
+    for_each = var.api_keys_table_name == null ? [] : [var.api_keys_table_name]
+    content {
+      effect    = "Allow"
+      actions   = ["dynamodb:GetItem"]
+      resources = ["arn:aws:dynamodb:*:*:table/${statement.value}"]
+    }
+  }
 }
 
 # https://docs.aws.amazon.com/lambda/latest/dg/lambda-intro-execution-role.html#permissions-executionrole-features
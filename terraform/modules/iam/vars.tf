@@ -21,6 +21,12 @@ variable "dynamo_table_name" {
   description = "Required if var.enable_dynamo_access is true.  This is the dynamodb table needed for access"
 }
 
+variable "api_keys_table_name" {
+  type = string
+  description = "The API keys table read by the authorizer, null to grant no access to it"
+  default = null
+}
+
 variable "lambda_name" {
   type        = string
   description = "Required: the name of the Lambda Function"
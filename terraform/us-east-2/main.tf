@@ -29,11 +29,30 @@ module "dynamodb" {
   dynamo_table_name = var.dynamo_table_name
   dynamo_hash_key   = var.dynamo_hash_key
   dynamo_range_key  = var.dynamo_range_key
+  # matches schema.NotesGlobalSecondaryIndexes
+  dynamo_global_secondary_indexes = [
+    {
+      name            = "recent-notes"
+      hash_key        = "feed"
+      hash_key_type   = "S"
+      range_key       = "updated_at"
+      range_key_type  = "N"
+      projection_type = "ALL"
+    }
+  ]
+}
+
+# matches schema.APIKeysKeySchema, expired keys are deleted by TTL on expires_at
+module "api_keys_dynamodb" {
+  source            = "../modules/dynamodb"
+  dynamo_table_name = var.api_keys_table_name
+  dynamo_hash_key   = "key_hash"
 }
 
 module "iam_role" {
   source                   = "../modules/iam"
   dynamo_table_name        = var.dynamo_table_name
+  api_keys_table_name      = var.api_keys_table_name
   lambda_name              = var.lambda_name
   enable_basic_execution   = true
   enable_dynamo_access     = true
@@ -2,6 +2,10 @@ output "dynamodb_table_arn" {
   value = module.dynamodb.dynamodb_table_arn
 }
 
+output "api_keys_table_arn" {
+  value = module.api_keys_dynamodb.dynamodb_table_arn
+}
+
 output "lambda_iam_role_arn" {
   value = module.iam_role.lambda_execution_role_arn
 }
\ No newline at end of file
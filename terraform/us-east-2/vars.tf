@@ -19,6 +19,11 @@ variable "dynamo_table_name" {
   description = "The name of the DynamoDB table that needs to be created"
 }
 
+variable "api_keys_table_name" {
+  type        = string
+  description = "The name of the DynamoDB table storing the API keys read by the authorizer"
+}
+
 variable "lambda_name" {
   type        = string
   description = "Required: the name of the Lambda Function"